@@ -2,7 +2,9 @@ package app
 
 import (
 	"database/sql"
+	"strings"
 
+	"github.com/reinbowARA/PassLedger/crypto"
 	"github.com/reinbowARA/PassLedger/db"
 	"github.com/reinbowARA/PassLedger/models"
 
@@ -12,7 +14,7 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
-func showAddForm(win fyne.Window, database *sql.DB, key []byte, onSave func(filters models.SearchFilters), editEntry ...*models.PasswordEntry) {
+func showAddForm(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, onSave func(filters models.SearchFilters), editEntry ...*models.PasswordEntry) {
 	var e models.PasswordEntry
 	editMode := len(editEntry) > 0
 	if editMode {
@@ -35,7 +37,7 @@ func showAddForm(win fyne.Window, database *sql.DB, key []byte, onSave func(filt
 	urlEntry.SetPlaceHolder(models.URL)
 	urlEntry.SetText(e.URL)
 
-	existingGroups := getUniqueGroupsFromDB(database, key)
+	existingGroups := getUniqueGroupsFromDB(database, keys)
 	groupOptions := []string{}
 	for _, g := range existingGroups {
 		if g != models.DefaultNameAllGroups {
@@ -65,7 +67,7 @@ func showAddForm(win fyne.Window, database *sql.DB, key []byte, onSave func(filt
 
 	// Создаем поле для ввода новой группы
 	groupEntry := widget.NewEntry()
-	groupEntry.SetPlaceHolder("Или введите новую группу")
+	groupEntry.SetPlaceHolder("Или введите новую группу (подгруппу — через «/»)")
 	if e.Group != "" {
 		// Проверяем, есть ли текущая группа в списке
 		found := false
@@ -108,13 +110,23 @@ func showAddForm(win fyne.Window, database *sql.DB, key []byte, onSave func(filt
 	notesEntry.SetPlaceHolder(models.NOTES)
 	notesEntry.SetText(e.Notes)
 
+	otpEntry := widget.NewPasswordEntry()
+	otpEntry.SetPlaceHolder("otpauth://totp/... или секрет base32")
+	otpEntry.SetText(e.OTP)
+
+	fieldsEditor, collectFields := newCustomFieldsEditor(e.Fields)
+	tagsEditor, collectTags := newTagsEditor(e.Tags, tagOptions(database, keys)[1:])
+
 	form := widget.NewForm(
 		widget.NewFormItem(models.TITLE, titleEntry),
 		widget.NewFormItem(models.LOGIN, loginEntry),
 		widget.NewFormItem(models.PASSWD, passEntry),
 		widget.NewFormItem(models.URL, urlEntry),
 		widget.NewFormItem(models.GROUP, groupContainer),
+		widget.NewFormItem(models.TAGS, tagsEditor),
 		widget.NewFormItem(models.NOTES, notesEntry),
+		widget.NewFormItem(models.OTP, otpEntry),
+		widget.NewFormItem(models.FIELDS, fieldsEditor),
 	)
 
 	saveBtn := func() {
@@ -124,6 +136,19 @@ func showAddForm(win fyne.Window, database *sql.DB, key []byte, onSave func(filt
 			selectedGroup = groupEntry.Text
 		}
 
+		fields, err := collectFields()
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		otpSecret := strings.TrimSpace(otpEntry.Text)
+		if otpSecret != "" {
+			if _, err := crypto.ParseOTP(otpSecret); err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+		}
+
 		newEntry := models.PasswordEntry{
 			Title:    titleEntry.Text,
 			Username: loginEntry.Text,
@@ -131,14 +156,16 @@ func showAddForm(win fyne.Window, database *sql.DB, key []byte, onSave func(filt
 			URL:      urlEntry.Text,
 			Group:    selectedGroup,
 			Notes:    notesEntry.Text,
+			Fields:   fields,
+			Tags:     collectTags(),
+			OTP:      otpSecret,
 		}
 
-		var err error
 		if editMode {
 			newEntry.ID = e.ID
-			err = db.UpdateEntry(database, key, newEntry)
+			err = db.UpdateEntry(database, keys, newEntry)
 		} else {
-			err = db.SaveEntry(database, key, newEntry)
+			_, err = db.SaveEntry(database, keys, newEntry)
 		}
 
 		if err != nil {
@@ -162,35 +189,43 @@ func showAddForm(win fyne.Window, database *sql.DB, key []byte, onSave func(filt
 	)
 }
 
-func showAddGroup(win fyne.Window, database *sql.DB, key []byte, groupsSlice *[]string, groupList *widget.List) {
+// showAddGroup — диалог новой группы; по умолчанию она создаётся внутри группы с путём parent
+func showAddGroup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, groups *groupTree, groupList *widget.Tree, parent string) {
 	entry := widget.NewEntry()
 	entry.SetPlaceHolder("Название новой группы")
 
+	parentSelect := widget.NewSelect(groups.parentOptions(0), nil)
+	parentSelect.SetSelected(topLevelGroup)
+	if g, ok := groups.byPath(parent); ok {
+		parentSelect.SetSelected(g.Path)
+	}
+
 	dialog.ShowCustomConfirm(
 		"Добавить группу",
 		models.CREATE,
 		models.CANCEL,
-		entry,
+		widget.NewForm(
+			widget.NewFormItem("Название", entry),
+			widget.NewFormItem("Родитель", parentSelect),
+		),
 		func(ok bool) {
 			if ok {
 				name := entry.Text
 				if name == "" {
 					return
 				}
-				// не допускаем дубли
-				for _, g := range *groupsSlice {
-					if g == name {
-						return
-					}
+				// добавляем в db; дубли внутри родителя db не допустит
+				parentPath := ""
+				if g, ok := groups.byPath(parentSelect.Selected); ok {
+					parentPath = g.Path
 				}
-				// добавляем в db
-				err := db.AddGroup(database, name)
+				err := db.AddGroup(database, keys, name, parentPath)
 				if err != nil {
 					dialog.ShowError(err, win)
 					return
 				}
-				// обновляем список групп из db
-				*groupsSlice = getUniqueGroupsFromDB(database, key)
+				// обновляем дерево групп из db
+				*groups = loadGroupTree(database, keys)
 				groupList.Refresh()
 			}
 		},
@@ -198,7 +233,8 @@ func showAddGroup(win fyne.Window, database *sql.DB, key []byte, groupsSlice *[]
 	)
 }
 
-func showRenameGroup(win fyne.Window, oldName string, entries *[]models.PasswordEntry, groupsSlice *[]string, groupList *widget.List, database *sql.DB, key []byte, filters models.SearchFilters, onRefresh func()) {
+func showRenameGroup(win fyne.Window, id int, entries *[]models.PasswordEntry, groups *groupTree, groupList *widget.Tree, database *sql.DB, keys *crypto.VaultKeys, filters models.SearchFilters, onRefresh func()) {
+	oldName := groups.byID[id].Name
 	entry := widget.NewEntry()
 	entry.SetText(oldName)
 	dialog.ShowCustomConfirm(
@@ -210,8 +246,11 @@ func showRenameGroup(win fyne.Window, oldName string, entries *[]models.Password
 			if ok {
 				newName := entry.Text
 				if newName != "" && newName != oldName {
-					db.UpdateGroup(database, oldName, newName)
-					*groupsSlice = getUniqueGroupsFromDB(database, key)
+					if err := db.UpdateGroup(database, keys, id, newName); err != nil {
+						dialog.ShowError(err, win)
+						return
+					}
+					*groups = loadGroupTree(database, keys)
 					onRefresh()
 					groupList.Refresh()
 				}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// showAttachmentsDialog показывает вложения записи с добавлением, сохранением на диск и удалением
+func showAttachmentsDialog(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, entry models.PasswordEntry) {
+	var attachments []models.Attachment
+	load := func() error {
+		var err error
+		attachments, err = db.ListAttachments(database, keys, entry.ID)
+		return err
+	}
+	if err := load(); err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+
+	var list *widget.List
+	reload := func() {
+		if err := load(); err != nil {
+			dialog.ShowError(err, win)
+		}
+		list.Refresh()
+	}
+
+	list = widget.NewList(
+		func() int { return len(attachments) },
+		func() fyne.CanvasObject {
+			saveBtn := widget.NewButtonWithIcon("", theme.DocumentSaveIcon(), nil)
+			delBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)
+			return container.NewBorder(nil, nil, nil, container.NewHBox(saveBtn, delBtn), widget.NewLabel(""))
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			att := attachments[i]
+			row := o.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("%s — %s, %s", att.Name, formatSize(att.Size), formatTime(att.Created)))
+			btns := row.Objects[1].(*fyne.Container)
+			btns.Objects[0].(*widget.Button).OnTapped = func() {
+				fd := dialog.NewFileSave(func(uc fyne.URIWriteCloser, err error) {
+					if uc == nil {
+						return
+					}
+					err = db.WriteAttachment(database, keys, att.ID, uc)
+					if cerr := uc.Close(); err == nil {
+						err = cerr
+					}
+					if err != nil {
+						dialog.ShowError(err, win)
+						return
+					}
+					dialog.ShowInformation("Вложения", "Файл сохранён", win)
+				}, win)
+				fd.SetFileName(att.Name)
+				fd.Resize(fyne.NewSize(800, 600))
+				fd.Show()
+			}
+			btns.Objects[1].(*widget.Button).OnTapped = func() {
+				dialog.ShowConfirm("Удаление вложения", "Удалить вложение «"+att.Name+"»?", func(ok bool) {
+					if !ok {
+						return
+					}
+					if err := db.DeleteAttachment(database, att.ID); err != nil {
+						dialog.ShowError(err, win)
+					}
+					reload()
+				}, win)
+			}
+		},
+	)
+
+	addBtn := widget.NewButtonWithIcon("Добавить файл", theme.ContentAddIcon(), func() {
+		fd := dialog.NewFileOpen(func(uc fyne.URIReadCloser, err error) {
+			if uc == nil {
+				return
+			}
+			defer uc.Close()
+			if _, err := db.AddAttachment(database, keys, entry.ID, uc.URI().Name(), uc); err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			reload()
+		}, win)
+		fd.Resize(fyne.NewSize(800, 600))
+		fd.Show()
+	})
+
+	content := container.NewBorder(nil, container.NewHBox(addBtn), nil, nil, list)
+	dlg := dialog.NewCustom("Вложения: "+entry.Title, "Закрыть", content, win)
+	dlg.Resize(fyne.NewSize(600, 400))
+	dlg.Show()
+}
+
+// formatSize выводит размер файла в удобных единицах
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f МБ", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f КБ", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d Б", size)
+}
+
+// attachmentsDirFor — каталог вложений рядом с CSV-файлом экспорта: passwords.csv -> passwords_attachments
+func attachmentsDirFor(csvPath string) string {
+	return strings.TrimSuffix(csvPath, filepath.Ext(csvPath)) + "_attachments"
+}
+
+// exportEntryAttachments сохраняет вложения записи в <baseDir>/<каталог вложений>/<id записи>/
+// и возвращает их пути относительно baseDir в виде JSON для колонки Attachments CSV
+func exportEntryAttachments(database *sql.DB, keys *crypto.VaultKeys, entryID int, baseDir, attachmentsDir string) (string, error) {
+	attachments, err := db.ListAttachments(database, keys, entryID)
+	if err != nil || len(attachments) == 0 {
+		return "", err
+	}
+	rel := path.Join(filepath.Base(attachmentsDir), fmt.Sprint(entryID))
+	dir := filepath.Join(baseDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	var paths []string
+	used := map[string]bool{}
+	for _, att := range attachments {
+		base := safeFileName(att.Name)
+		name := base
+		// одинаковые имена в одной записи получают номер
+		for n := 2; used[name]; n++ {
+			ext := filepath.Ext(base)
+			name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		used[name] = true
+
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return "", err
+		}
+		err = db.WriteAttachment(database, keys, att.ID, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", err
+		}
+		paths = append(paths, path.Join(rel, name))
+	}
+	data, err := json.Marshal(paths)
+	return string(data), err
+}
+
+// importEntryAttachments прикрепляет к записи файлы из колонки Attachments CSV.
+// Пути берутся относительно каталога CSV-файла и не могут выходить за его пределы.
+func importEntryAttachments(im *db.Import, entryID int, baseDir, column string) error {
+	column = strings.TrimSpace(column)
+	if column == "" {
+		return nil
+	}
+	var paths []string
+	if err := json.Unmarshal([]byte(column), &paths); err != nil {
+		return fmt.Errorf("некорректная колонка attachments: %w", err)
+	}
+	for _, p := range paths {
+		local := filepath.FromSlash(p)
+		if !filepath.IsLocal(local) {
+			return fmt.Errorf("вложение %q: путь должен быть внутри каталога CSV-файла", p)
+		}
+		f, err := os.Open(filepath.Join(baseDir, local))
+		if err != nil {
+			return err
+		}
+		err = im.AddAttachment(entryID, filepath.Base(local), f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("вложение %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// safeFileName убирает из имени вложения разделители каталогов и прочие опасные для файловой системы символы
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "attachment"
+	}
+	return name
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/config"
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+)
+
+// idleLock вызывает onLock в UI-потоке, если с последнего touch прошло больше timeout.
+// Если в этот момент busy сообщает, что пользователь занят (открыт диалог или форма),
+// блокировка откладывается один раз ещё на timeout: нажатия внутри полей ввода до окна
+// не доходят, и иначе окно могло бы заблокироваться посреди набора. После отсрочки окно
+// блокируется в любом случае, иначе забытый открытым диалог держал бы базу открытой вечно.
+// Нулевое значение ничего не делает до вызова start.
+type idleLock struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	timer   *time.Timer
+	busy    func() bool
+	onLock  func()
+}
+
+// start включает отсчёт; timeout <= 0 отключает автоблокировку, busy может быть nil
+func (l *idleLock) start(timeout time.Duration, busy func() bool, onLock func()) {
+	l.mu.Lock()
+	l.timeout = timeout
+	l.busy = busy
+	l.onLock = onLock
+	l.mu.Unlock()
+	l.touch()
+}
+
+// watch считает действием пользователя любое нажатие клавиши в окне вне полей ввода
+func (l *idleLock) watch(c fyne.Canvas) {
+	c.SetOnTypedRune(func(rune) { l.touch() })
+	c.SetOnTypedKey(func(*fyne.KeyEvent) { l.touch() })
+	if dc, ok := c.(desktop.Canvas); ok {
+		dc.SetOnKeyDown(func(*fyne.KeyEvent) { l.touch() })
+	}
+}
+
+// setTimeout меняет таймаут после сохранения настроек
+func (l *idleLock) setTimeout(timeout time.Duration) {
+	l.mu.Lock()
+	l.timeout = timeout
+	l.mu.Unlock()
+	l.touch()
+}
+
+// touch отмечает действие пользователя и перезапускает отсчёт
+func (l *idleLock) touch() {
+	l.arm(false)
+}
+
+// arm перезапускает отсчёт; grace — это уже отсрочка из-за открытого диалога
+func (l *idleLock) arm(grace bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if l.timeout <= 0 || l.onLock == nil {
+		return
+	}
+	busy, onLock := l.busy, l.onLock
+	l.timer = time.AfterFunc(l.timeout, func() {
+		fyne.Do(func() {
+			if !grace && busy != nil && busy() {
+				l.arm(true)
+				return
+			}
+			onLock()
+		})
+	})
+}
+
+// stop отключает автоблокировку
+func (l *idleLock) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.onLock = nil
+}
+
+// showLockWindow показывает экран блокировки для уже открытой базы.
+// После успешной проверки мастер-пароля заново открывается главное окно.
+func showLockWindow(a fyne.App, database *sql.DB) {
+	win := a.NewWindow("Password Book — Заблокировано")
+	win.CenterOnScreen()
+
+	settings, _ := config.Load()
+
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Введите мастер-пароль")
+
+	keyfileEntry, keyfileSelector := newKeyfileSelector(win, false)
+	keyfileEntry.SetText(settings.KeyfilePath)
+
+	status := widget.NewLabel("")
+
+	unlock := func() {
+		if passwordEntry.Text == "" {
+			status.SetText("⚠️ Пароль не может быть пустым!")
+			return
+		}
+		keyfile, err := readKeyfile(keyfileEntry.Text)
+		if err != nil {
+			status.SetText("Ошибка: " + err.Error())
+			return
+		}
+		master := []byte(passwordEntry.Text)
+		keys, err := db.Unlock(database, master, keyfile)
+		crypto.Wipe(master)
+		crypto.Wipe(keyfile)
+		if err != nil {
+			passwordEntry.SetText("")
+			status.SetText("Ошибка: " + err.Error())
+			return
+		}
+		entries, _ := db.LoadAllEntries(database, keys)
+		ShowMainWindow(a, database, keys, entries)
+		win.Close()
+	}
+	passwordEntry.OnSubmitted = func(string) { unlock() }
+
+	unlockBtn := widget.NewButtonWithIcon("Разблокировать", theme.ConfirmIcon(), unlock)
+	unlockBtn.Importance = widget.HighImportance
+	exitBtn := widget.NewButtonWithIcon("Выйти", theme.LogoutIcon(), func() {
+		database.Close()
+		a.Quit()
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("База заблокирована после простоя. Введите мастер-пароль"),
+		passwordEntry,
+		keyfileSelector,
+		status,
+		layout.NewSpacer(),
+		container.NewHBox(layout.NewSpacer(), unlockBtn, exitBtn),
+	)
+
+	win.SetContent(container.NewPadded(content))
+	win.Resize(fyne.NewSize(400, 0))
+	win.Show()
+	win.Canvas().Focus(passwordEntry)
+}
@@ -0,0 +1,269 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/backup"
+	"github.com/reinbowARA/PassLedger/config"
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// showBackupPassphraseDialog спрашивает парольную фразу резервной копии;
+// при создании копии фразу нужно повторить
+func showBackupPassphraseDialog(win fyne.Window, title string, create bool, onOK func(passphrase string)) {
+	passphraseEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+	items := []*widget.FormItem{widget.NewFormItem("Парольная фраза", passphraseEntry)}
+	if create {
+		passphraseEntry.SetPlaceHolder("Лучше не совпадающая с мастер-паролем")
+		items = append(items, widget.NewFormItem("Повтор", confirmEntry))
+	}
+	dlg := dialog.NewCustomConfirm(title, "OK", models.CANCEL, widget.NewForm(items...), func(ok bool) {
+		if !ok {
+			return
+		}
+		if passphraseEntry.Text == "" {
+			dialog.ShowError(fmt.Errorf("Парольная фраза не может быть пустой"), win)
+			return
+		}
+		if create && passphraseEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("Парольные фразы не совпадают"), win)
+			return
+		}
+		onOK(passphraseEntry.Text)
+	}, win)
+	dlg.Resize(fyne.NewSize(450, 0))
+	dlg.Show()
+}
+
+// showBackupPopup сохраняет всё хранилище в зашифрованную резервную копию.
+// Ключ из парольной фразы выводится с теми же параметрами KDF, что и ключ базы.
+// Снимок пишется в файл по мере чтения базы, не собираясь в памяти.
+func showBackupPopup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys) {
+	showBackupPassphraseDialog(win, "Резервная копия", true, func(passphrase string) {
+		params, err := db.GetKDFParams(database)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		fd := dialog.NewFileSave(func(uc fyne.URIWriteCloser, e error) {
+			if uc == nil {
+				return
+			}
+			info, err := writeBackup(uc, database, keys, passphrase, params)
+			if cerr := uc.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				// недописанная копия не восстановится, оставлять её незачем
+				storage.Delete(uc.URI())
+				dialog.ShowError(fmt.Errorf("Ошибка создания резервной копии: %v", err), win)
+				return
+			}
+			dialog.ShowInformation("Резервная копия",
+				fmt.Sprintf("Резервная копия сохранена: %d записей, %d групп.\nБез парольной фразы восстановить её нельзя.", info.Entries, len(info.Groups)), win)
+		}, win)
+		fd.SetFileName("passledger_" + time.Now().Format("2006-01-02") + ".plbackup")
+		fd.SetFilter(storage.NewExtensionFileFilter([]string{".plbackup"}))
+		fd.Resize(fyne.NewSize(800, 600))
+		fd.Show()
+	})
+}
+
+// writeBackup пишет в w резервную копию хранилища и возвращает сводку записанного снимка
+func writeBackup(w io.Writer, database *sql.DB, keys *crypto.VaultKeys, passphrase string, params crypto.KDFParams) (models.SnapshotInfo, error) {
+	bw, err := backup.NewWriter(w, passphrase, params)
+	if err != nil {
+		return models.SnapshotInfo{}, err
+	}
+	info, err := db.Snapshot(database, keys, bw)
+	if cerr := bw.Close(); err == nil {
+		err = cerr
+	}
+	return info, err
+}
+
+// showRestorePopup открывает резервную копию и восстанавливает её в новую базу
+// или объединяет с открытой. Копия читается из файла по мере восстановления, поэтому файл
+// остаётся открытым, пока пользователь выбирает, куда её восстановить.
+func showRestorePopup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, onImport func()) {
+	fd := dialog.NewFileOpen(func(uc fyne.URIReadCloser, e error) {
+		if uc == nil {
+			return
+		}
+		path := uc.URI().Path()
+		uc.Close()
+		showBackupPassphraseDialog(win, "Восстановление из копии", false, func(passphrase string) {
+			f, err := os.Open(path)
+			if err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			src, err := backup.NewReader(f, passphrase)
+			if err != nil {
+				f.Close()
+				dialog.ShowError(err, win)
+				return
+			}
+			showRestoreChoice(win, database, keys, &restoreSource{Reader: src, file: f}, onImport)
+		})
+	}, win)
+	fd.SetFilter(storage.NewExtensionFileFilter([]string{".plbackup"}))
+	fd.Resize(fyne.NewSize(800, 600))
+	fd.Show()
+}
+
+// restoreSource — открытая резервная копия вместе с её файлом
+type restoreSource struct {
+	*backup.Reader
+	file *os.File
+}
+
+// Close стирает ключ копии и закрывает файл
+func (s *restoreSource) Close() error {
+	s.Reader.Close()
+	return s.file.Close()
+}
+
+// showRestoreChoice предлагает, куда восстановить копию; src закрывается, когда выбор сделан
+// и копия восстановлена или диалог отменён
+func showRestoreChoice(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, src *restoreSource, onImport func()) {
+	info := src.Info()
+	var dlg dialog.Dialog
+	chosen := false
+	mergeBtn := widget.NewButton("Объединить с текущей базой", func() {
+		chosen = true
+		dlg.Hide()
+		added, err := db.RestoreSnapshot(database, keys, src, true)
+		src.Close()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("Восстановление отменено, база не изменена: %v", err), win)
+			return
+		}
+		if onImport != nil {
+			onImport()
+		}
+		dialog.ShowInformation("Восстановление",
+			fmt.Sprintf("Добавлено %d записей, %d уже были в базе", added, info.Entries-added), win)
+	})
+	newBtn := widget.NewButton("Восстановить в новую базу", func() {
+		chosen = true
+		dlg.Hide()
+		showRestoreNewDatabase(win, src)
+	})
+	newBtn.Importance = widget.HighImportance
+	label := widget.NewLabel(fmt.Sprintf("В копии %d записей и %d групп.\n"+
+		"В новую базу копия переносится целиком, с корзиной и настройками истории.\n"+
+		"При объединении записи, которые уже есть в базе, пропускаются.", info.Entries, len(info.Groups)))
+	dlg = dialog.NewCustom("Восстановление из копии", models.CANCEL, container.NewVBox(label, newBtn, mergeBtn), win)
+	dlg.SetOnClosed(func() {
+		if !chosen {
+			src.Close()
+		}
+	})
+	dlg.Show()
+}
+
+// showRestoreNewDatabase создаёт новую базу со своим мастер-паролем и восстанавливает в неё копию.
+// Существующий файл не перезаписывается; открыть новую базу можно через настройки.
+// Копия читается один раз, поэтому src закрывается при любом закрытии диалога.
+func showRestoreNewDatabase(win fyne.Window, src *restoreSource) {
+	settings, _ := config.Load()
+	dirEntry := widget.NewEntry()
+	dirEntry.SetText(filepath.Dir(settings.DBPath))
+	browseBtn := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+		fd := dialog.NewFolderOpen(func(lu fyne.ListableURI, e error) {
+			if lu != nil {
+				dirEntry.SetText(lu.Path())
+			}
+		}, win)
+		fd.Resize(fyne.NewSize(800, 600))
+		fd.Show()
+	})
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText("restored.db")
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Мастер-пароль новой базы")
+	confirmEntry := widget.NewPasswordEntry()
+	confirmEntry.SetPlaceHolder("Повторите мастер-пароль")
+	keyfileEntry, keyfileSelector := newKeyfileSelector(win, true)
+
+	form := widget.NewForm(
+		widget.NewFormItem("Папка", container.NewBorder(nil, nil, nil, browseBtn, dirEntry)),
+		widget.NewFormItem("Файл базы", nameEntry),
+		widget.NewFormItem("Мастер-пароль", passwordEntry),
+		widget.NewFormItem("Повтор", confirmEntry),
+		widget.NewFormItem("Ключевой файл", keyfileSelector),
+	)
+	dlg := dialog.NewCustomConfirm("Восстановить в новую базу", "Восстановить", models.CANCEL, form, func(ok bool) {
+		defer src.Close()
+		if !ok {
+			return
+		}
+		if passwordEntry.Text == "" {
+			dialog.ShowError(fmt.Errorf("Пароль не может быть пустым"), win)
+			return
+		}
+		if passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("Пароли не совпадают"), win)
+			return
+		}
+		if nameEntry.Text == "" {
+			dialog.ShowError(fmt.Errorf("Укажите имя файла базы"), win)
+			return
+		}
+		path := filepath.Join(dirEntry.Text, nameEntry.Text)
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			dialog.ShowError(fmt.Errorf("Файл %s уже существует: выберите другое имя", path), win)
+			return
+		}
+		keyfile, err := readKeyfile(keyfileEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		defer crypto.Wipe(keyfile)
+		master := []byte(passwordEntry.Text)
+		err = restoreToNewDatabase(path, master, keyfile, src)
+		crypto.Wipe(master)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("Ошибка восстановления: %v", err), win)
+			return
+		}
+		dialog.ShowInformation("Восстановление",
+			fmt.Sprintf("Копия восстановлена в %s.\nЧтобы работать с этой базой, выберите её в настройках.", path), win)
+	}, win)
+	dlg.Resize(fyne.NewSize(550, 0))
+	dlg.Show()
+}
+
+// restoreToNewDatabase создаёт базу path и переносит в неё снимок; при ошибке
+// недовосстановленная база удаляется
+func restoreToNewDatabase(path string, password, keyfile []byte, src db.SnapshotReader) error {
+	newDB, newKeys, err := db.CreateNewDatabase(path, password, keyfile)
+	if err != nil {
+		return err
+	}
+	_, err = db.RestoreSnapshot(newDB, newKeys, src, false)
+	newKeys.Wipe()
+	newDB.Close()
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,408 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/bitwarden"
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// bitwardenField — поле карты, личности или SSH-ключа Bitwarden и дополнительное поле,
+// которым оно становится в PassLedger
+type bitwardenField struct {
+	key    string // ключ в JSON Bitwarden
+	label  string // имя дополнительного поля
+	hidden bool
+}
+
+var bitwardenCardFields = []bitwardenField{
+	{"cardholderName", "Владелец карты", false},
+	{"brand", "Платёжная система", false},
+	{"number", "Номер карты", true},
+	{"expMonth", "Месяц окончания", false},
+	{"expYear", "Год окончания", false},
+	{"code", "Код безопасности", true},
+}
+
+var bitwardenIdentityFields = []bitwardenField{
+	{"title", "Обращение", false},
+	{"firstName", "Имя", false},
+	{"middleName", "Отчество", false},
+	{"lastName", "Фамилия", false},
+	{"username", "Имя пользователя", false},
+	{"company", "Компания", false},
+	{"ssn", "Номер соцстрахования", true},
+	{"passportNumber", "Номер паспорта", true},
+	{"licenseNumber", "Номер водительского удостоверения", true},
+	{"email", "Эл. почта", false},
+	{"phone", "Телефон", false},
+	{"address1", "Адрес 1", false},
+	{"address2", "Адрес 2", false},
+	{"address3", "Адрес 3", false},
+	{"city", "Город", false},
+	{"state", "Регион", false},
+	{"postalCode", "Почтовый индекс", false},
+	{"country", "Страна", false},
+}
+
+var bitwardenSSHKeyFields = []bitwardenField{
+	{"privateKey", "Закрытый ключ", true},
+	{"publicKey", "Открытый ключ", false},
+	{"keyFingerprint", "Отпечаток ключа", false},
+}
+
+// дополнительные адреса входа Bitwarden становятся полями-ссылками «URL 2», «URL 3», ...
+var bitwardenExtraURI = regexp.MustCompile(`^URL \d+$`)
+
+// bitwardenTime — формат дат в экспорте Bitwarden
+const bitwardenTime = "2006-01-02T15:04:05.000Z"
+
+// showBitwardenPasswordDialog спрашивает пароль экспорта; при экспорте пустой пароль
+// означает открытый JSON, а пароль нужно повторить
+func showBitwardenPasswordDialog(win fyne.Window, title string, export bool, onOK func(password string)) {
+	passwordEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+	items := []*widget.FormItem{widget.NewFormItem("Пароль", passwordEntry)}
+	if export {
+		passwordEntry.SetPlaceHolder("Пусто — файл без шифрования")
+		items = append(items, widget.NewFormItem("Повтор", confirmEntry))
+	}
+	dlg := dialog.NewCustomConfirm(title, "OK", models.CANCEL, widget.NewForm(items...), func(ok bool) {
+		if !ok {
+			return
+		}
+		if export && passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("Пароли не совпадают"), win)
+			return
+		}
+		onOK(passwordEntry.Text)
+	}, win)
+	dlg.Resize(fyne.NewSize(450, 0))
+	dlg.Show()
+}
+
+// showBitwardenExportPopup сохраняет записи в JSON Bitwarden, открытый или защищённый паролем
+func showBitwardenExportPopup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys) {
+	showBitwardenPasswordDialog(win, "Экспорт в Bitwarden", true, func(password string) {
+		export, err := exportBitwarden(database, keys)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		fd := dialog.NewFileSave(func(uc fyne.URIWriteCloser, e error) {
+			if uc == nil {
+				return
+			}
+			defer uc.Close()
+			data, err := bitwarden.Encode(export, password)
+			if err == nil {
+				_, err = uc.Write(data)
+				crypto.Wipe(data)
+			}
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("Ошибка экспорта в Bitwarden: %v", err), win)
+				return
+			}
+			dialog.ShowInformation("Экспорт", "Файл Bitwarden сохранён", win)
+		}, win)
+		fd.SetFileName("bitwarden_export.json")
+		fd.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+		fd.Resize(fyne.NewSize(800, 600))
+		fd.Show()
+	})
+}
+
+// showBitwardenImportPopup переносит записи из JSON Bitwarden; пароль спрашивается,
+// только если экспорт им защищён
+func showBitwardenImportPopup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, onImport func()) {
+	fd := dialog.NewFileOpen(func(uc fyne.URIReadCloser, e error) {
+		if uc == nil {
+			return
+		}
+		data, err := io.ReadAll(uc)
+		uc.Close()
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		load := func(password string) {
+			export, err := bitwarden.Decode(data, password)
+			if err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			imported, err := importBitwarden(database, keys, export)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("Импорт отменён, база не изменена: %v", err), win)
+				return
+			}
+			if onImport != nil {
+				onImport()
+			}
+			dialog.ShowInformation("Импорт", fmt.Sprintf("Успешно импортировано %d записей", imported), win)
+		}
+		protected, err := bitwarden.NeedsPassword(data)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		if protected {
+			showBitwardenPasswordDialog(win, "Импорт из Bitwarden", false, load)
+			return
+		}
+		load("")
+	}, win)
+	fd.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+	fd.Resize(fyne.NewSize(800, 600))
+	fd.Show()
+}
+
+// importBitwarden сохраняет элементы экспорта одной транзакцией и возвращает их число.
+// Папки становятся группами: «Работа/Проект» — подгруппа «Проект» группы «Работа».
+func importBitwarden(database *sql.DB, keys *crypto.VaultKeys, export *bitwarden.Export) (int, error) {
+	im, err := db.BeginImport(database, keys)
+	if err != nil {
+		return 0, err
+	}
+	defer im.Rollback()
+	groups, err := newImportGroups(im)
+	if err != nil {
+		return 0, err
+	}
+	folders := map[string]string{}
+	for _, f := range export.Folders {
+		folders[f.ID] = f.Name
+		if _, err := groups.addPath(f.Name, "/"); err != nil {
+			return 0, err
+		}
+	}
+
+	imported := 0
+	for _, item := range export.Items {
+		if item.DeletedDate != "" {
+			continue // элемент из корзины Bitwarden
+		}
+		group := ""
+		if item.FolderID != nil {
+			if group, err = groups.addPath(folders[*item.FolderID], "/"); err != nil {
+				return 0, err
+			}
+		}
+		entry, revisions := entryFromBitwarden(item, group)
+		id, err := im.SaveEntry(entry)
+		if err != nil {
+			return 0, fmt.Errorf("запись '%s': %w", item.Name, err)
+		}
+		if len(revisions) > 0 {
+			if err := im.AddRevisions(id, revisions); err != nil {
+				return 0, fmt.Errorf("запись '%s': %w", item.Name, err)
+			}
+		}
+		imported++
+	}
+	return imported, im.Commit()
+}
+
+// entryFromBitwarden переводит элемент в запись; история паролей Bitwarden становится
+// версиями записи, которые отличаются только паролем
+func entryFromBitwarden(item bitwarden.Item, group string) (models.PasswordEntry, []models.EntryRevision) {
+	e := models.PasswordEntry{Title: item.Name, Group: group}
+	if item.Notes != nil {
+		e.Notes = *item.Notes
+	}
+	addFields := func(values map[string]string, table []bitwardenField) {
+		for _, f := range table {
+			if v := values[f.key]; v != "" {
+				typ := models.FieldText
+				if f.hidden {
+					typ = models.FieldHidden
+				}
+				e.Fields = append(e.Fields, models.CustomField{Name: f.label, Value: v, Type: typ})
+			}
+		}
+	}
+
+	if l := item.Login; l != nil {
+		e.Username, e.Password = l.Username, l.Password
+		for i, u := range l.URIs {
+			if i == 0 {
+				e.URL = u.URI
+				continue
+			}
+			e.Fields = append(e.Fields, models.CustomField{Name: fmt.Sprintf("URL %d", i+1), Value: u.URI, Type: models.FieldURL})
+		}
+		if l.TOTP != "" {
+			// steam:// и прочие нестандартные секреты сохраняем, но не как TOTP
+			if p, err := crypto.ParseOTP(l.TOTP); err == nil {
+				crypto.Wipe(p.Secret)
+				e.OTP = l.TOTP
+			} else {
+				e.Fields = append(e.Fields, models.CustomField{Name: "TOTP", Value: l.TOTP, Type: models.FieldHidden})
+			}
+		}
+	}
+	addFields(item.Card, bitwardenCardFields)
+	addFields(item.Identity, bitwardenIdentityFields)
+	addFields(item.SSHKey, bitwardenSSHKeyFields)
+
+	for _, f := range item.Fields {
+		name := strings.TrimSpace(f.Name)
+		if name == "" {
+			name = "Поле"
+		}
+		switch f.Type {
+		case bitwarden.FieldLinked:
+			continue // ссылается на логин или пароль, которые уже перенесены
+		case bitwarden.FieldHidden:
+			e.Fields = append(e.Fields, models.CustomField{Name: name, Value: f.Value, Type: models.FieldHidden})
+		default:
+			e.Fields = append(e.Fields, models.CustomField{Name: name, Value: f.Value, Type: models.FieldText})
+		}
+	}
+
+	var revisions []models.EntryRevision
+	for _, h := range item.PasswordHistory {
+		changedAt, err := time.Parse(time.RFC3339, h.LastUsedDate)
+		if err != nil {
+			changedAt = time.Now()
+		}
+		old := e
+		old.Password = h.Password
+		revisions = append(revisions, models.EntryRevision{ChangedAt: changedAt, Entry: old})
+	}
+	return e, revisions
+}
+
+// exportBitwarden собирает все записи в экспорт Bitwarden; группы становятся папками
+// с полным путём через «/»
+func exportBitwarden(database *sql.DB, keys *crypto.VaultKeys) (*bitwarden.Export, error) {
+	entries, err := db.LoadAllEntries(database, keys)
+	if err != nil {
+		return nil, err
+	}
+	groups := loadGroupTree(database, keys)
+	export := &bitwarden.Export{}
+	folderIDs := map[string]string{} // путь группы -> id папки
+	for _, g := range groups.byID {
+		folderIDs[g.Path] = bitwarden.NewID()
+		export.Folders = append(export.Folders, bitwarden.Folder{ID: folderIDs[g.Path], Name: g.Path})
+	}
+	sort.Slice(export.Folders, func(i, j int) bool { return export.Folders[i].Name < export.Folders[j].Name })
+
+	for _, e := range entries {
+		revisions, err := db.ListRevisions(database, keys, e.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка экспорта записи '%s': %v", e.Title, err)
+		}
+		item := entryToBitwarden(e, revisions)
+		if id, ok := folderIDs[e.Group]; ok {
+			item.FolderID = &id
+		}
+		export.Items = append(export.Items, item)
+	}
+	return export, nil
+}
+
+// entryToBitwarden выбирает тип элемента: логин, если есть логин, пароль, URL или TOTP;
+// карта, личность или SSH-ключ, если все дополнительные поля — поля такого элемента
+// (так возвращаются обратно импортированные из Bitwarden); иначе заметка
+func entryToBitwarden(e models.PasswordEntry, revisions []models.EntryRevision) bitwarden.Item {
+	item := bitwarden.Item{ID: bitwarden.NewID(), Name: e.Title}
+	if e.Notes != "" {
+		item.Notes = &e.Notes
+	}
+	if !e.Created.IsZero() {
+		item.CreationDate = e.Created.UTC().Format(bitwardenTime)
+	}
+	if !e.Modified.IsZero() {
+		item.RevisionDate = e.Modified.UTC().Format(bitwardenTime)
+	}
+
+	fields := e.Fields
+	switch {
+	case e.Username != "" || e.Password != "" || e.URL != "" || e.OTP != "":
+		item.Type = bitwarden.TypeLogin
+		item.Login = &bitwarden.Login{Username: e.Username, Password: e.Password, TOTP: e.OTP}
+		if e.URL != "" {
+			item.Login.URIs = append(item.Login.URIs, bitwarden.URI{URI: e.URL})
+		}
+		fields = nil
+		for _, f := range e.Fields {
+			if f.Type == models.FieldURL && bitwardenExtraURI.MatchString(f.Name) {
+				item.Login.URIs = append(item.Login.URIs, bitwarden.URI{URI: f.Value})
+			} else {
+				fields = append(fields, f)
+			}
+		}
+		item.PasswordHistory = bitwardenPasswordHistory(e.Password, revisions)
+	case bitwardenFieldsOf(e.Fields, bitwardenCardFields) != nil:
+		item.Type, item.Card, fields = bitwarden.TypeCard, bitwardenFieldsOf(e.Fields, bitwardenCardFields), nil
+	case bitwardenFieldsOf(e.Fields, bitwardenIdentityFields) != nil:
+		item.Type, item.Identity, fields = bitwarden.TypeIdentity, bitwardenFieldsOf(e.Fields, bitwardenIdentityFields), nil
+	case bitwardenFieldsOf(e.Fields, bitwardenSSHKeyFields) != nil:
+		item.Type, item.SSHKey, fields = bitwarden.TypeSSHKey, bitwardenFieldsOf(e.Fields, bitwardenSSHKeyFields), nil
+	default:
+		item.Type = bitwarden.TypeSecureNote
+		item.SecureNote = &bitwarden.SecureNote{}
+	}
+
+	for _, f := range fields {
+		typ := bitwarden.FieldText
+		if f.Type == models.FieldHidden {
+			typ = bitwarden.FieldHidden
+		}
+		item.Fields = append(item.Fields, bitwarden.Field{Name: f.Name, Value: f.Value, Type: typ})
+	}
+	return item
+}
+
+// bitwardenFieldsOf возвращает значения по ключам Bitwarden, если все поля записи есть в table, иначе nil
+func bitwardenFieldsOf(fields []models.CustomField, table []bitwardenField) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	out := map[string]string{}
+	for _, f := range fields {
+		found := false
+		for _, t := range table {
+			if f.Name == t.label {
+				out[t.key], found = f.Value, true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return out
+}
+
+// bitwardenPasswordHistory — прежние пароли из истории версий, от новых к старым;
+// версии, где пароль не менялся, пропускаются
+func bitwardenPasswordHistory(current string, revisions []models.EntryRevision) []bitwarden.PasswordHistory {
+	var out []bitwarden.PasswordHistory
+	newer := current
+	for _, rev := range revisions {
+		if rev.Entry.Password != newer && rev.Entry.Password != "" {
+			out = append(out, bitwarden.PasswordHistory{
+				LastUsedDate: rev.ChangedAt.UTC().Format(bitwardenTime),
+				Password:     rev.Entry.Password,
+			})
+		}
+		newer = rev.Entry.Password
+	}
+	return out
+}
@@ -0,0 +1,581 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// csvTarget — во что переносится колонка CSV при импорте
+type csvTarget int
+
+const (
+	csvSkip csvTarget = iota
+	csvTitle
+	csvUsername
+	csvPassword
+	csvURL
+	csvNotes
+	csvGroup
+	csvTags
+	csvOTP
+	csvCustom      // дополнительное текстовое поле с именем колонки
+	csvFields      // колонка Fields экспорта PassLedger (JSON)
+	csvAttachments // колонка Attachments экспорта PassLedger
+)
+
+// csvTargetLabels — подписи для диалога сопоставления, по порядку csvTarget.
+// Колонки Fields и Attachments понятны только собственному экспорту и в диалог не попадают.
+var csvTargetLabels = []string{"Не импортировать", "Название", "Логин", "Пароль", "URL", "Заметки", "Группа", "Теги", "TOTP", "Дополнительное поле"}
+
+// csvFormat — известный формат CSV: набор колонок, по которому он узнаётся, и куда они переносятся
+type csvFormat struct {
+	name     string
+	required []string                             // колонки в нижнем регистре
+	columns  map[string]csvTarget                 // не перечисленные колонки пропускаются
+	groupSep string                               // разделитель вложенных групп; пусто — группа без вложенности
+	fix      func(e *models.PasswordEntry) string // правит запись; непустой ответ — причина пропуска строки
+}
+
+// csvFormats проверяются по порядку: сначала форматы с самыми узнаваемыми колонками,
+// последним — собственный экспорт PassLedger, которому достаточно username, password и url
+var csvFormats = []csvFormat{
+	{
+		name:     "LastPass",
+		required: []string{"url", "username", "password", "extra", "name", "grouping"},
+		columns: map[string]csvTarget{"url": csvURL, "username": csvUsername, "password": csvPassword,
+			"totp": csvOTP, "extra": csvNotes, "name": csvTitle, "grouping": csvGroup},
+		groupSep: `\`,
+		fix: func(e *models.PasswordEntry) string {
+			if e.URL == "http://sn" {
+				e.URL = "" // так LastPass помечает защищённые заметки
+			}
+			return ""
+		},
+	},
+	{
+		name:     "1Password",
+		required: []string{"title", "username", "password", "otpauth"},
+		columns: map[string]csvTarget{"title": csvTitle, "url": csvURL, "username": csvUsername, "password": csvPassword,
+			"otpauth": csvOTP, "tags": csvTags, "notes": csvNotes},
+	},
+	{
+		name:     "Firefox",
+		required: []string{"username", "password", "httprealm"},
+		columns:  map[string]csvTarget{"url": csvURL, "hostname": csvURL, "username": csvUsername, "password": csvPassword},
+		fix: func(e *models.PasswordEntry) string {
+			if strings.HasPrefix(e.URL, "chrome://") {
+				return "служебная запись Firefox"
+			}
+			return ""
+		},
+	},
+	{
+		name:     "Chrome",
+		required: []string{"name", "url", "username", "password"},
+		columns: map[string]csvTarget{"name": csvTitle, "url": csvURL, "username": csvUsername, "password": csvPassword,
+			"note": csvNotes},
+	},
+	{
+		name:     "PassLedger",
+		required: []string{"username", "password", "url"},
+		columns: map[string]csvTarget{"title": csvTitle, "username": csvUsername, "password": csvPassword, "url": csvURL,
+			"notes": csvNotes, "group": csvGroup, "fields": csvFields, "attachments": csvAttachments, "tags": csvTags, "otp": csvOTP},
+		groupSep: db.GroupSeparator,
+	},
+}
+
+// csvGuesses — подсказки для диалога сопоставления: распространённые названия колонок
+var csvGuesses = map[string]csvTarget{
+	"title": csvTitle, "name": csvTitle, "account": csvTitle, "название": csvTitle,
+	"username": csvUsername, "user": csvUsername, "login": csvUsername, "login_username": csvUsername,
+	"email": csvUsername, "e-mail": csvUsername, "логин": csvUsername, "имя пользователя": csvUsername,
+	"password": csvPassword, "pass": csvPassword, "login_password": csvPassword, "пароль": csvPassword,
+	"url": csvURL, "uri": csvURL, "login_uri": csvURL, "website": csvURL, "site": csvURL, "hostname": csvURL,
+	"сайт": csvURL, "адрес": csvURL,
+	"notes": csvNotes, "note": csvNotes, "comment": csvNotes, "comments": csvNotes, "extra": csvNotes,
+	"заметки": csvNotes, "примечание": csvNotes, "комментарий": csvNotes,
+	"group": csvGroup, "folder": csvGroup, "grouping": csvGroup, "category": csvGroup, "группа": csvGroup, "папка": csvGroup,
+	"tags": csvTags, "теги": csvTags,
+	"otp": csvOTP, "totp": csvOTP, "otpauth": csvOTP, "login_totp": csvOTP,
+}
+
+// csvFile — прочитанный CSV: заголовки, строки и номера строк файла, с которых они начинаются
+type csvFile struct {
+	headers []string
+	records [][]string
+	lines   []int
+}
+
+// csvRow — строка файла, перенесённая в запись
+type csvRow struct {
+	line        int
+	entry       models.PasswordEntry
+	attachments string
+	duplicate   *models.PasswordEntry // совпавшая запись хранилища
+	action      importAction          // что сделать при совпадении
+}
+
+// csvReport — итог импорта: сколько записей добавлено и обновлено, какие строки пропущены или не импортированы
+type csvReport struct {
+	format   string
+	imported int
+	updated  int
+	skipped  []string
+	failed   []string
+}
+
+func (r *csvReport) skip(line int, reason string) {
+	r.skipped = append(r.skipped, fmt.Sprintf("Строка %d: %s", line, reason))
+}
+
+func (r *csvReport) fail(line int, reason string) {
+	r.failed = append(r.failed, fmt.Sprintf("Строка %d: %s", line, reason))
+}
+
+// readCSV читает CSV с заголовком; BOM в начале и разделитель «;» (так сохраняет Excel
+// с русской локалью) распознаются автоматически
+func readCSV(data []byte) (*csvFile, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	if first, _, _ := bytes.Cut(data, []byte("\n")); !bytes.Contains(first, []byte(",")) && bytes.Contains(first, []byte(";")) {
+		reader.Comma = ';'
+	}
+	file := &csvFile{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка чтения CSV файла, проверьте его на корректность: %v", err)
+		}
+		if file.headers == nil {
+			for i := range record {
+				record[i] = strings.TrimSpace(record[i])
+			}
+			file.headers = record
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		file.records = append(file.records, record)
+		file.lines = append(file.lines, line)
+	}
+	if len(file.records) == 0 {
+		return nil, fmt.Errorf("CSV файл должен содержать заголовки и хотя бы одну строку данных")
+	}
+	return file, nil
+}
+
+// header — имя колонки для диалога и дополнительных полей; у колонки без заголовка — её номер
+func (f *csvFile) header(i int) string {
+	if f.headers[i] == "" {
+		return fmt.Sprintf("Колонка %d", i+1)
+	}
+	return f.headers[i]
+}
+
+// detectCSVFormat узнаёт формат по заголовкам и возвращает сопоставление колонок; nil — формат неизвестен
+func detectCSVFormat(headers []string) (*csvFormat, []csvTarget) {
+	have := map[string]bool{}
+	for _, h := range headers {
+		have[strings.ToLower(h)] = true
+	}
+	for i := range csvFormats {
+		format := &csvFormats[i]
+		known := true
+		for _, r := range format.required {
+			if !have[r] {
+				known = false
+				break
+			}
+		}
+		if !known {
+			continue
+		}
+		mapping := make([]csvTarget, len(headers))
+		for j, h := range headers {
+			mapping[j] = format.columns[strings.ToLower(h)]
+		}
+		return format, mapping
+	}
+	return nil, nil
+}
+
+// guessCSVMapping угадывает назначение колонок по названиям; каждое поле записи достаётся
+// только первой подходящей колонке
+func guessCSVMapping(headers []string) []csvTarget {
+	mapping := make([]csvTarget, len(headers))
+	used := map[csvTarget]bool{}
+	for i, h := range headers {
+		target := csvGuesses[strings.ToLower(h)]
+		if target != csvSkip && !used[target] {
+			mapping[i], used[target] = target, true
+		}
+	}
+	return mapping
+}
+
+// checkCSVMapping проверяет сопоставление из диалога: поля записи, кроме дополнительных,
+// выбраны не больше одного раза, и хотя бы одна колонка переносится в запись
+func checkCSVMapping(mapping []csvTarget) error {
+	used := map[csvTarget]bool{}
+	for _, target := range mapping {
+		if target == csvSkip || target == csvCustom {
+			continue
+		}
+		if used[target] {
+			return fmt.Errorf("Поле «%s» выбрано для нескольких колонок", csvTargetLabels[target])
+		}
+		used[target] = true
+	}
+	if !used[csvTitle] && !used[csvUsername] && !used[csvPassword] && !used[csvURL] && !used[csvNotes] {
+		return fmt.Errorf("Выберите хотя бы одну колонку для названия, логина, пароля, URL или заметок")
+	}
+	return nil
+}
+
+// csvEntries переносит строки файла в записи по mapping; format — nil при ручном сопоставлении.
+// Пустые и служебные строки попадают в report.skipped, строки с ошибками — в report.failed.
+func csvEntries(file *csvFile, mapping []csvTarget, format *csvFormat, report *csvReport) []csvRow {
+	var rows []csvRow
+	for i, record := range file.records {
+		line := file.lines[i]
+		if len(record) < len(file.headers) || strings.TrimSpace(strings.Join(record[len(file.headers):], "")) != "" {
+			report.fail(line, fmt.Sprintf("колонок %d, а в заголовке %d", len(record), len(file.headers)))
+			continue
+		}
+
+		row := csvRow{line: line}
+		e := &row.entry
+		var err error
+		for j, target := range mapping {
+			value := strings.TrimSpace(record[j])
+			if value == "" {
+				continue
+			}
+			switch target {
+			case csvTitle:
+				e.Title = value
+			case csvUsername:
+				e.Username = value
+			case csvPassword:
+				e.Password = value
+			case csvURL:
+				e.URL = value
+			case csvNotes:
+				e.Notes = value
+			case csvGroup:
+				e.Group = value
+			case csvTags:
+				e.Tags = db.ParseTags(value)
+			case csvOTP:
+				e.OTP = value
+			case csvCustom:
+				e.Fields = append(e.Fields, models.CustomField{Name: file.header(j), Value: value, Type: models.FieldText})
+			case csvFields:
+				var fields []models.CustomField
+				if fields, err = decodeCSVFields(value); err == nil {
+					e.Fields = append(fields, e.Fields...)
+				}
+			case csvAttachments:
+				row.attachments = value
+			}
+		}
+		if err != nil {
+			report.fail(line, err.Error())
+			continue
+		}
+		if format != nil && format.fix != nil {
+			if reason := format.fix(e); reason != "" {
+				report.skip(line, reason)
+				continue
+			}
+		}
+		if e.Title == "" && e.Username == "" && e.Password == "" && e.URL == "" && e.Notes == "" && len(e.Fields) == 0 {
+			report.skip(line, "нет ни названия, ни логина, ни пароля, ни URL, ни заметок")
+			continue
+		}
+		if e.OTP != "" {
+			// нераспознанный секрет сохраняем, но не как TOTP
+			if p, err := crypto.ParseOTP(e.OTP); err == nil {
+				crypto.Wipe(p.Secret)
+			} else {
+				e.Fields = append(e.Fields, models.CustomField{Name: "TOTP", Value: e.OTP, Type: models.FieldHidden})
+				e.OTP = ""
+			}
+		}
+		if e.Title == "" {
+			// Взять из URL без http
+			e.Title = extractTitleFromURL(e.URL)
+		}
+		if e.Title == "" {
+			e.Title = e.Username
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// prepareCSV переносит строки файла в записи и ищет среди записей хранилища их дубли
+func prepareCSV(database *sql.DB, keys *crypto.VaultKeys, file *csvFile, format *csvFormat, mapping []csvTarget) ([]csvRow, *csvReport, error) {
+	report := &csvReport{}
+	if format != nil {
+		report.format = format.name
+	}
+	rows := csvEntries(file, mapping, format, report)
+	existing, err := db.LoadAllEntries(database, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	duplicates := newDuplicateIndex(existing)
+	for i := range rows {
+		rows[i].duplicate = duplicates.find(rows[i].entry)
+	}
+	return rows, report, nil
+}
+
+// importCSV сохраняет строки одной транзакцией с учётом действий, выбранных для дублей: при любой
+// ошибке база остаётся как была. groupSep — разделитель вложенных групп формата, baseDir — каталог
+// файла, от которого отсчитываются пути колонки Attachments.
+func importCSV(database *sql.DB, keys *crypto.VaultKeys, rows []csvRow, groupSep, baseDir string, report *csvReport) error {
+	im, err := db.BeginImport(database, keys)
+	if err != nil {
+		return err
+	}
+	defer im.Rollback()
+	groups, err := newImportGroups(im)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		e := row.entry
+		if row.duplicate != nil {
+			switch row.action {
+			case importSkip:
+				report.skip(row.line, fmt.Sprintf("совпадает с записью «%s»", row.duplicate.Title))
+				continue
+			case importUpdatePassword:
+				updated := *row.duplicate
+				updated.Password = e.Password
+				if err := im.UpdateEntry(updated); err != nil {
+					return fmt.Errorf("строка %d: %w", row.line, err)
+				}
+				report.updated++
+				continue
+			}
+		}
+		if e.Group != "" {
+			if e.Group, err = groups.addPath(e.Group, groupSep); err != nil {
+				return fmt.Errorf("строка %d: группа '%s': %w", row.line, row.entry.Group, err)
+			}
+		}
+
+		var id int
+		if row.duplicate != nil && row.action == importOverwrite {
+			e.ID, id = row.duplicate.ID, row.duplicate.ID
+			err = im.UpdateEntry(e)
+			report.updated++
+		} else {
+			id, err = im.SaveEntry(e)
+			report.imported++
+		}
+		if err != nil {
+			return fmt.Errorf("строка %d: %w", row.line, err)
+		}
+		if row.attachments != "" {
+			if err := importEntryAttachments(im, id, baseDir, row.attachments); err != nil {
+				return fmt.Errorf("строка %d: %w", row.line, err)
+			}
+		}
+	}
+	return im.Commit()
+}
+
+// showCSVPreview показывает строки перед импортом. Строки, совпавшие с записью хранилища по хосту
+// URL и логину, помечены; для каждой выбирается действие, по умолчанию — пропустить.
+func showCSVPreview(win fyne.Window, rows []csvRow, report *csvReport, onOK func()) {
+	conflicts := 0
+	for _, row := range rows {
+		if row.duplicate != nil {
+			conflicts++
+		}
+	}
+	summary := fmt.Sprintf("Строк к импорту: %d, из них совпадают с записями хранилища: %d", len(rows), conflicts)
+	if report.format != "" {
+		summary = "Формат: " + report.format + ". " + summary
+	}
+	if n := len(report.skipped) + len(report.failed); n > 0 {
+		summary += fmt.Sprintf("\nЕщё %d строк пропущено или с ошибками, подробности — после импорта", n)
+	}
+
+	actionIndex := func(label string) importAction {
+		for a, l := range importActionLabels {
+			if l == label {
+				return importAction(a)
+			}
+		}
+		return importSkip
+	}
+
+	var list *widget.List
+	list = widget.NewList(
+		func() int { return len(rows) },
+		func() fyne.CanvasObject {
+			cell := func() fyne.CanvasObject {
+				label := widget.NewLabel("")
+				label.Truncation = fyne.TextTruncateEllipsis
+				return label
+			}
+			action := widget.NewSelect(importActionLabels, nil)
+			return container.NewGridWithColumns(5, cell(), cell(), cell(), cell(),
+				container.NewStack(widget.NewLabel("Новая запись"), action))
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			cells := o.(*fyne.Container).Objects
+			row := rows[i]
+			cells[0].(*widget.Label).SetText(fmt.Sprintf("%d. %s", row.line, row.entry.Title))
+			cells[1].(*widget.Label).SetText(row.entry.Username)
+			cells[2].(*widget.Label).SetText(row.entry.URL)
+			stack := cells[4].(*fyne.Container).Objects
+			newLabel, action := stack[0].(*widget.Label), stack[1].(*widget.Select)
+			action.OnChanged = nil
+			if row.duplicate == nil {
+				cells[3].(*widget.Label).SetText("")
+				newLabel.Show()
+				action.Hide()
+				return
+			}
+			cells[3].(*widget.Label).SetText("⚠ " + row.duplicate.Title)
+			newLabel.Hide()
+			action.Show()
+			action.SetSelected(importActionLabels[row.action])
+			action.OnChanged = func(label string) {
+				rows[i].action = actionIndex(label)
+			}
+		},
+	)
+
+	header := container.NewGridWithColumns(5,
+		widget.NewLabelWithStyle("Название", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Логин", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("URL", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Совпадает с", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Действие", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+	)
+	top := container.NewVBox(widget.NewLabel(summary))
+	if conflicts > 0 {
+		all := widget.NewSelect(importActionLabels, func(label string) {
+			for i := range rows {
+				rows[i].action = actionIndex(label)
+			}
+			list.Refresh()
+		})
+		all.PlaceHolder = "Выберите"
+		top.Add(container.NewHBox(widget.NewLabel("Для всех совпадений:"), all))
+	}
+	top.Add(header)
+
+	dlg := dialog.NewCustomConfirm("Импорт CSV", "Импортировать", models.CANCEL, container.NewBorder(top, nil, nil, nil, list), func(ok bool) {
+		if ok {
+			onOK()
+		}
+	}, win)
+	dlg.Resize(fyne.NewSize(900, 550))
+	dlg.Show()
+}
+
+// showCSVMappingDialog предлагает сопоставить колонки неизвестного CSV с полями записи.
+// Начальный выбор угадывается по названиям колонок; рядом показано значение из первой строки.
+func showCSVMappingDialog(win fyne.Window, file *csvFile, onOK func(mapping []csvTarget)) {
+	mapping := guessCSVMapping(file.headers)
+	form := widget.NewForm()
+	for i := range file.headers {
+		i := i
+		sample := widget.NewLabel("")
+		showSample := func() {
+			value := ""
+			if i < len(file.records[0]) {
+				value = strings.TrimSpace(file.records[0][i])
+			}
+			if mapping[i] == csvPassword && value != "" {
+				value = "••••••"
+			} else if len([]rune(value)) > 30 {
+				value = string([]rune(value)[:30]) + "…"
+			}
+			sample.SetText(value)
+		}
+		targetSelect := widget.NewSelect(csvTargetLabels, func(label string) {
+			for t, l := range csvTargetLabels {
+				if l == label {
+					mapping[i] = csvTarget(t)
+				}
+			}
+			showSample()
+		})
+		targetSelect.SetSelected(csvTargetLabels[mapping[i]])
+		form.Append(file.header(i), container.NewGridWithColumns(2, targetSelect, sample))
+	}
+
+	hint := widget.NewLabel("Формат файла не распознан. Укажите, куда переносить каждую колонку; справа — значение из первой строки.")
+	hint.Wrapping = fyne.TextWrapWord
+	content := container.NewBorder(hint, nil, nil, nil, container.NewVScroll(form))
+	dlg := dialog.NewCustomConfirm("Импорт CSV", "Импортировать", models.CANCEL, content, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := checkCSVMapping(mapping); err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		onOK(mapping)
+	}, win)
+	dlg.Resize(fyne.NewSize(650, 500))
+	dlg.Show()
+}
+
+// showCSVReport показывает итог импорта со списком пропущенных и не импортированных строк
+func showCSVReport(win fyne.Window, report *csvReport) {
+	summary := fmt.Sprintf("Добавлено: %d\nОбновлено: %d\nПропущено: %d\nС ошибками: %d",
+		report.imported, report.updated, len(report.skipped), len(report.failed))
+	if report.format != "" {
+		summary = "Формат: " + report.format + "\n" + summary
+	}
+	if len(report.skipped) == 0 && len(report.failed) == 0 {
+		dialog.ShowInformation("Импорт", summary, win)
+		return
+	}
+
+	var details []string
+	if len(report.failed) > 0 {
+		details = append(details, "Ошибки:")
+		details = append(details, report.failed...)
+	}
+	if len(report.skipped) > 0 {
+		if len(details) > 0 {
+			details = append(details, "")
+		}
+		details = append(details, "Пропущены:")
+		details = append(details, report.skipped...)
+	}
+	list := widget.NewLabel(strings.Join(details, "\n"))
+	list.Wrapping = fyne.TextWrapWord
+	content := container.NewBorder(widget.NewLabel(summary), nil, nil, nil, container.NewVScroll(list))
+	dlg := dialog.NewCustom("Импорт", "OK", content, win)
+	dlg.Resize(fyne.NewSize(600, 450))
+	dlg.Show()
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// customFieldDateLayout — формат значения поля типа «Дата»
+const customFieldDateLayout = "02.01.2006"
+
+// customFieldTypes — типы дополнительных полей в порядке выпадающего списка
+var customFieldTypes = []struct {
+	typ   models.CustomFieldType
+	label string
+}{
+	{models.FieldText, "Текст"},
+	{models.FieldHidden, "Скрытое"},
+	{models.FieldURL, "Ссылка"},
+	{models.FieldDate, "Дата"},
+}
+
+func customFieldTypeLabel(t models.CustomFieldType) string {
+	for _, ft := range customFieldTypes {
+		if ft.typ == t {
+			return ft.label
+		}
+	}
+	return customFieldTypes[0].label
+}
+
+func customFieldTypeByLabel(label string) models.CustomFieldType {
+	for _, ft := range customFieldTypes {
+		if ft.label == label {
+			return ft.typ
+		}
+	}
+	return models.FieldText
+}
+
+// validateCustomField проверяет имя и, для дат, формат значения
+func validateCustomField(f models.CustomField) error {
+	if strings.TrimSpace(f.Name) == "" {
+		return fmt.Errorf("у дополнительного поля не указано имя")
+	}
+	if f.Type == models.FieldDate && f.Value != "" {
+		if _, err := time.Parse(customFieldDateLayout, f.Value); err != nil {
+			return fmt.Errorf("поле «%s»: дата должна быть в формате ДД.ММ.ГГГГ", f.Name)
+		}
+	}
+	return nil
+}
+
+// customFieldRow — строка редактора дополнительных полей
+type customFieldRow struct {
+	name  *widget.Entry
+	typ   *widget.Select
+	value *widget.Entry
+}
+
+// newCustomFieldsEditor возвращает редактор упорядоченного списка дополнительных полей
+// и функцию, которая собирает и проверяет введённые поля. Строки без имени и значения пропускаются.
+func newCustomFieldsEditor(fields []models.CustomField) (fyne.CanvasObject, func() ([]models.CustomField, error)) {
+	var rows []*customFieldRow
+	box := container.NewVBox()
+
+	labels := make([]string, len(customFieldTypes))
+	for i, ft := range customFieldTypes {
+		labels[i] = ft.label
+	}
+
+	var rebuild func()
+	newRow := func(f models.CustomField) *customFieldRow {
+		r := &customFieldRow{name: widget.NewEntry(), value: widget.NewEntry()}
+		r.name.SetPlaceHolder("Имя")
+		r.name.SetText(f.Name)
+		r.value.SetPlaceHolder("Значение")
+		r.value.SetText(f.Value)
+		r.typ = widget.NewSelect(labels, func(label string) {
+			t := customFieldTypeByLabel(label)
+			r.value.Password = t == models.FieldHidden
+			if t == models.FieldDate {
+				r.value.SetPlaceHolder("ДД.ММ.ГГГГ")
+			} else {
+				r.value.SetPlaceHolder("Значение")
+			}
+			r.value.Refresh()
+		})
+		r.typ.SetSelected(customFieldTypeLabel(f.Type))
+		return r
+	}
+	rebuild = func() {
+		box.Objects = nil
+		for i, r := range rows {
+			upBtn := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+				rows[i-1], rows[i] = rows[i], rows[i-1]
+				rebuild()
+			})
+			if i == 0 {
+				upBtn.Disable()
+			}
+			delBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+				rows = append(rows[:i], rows[i+1:]...)
+				rebuild()
+			})
+			left := container.NewGridWrap(fyne.NewSize(130, r.name.MinSize().Height), r.name)
+			typ := container.NewGridWrap(fyne.NewSize(110, r.typ.MinSize().Height), r.typ)
+			box.Add(container.NewBorder(nil, nil, container.NewHBox(left, typ), container.NewHBox(upBtn, delBtn), r.value))
+		}
+		box.Add(widget.NewButtonWithIcon("Добавить поле", theme.ContentAddIcon(), func() {
+			rows = append(rows, newRow(models.CustomField{Type: models.FieldText}))
+			rebuild()
+		}))
+		box.Refresh()
+	}
+
+	for _, f := range fields {
+		rows = append(rows, newRow(f))
+	}
+	rebuild()
+
+	collect := func() ([]models.CustomField, error) {
+		var out []models.CustomField
+		for _, r := range rows {
+			f := models.CustomField{
+				Name:  strings.TrimSpace(r.name.Text),
+				Value: r.value.Text,
+				Type:  customFieldTypeByLabel(r.typ.Selected),
+			}
+			if f.Name == "" && f.Value == "" {
+				continue
+			}
+			if f.Type == models.FieldDate {
+				f.Value = strings.TrimSpace(f.Value)
+			}
+			if err := validateCustomField(f); err != nil {
+				return nil, err
+			}
+			out = append(out, f)
+		}
+		return out, nil
+	}
+	return box, collect
+}
+
+// formatCustomFields описывает дополнительные поля в markdown для панели деталей
+func formatCustomFields(fields []models.CustomField, hide bool) string {
+	var sb strings.Builder
+	for _, f := range fields {
+		value := f.Value
+		if hide && f.Type == models.FieldHidden {
+			value = maskPassword(value)
+		}
+		fmt.Fprintf(&sb, "\n**%s:** %s", f.Name, value)
+	}
+	return sb.String()
+}
+
+// customFieldsMatch ищет q (в нижнем регистре) в именах и значениях полей;
+// значения скрытых полей в поиске не участвуют, как и пароль
+func customFieldsMatch(fields []models.CustomField, q string) bool {
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f.Name), q) {
+			return true
+		}
+		if f.Type != models.FieldHidden && strings.Contains(strings.ToLower(f.Value), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// customFieldCopyButtons — кнопки копирования дополнительных полей для панели деталей
+func customFieldCopyButtons(fields []models.CustomField, onCopy func(f models.CustomField)) []fyne.CanvasObject {
+	var out []fyne.CanvasObject
+	for _, f := range fields {
+		if f.Value == "" {
+			continue
+		}
+		out = append(out, widget.NewButtonWithIcon(f.Name, theme.ContentCopyIcon(), func() { onCopy(f) }))
+	}
+	return out
+}
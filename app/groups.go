@@ -0,0 +1,147 @@
+package app
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// служебные узлы дерева групп; id групп — числа, поэтому с ними не пересекаются
+const (
+	treeAllUID   = "all"
+	treeTrashUID = "trash"
+	treeAddUID   = "add"
+)
+
+// topLevelGroup — пункт выбора родителя, означающий верхний уровень
+const topLevelGroup = "— верхний уровень —"
+
+// groupTree — группы, разложенные по родителям, для дерева в боковой панели
+type groupTree struct {
+	byID     map[int]models.Groups
+	children map[int][]int // id родителя -> id подгрупп; 0 — верхний уровень
+}
+
+// loadGroupTree грузит свежие группы из DB
+func loadGroupTree(database *sql.DB, keys *crypto.VaultKeys) groupTree {
+	t := groupTree{byID: map[int]models.Groups{}, children: map[int][]int{}}
+	groups, err := db.GetGroup(database, keys)
+	if err != nil {
+		return t
+	}
+	for _, g := range groups {
+		t.byID[g.Id] = g
+	}
+	for _, g := range groups {
+		parent := g.ParentId
+		if _, ok := t.byID[parent]; !ok {
+			parent = 0
+		}
+		t.children[parent] = append(t.children[parent], g.Id)
+	}
+	return t
+}
+
+// byPath ищет группу по пути
+func (t groupTree) byPath(path string) (models.Groups, bool) {
+	for _, g := range t.byID {
+		if g.Path == path {
+			return g, true
+		}
+	}
+	return models.Groups{}, false
+}
+
+// subtree возвращает id группы и всех её потомков
+func (t groupTree) subtree(id int) []int {
+	out := []int{id}
+	for i := 0; i < len(out); i++ {
+		out = append(out, t.children[out[i]]...)
+	}
+	return out
+}
+
+// childUIDs — дочерние узлы дерева: у корня это «Все», корзина, группы верхнего уровня и «+ Добавить группу»
+func (t groupTree) childUIDs(uid widget.TreeNodeID) []widget.TreeNodeID {
+	var out []widget.TreeNodeID
+	parent := 0
+	if uid == "" {
+		out = append(out, treeAllUID, treeTrashUID)
+	} else {
+		parent, _ = strconv.Atoi(uid)
+	}
+	for _, id := range t.children[parent] {
+		out = append(out, strconv.Itoa(id))
+	}
+	if uid == "" {
+		out = append(out, treeAddUID)
+	}
+	return out
+}
+
+// isBranch — есть ли у узла подгруппы
+func (t groupTree) isBranch(uid widget.TreeNodeID) bool {
+	if uid == "" {
+		return true
+	}
+	id, err := strconv.Atoi(uid)
+	return err == nil && len(t.children[id]) > 0
+}
+
+// parentOptions — возможные родители группы id: верхний уровень и пути всех групп вне её поддерева
+// (id 0 — все группы)
+func (t groupTree) parentOptions(id int) []string {
+	exclude := map[int]bool{}
+	if id != 0 {
+		for _, sub := range t.subtree(id) {
+			exclude[sub] = true
+		}
+	}
+	var paths []string
+	for gid, g := range t.byID {
+		if !exclude[gid] {
+			paths = append(paths, g.Path)
+		}
+	}
+	sort.Strings(paths)
+	return append([]string{topLevelGroup}, paths...)
+}
+
+// showMoveGroup — диалог переноса группы вместе с подгруппами в другую группу или на верхний уровень
+func showMoveGroup(win fyne.Window, database *sql.DB, id int, groups groupTree, onChange func()) {
+	g := groups.byID[id]
+	parentSelect := widget.NewSelect(groups.parentOptions(id), nil)
+	parentSelect.SetSelected(topLevelGroup)
+	if parent, ok := groups.byID[g.ParentId]; ok {
+		parentSelect.SetSelected(parent.Path)
+	}
+	dialog.ShowCustomConfirm(
+		"Переместить группу «"+g.Path+"»",
+		models.SAVE,
+		models.CANCEL,
+		widget.NewForm(widget.NewFormItem("Родитель", parentSelect)),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			parentID := 0
+			if parent, ok := groups.byPath(parentSelect.Selected); ok {
+				parentID = parent.Id
+			}
+			if err := db.MoveGroup(database, id, parentID); err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			onChange()
+		},
+		win,
+	)
+}
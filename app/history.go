@@ -0,0 +1,142 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// showHistoryDialog показывает сохранённые версии записи: что изменилось в каждой
+// по сравнению со следующей и кнопку восстановления выбранной версии
+func showHistoryDialog(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, entry models.PasswordEntry, onRestore func()) {
+	revisions, err := db.ListRevisions(database, keys, entry.ID)
+	if err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+	if len(revisions) == 0 {
+		dialog.ShowInformation("История", "У записи нет сохранённых версий", win)
+		return
+	}
+
+	// изменения версии i — разница между ней и более новой версией (или текущей записью)
+	changes := make([][]models.FieldChange, len(revisions))
+	for i, rev := range revisions {
+		newer := entry
+		if i > 0 {
+			newer = revisions[i-1].Entry
+		}
+		changes[i] = db.DiffEntries(rev.Entry, newer)
+	}
+
+	detail := widget.NewRichText()
+	detail.Wrapping = fyne.TextWrapWord
+	selected := -1
+
+	list := widget.NewList(
+		func() int { return len(revisions) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			fields := make([]string, len(changes[i]))
+			for j, c := range changes[i] {
+				fields[j] = c.Field
+			}
+			o.(*widget.Label).SetText(revisions[i].ChangedAt.Format("02.01.2006 15:04") + " — " + strings.Join(fields, ", "))
+		},
+	)
+
+	var dlg dialog.Dialog
+	restoreBtn := widget.NewButtonWithIcon("Восстановить", theme.HistoryIcon(), func() {
+		if selected < 0 {
+			return
+		}
+		rev := revisions[selected]
+		dialog.ShowConfirm("Восстановление", "Вернуть записи версию от "+rev.ChangedAt.Format("02.01.2006 15:04")+"?\nТекущее содержимое сохранится в истории.", func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := db.RestoreRevision(database, keys, rev.ID); err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			dlg.Hide()
+			onRestore()
+		}, win)
+	})
+	restoreBtn.Disable()
+
+	list.OnSelected = func(i widget.ListItemID) {
+		selected = i
+		detail.ParseMarkdown(ShowEntry(revisions[i].Entry, true) + "\n\n" + formatChanges(changes[i]))
+		restoreBtn.Enable()
+	}
+
+	split := container.NewHSplit(list, container.NewVScroll(detail))
+	split.SetOffset(0.4)
+	content := container.NewBorder(nil, container.NewHBox(restoreBtn), nil, nil, split)
+
+	dlg = dialog.NewCustom("История: "+entry.Title, "Закрыть", content, win)
+	dlg.Resize(fyne.NewSize(750, 450))
+	dlg.Show()
+}
+
+// formatChanges описывает изменения версии; пароли не показываются
+func formatChanges(changes []models.FieldChange) string {
+	var sb strings.Builder
+	sb.WriteString("**Изменено в следующей версии:**\n\n")
+	for _, c := range changes {
+		if c.Hidden {
+			fmt.Fprintf(&sb, "- %s: изменён\n", c.Field)
+			continue
+		}
+		fmt.Fprintf(&sb, "- %s: «%s» → «%s»\n", c.Field, c.Old, c.New)
+	}
+	return sb.String()
+}
+
+// showHistorySettingsDialog настраивает, сколько версий записей хранить
+func showHistorySettingsDialog(win fyne.Window, database *sql.DB) {
+	current, err := db.GetHistoryRetention(database)
+	if err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+	revisionsEntry := widget.NewEntry()
+	revisionsEntry.SetText(strconv.Itoa(current.MaxRevisions))
+	daysEntry := widget.NewEntry()
+	daysEntry.SetText(strconv.Itoa(current.MaxDays))
+
+	form := widget.NewForm(
+		widget.NewFormItem("Версий на запись", revisionsEntry),
+		widget.NewFormItem("Хранить дней", daysEntry),
+		widget.NewFormItem("", widget.NewLabel("0 — без ограничения")),
+	)
+
+	dlg := dialog.NewCustomConfirm("История версий", models.SAVE, models.CANCEL, form, func(ok bool) {
+		if !ok {
+			return
+		}
+		revisions, err1 := strconv.Atoi(strings.TrimSpace(revisionsEntry.Text))
+		days, err2 := strconv.Atoi(strings.TrimSpace(daysEntry.Text))
+		if err1 != nil || err2 != nil {
+			dialog.ShowError(fmt.Errorf("введите целые числа"), win)
+			return
+		}
+		if err := db.SetHistoryRetention(database, models.HistoryRetention{MaxRevisions: revisions, MaxDays: days}); err != nil {
+			dialog.ShowError(err, win)
+		}
+	}, win)
+	dlg.Resize(fyne.NewSize(400, 0))
+	dlg.Show()
+}
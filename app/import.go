@@ -0,0 +1,142 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// importGroups создаёт группы при импорте из других менеджеров паролей. Группа, путь которой
+// уже есть в хранилище, используется как есть; одноимённые группы внутри одного родителя
+// импортируемого файла (KeePass такое допускает) получают суффикс « (2)», « (3)», ...
+type importGroups struct {
+	im       *db.Import
+	existing map[string]bool   // пути групп хранилища
+	used     map[string]bool   // пути, уже занятые группами файла
+	paths    map[string]string // путь в файле -> путь группы, созданной по addPath
+}
+
+func newImportGroups(im *db.Import) (*importGroups, error) {
+	groups, err := im.Groups()
+	if err != nil {
+		return nil, err
+	}
+	g := &importGroups{im: im, existing: map[string]bool{}, used: map[string]bool{}, paths: map[string]string{}}
+	for _, group := range groups {
+		g.existing[group.Path] = true
+	}
+	return g, nil
+}
+
+// add создаёт группу name внутри группы с путём parent (пустой parent — верхний уровень)
+// и возвращает путь, под которым она сохранена; fallback подставляется вместо пустого имени
+func (g *importGroups) add(name, parent, fallback string) (string, error) {
+	base := db.CleanGroupName(name)
+	if base == "" {
+		base = fallback
+	}
+	name = base
+	path := db.JoinGroupPath(parent, name)
+	for i := 2; g.used[path]; i++ {
+		name = fmt.Sprintf("%s (%d)", base, i)
+		path = db.JoinGroupPath(parent, name)
+	}
+	g.used[path] = true
+	if g.existing[path] {
+		return path, nil
+	}
+	return path, g.im.AddGroup(name, parent)
+}
+
+// addPath создаёт цепочку вложенных групп по пути вида «Работа/Проект» (sep — разделитель
+// уровней; пустой sep — весь путь одно имя) и возвращает путь последней; пустой путь — без группы.
+// Один и тот же путь в рамках импорта всегда даёт одну и ту же группу.
+func (g *importGroups) addPath(path, sep string) (string, error) {
+	levels := []string{path}
+	if sep != "" {
+		levels = strings.Split(path, sep)
+	}
+	var parts []string
+	for _, part := range levels {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	parent := ""
+	for i := range parts {
+		key := strings.Join(parts[:i+1], "\x00")
+		created, ok := g.paths[key]
+		if !ok {
+			var err error
+			if created, err = g.add(parts[i], parent, ""); err != nil {
+				return "", err
+			}
+			g.paths[key] = created
+		}
+		parent = created
+	}
+	return parent, nil
+}
+
+// importAction — что сделать со строкой импорта, которая совпала с записью хранилища
+type importAction int
+
+const (
+	importSkip           importAction = iota
+	importOverwrite                   // заменить запись импортированной, прежняя версия уйдёт в историю
+	importKeepBoth                    // сохранить импортированную как новую запись
+	importUpdatePassword              // взять из импорта только пароль
+)
+
+// importActionLabels — подписи действий, по порядку importAction
+var importActionLabels = []string{"Пропустить", "Заменить", "Оставить обе", "Обновить пароль"}
+
+// duplicateIndex ищет среди записей хранилища дубль импортируемой записи:
+// тот же хост URL (без «www.») и тот же логин без учёта регистра
+type duplicateIndex map[string]*models.PasswordEntry
+
+func newDuplicateIndex(entries []models.PasswordEntry) duplicateIndex {
+	index := duplicateIndex{}
+	for i := range entries {
+		if key := duplicateKey(entries[i]); key != "" && index[key] == nil {
+			index[key] = &entries[i]
+		}
+	}
+	return index
+}
+
+// find возвращает запись хранилища, совпавшую с e, или nil
+func (d duplicateIndex) find(e models.PasswordEntry) *models.PasswordEntry {
+	if key := duplicateKey(e); key != "" {
+		return d[key]
+	}
+	return nil
+}
+
+// duplicateKey — ключ поиска дублей; у записи без URL ключа нет, иначе все заметки совпали бы друг с другом
+func duplicateKey(e models.PasswordEntry) string {
+	host := urlHost(e.URL)
+	if host == "" {
+		return ""
+	}
+	return host + "\x00" + strings.ToLower(strings.TrimSpace(e.Username))
+}
+
+// urlHost — хост адреса в нижнем регистре без «www.»; адрес без схемы считается https
+func urlHost(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,390 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/kdbx"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// Поля секрета TOTP: KeePassXC хранит otpauth:// URI в поле otp, KeePass 2.47+ —
+// секрет и параметры в полях TimeOtp-*
+const (
+	kdbxOTPField       = "otp"
+	kdbxOTPBase32Field = "TimeOtp-Secret-Base32"
+	kdbxOTPHexField    = "TimeOtp-Secret-Hex"
+	kdbxOTPBase64Field = "TimeOtp-Secret-Base64"
+	kdbxOTPTextField   = "TimeOtp-Secret"
+	kdbxOTPLength      = "TimeOtp-Length"
+	kdbxOTPPeriod      = "TimeOtp-Period"
+	kdbxOTPAlgorithm   = "TimeOtp-Algorithm"
+)
+
+// showKDBXCredentialsDialog спрашивает пароль и ключевой файл базы KeePass;
+// при экспорте пароль нужно повторить
+func showKDBXCredentialsDialog(win fyne.Window, title string, export bool, onOK func(password string, keyfile []byte)) {
+	passwordEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+	keyfileEntry, keyfileSelector := newKeyfileSelector(win, export)
+	items := []*widget.FormItem{widget.NewFormItem("Пароль", passwordEntry)}
+	if export {
+		items = append(items, widget.NewFormItem("Повтор", confirmEntry))
+	}
+	items = append(items, widget.NewFormItem("Ключевой файл", keyfileSelector))
+
+	dlg := dialog.NewCustomConfirm(title, "OK", models.CANCEL, widget.NewForm(items...), func(ok bool) {
+		if !ok {
+			return
+		}
+		if export && passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("Пароли не совпадают"), win)
+			return
+		}
+		keyfile, err := readKeyfile(keyfileEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		defer crypto.Wipe(keyfile)
+		onOK(passwordEntry.Text, keyfile)
+	}, win)
+	dlg.Resize(fyne.NewSize(500, 0))
+	dlg.Show()
+}
+
+// showKDBXExportPopup сохраняет все записи с группами, историей и вложениями в файл KeePass
+func showKDBXExportPopup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys) {
+	showKDBXCredentialsDialog(win, "Экспорт в KeePass", true, func(password string, keyfile []byte) {
+		file, err := exportKDBX(database, keys)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		keyfile = append([]byte(nil), keyfile...) // диалог выбора файла асинхронный, а исходный буфер затрут
+		fd := dialog.NewFileSave(func(uc fyne.URIWriteCloser, e error) {
+			defer crypto.Wipe(keyfile)
+			if uc == nil {
+				return
+			}
+			defer uc.Close()
+			if err := kdbx.Encode(uc, file, password, keyfile); err != nil {
+				dialog.ShowError(fmt.Errorf("Ошибка экспорта в KeePass: %v", err), win)
+				return
+			}
+			dialog.ShowInformation("Экспорт", "База KeePass сохранена", win)
+		}, win)
+		fd.SetFileName("PassLedger.kdbx")
+		fd.SetFilter(storage.NewExtensionFileFilter([]string{".kdbx"}))
+		fd.Resize(fyne.NewSize(800, 600))
+		fd.Show()
+	})
+}
+
+// showKDBXImportPopup переносит записи из файла KeePass; группы KeePass становятся группами PassLedger
+func showKDBXImportPopup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, onImport func()) {
+	fd := dialog.NewFileOpen(func(uc fyne.URIReadCloser, e error) {
+		if uc == nil {
+			return
+		}
+		data, err := io.ReadAll(uc)
+		uc.Close()
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		showKDBXCredentialsDialog(win, "Импорт из KeePass", false, func(password string, keyfile []byte) {
+			file, err := kdbx.Decode(bytes.NewReader(data), password, keyfile)
+			if err != nil {
+				dialog.ShowError(err, win)
+				return
+			}
+			imported, err := importKDBX(database, keys, file)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("Импорт отменён, база не изменена: %v", err), win)
+				return
+			}
+			if onImport != nil {
+				onImport()
+			}
+			dialog.ShowInformation("Импорт", fmt.Sprintf("Успешно импортировано %d записей", imported), win)
+		})
+	}, win)
+	fd.SetFilter(storage.NewExtensionFileFilter([]string{".kdbx"}))
+	fd.Resize(fyne.NewSize(800, 600))
+	fd.Show()
+}
+
+// importKDBX сохраняет записи файла KeePass одной транзакцией и возвращает их число. Записи
+// корневой группы попадают вне групп, подгруппы переносятся с сохранением вложенности.
+func importKDBX(database *sql.DB, keys *crypto.VaultKeys, file *kdbx.Database) (int, error) {
+	im, err := db.BeginImport(database, keys)
+	if err != nil {
+		return 0, err
+	}
+	defer im.Rollback()
+	groups, err := newImportGroups(im)
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	var walk func(g kdbx.Group, name string) error
+	walk = func(g kdbx.Group, name string) error {
+		for _, e := range g.Entries {
+			if err := importKDBXEntry(im, e, name); err != nil {
+				return fmt.Errorf("запись '%s': %w", e.Get(kdbx.FieldTitle), err)
+			}
+			imported++
+		}
+		for _, sub := range g.Groups {
+			subName, err := groups.add(sub.Name, name, "KeePass")
+			if err != nil {
+				return err
+			}
+			if err := walk(sub, subName); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(file.Root, ""); err != nil {
+		return 0, err
+	}
+	return imported, im.Commit()
+}
+
+// importKDBXEntry сохраняет запись с вложениями и историей версий
+func importKDBXEntry(im *db.Import, e kdbx.Entry, group string) error {
+	id, err := im.SaveEntry(entryFromKDBX(e, group))
+	if err != nil {
+		return err
+	}
+	for _, b := range e.Binaries {
+		if err := im.AddAttachment(id, b.Name, bytes.NewReader(b.Data)); err != nil {
+			return fmt.Errorf("вложение '%s': %w", b.Name, err)
+		}
+	}
+	// версия действовала до появления следующей, последняя — до текущего состояния записи
+	var revisions []models.EntryRevision
+	for i, h := range e.History {
+		changedAt := e.Modified
+		if i+1 < len(e.History) {
+			changedAt = e.History[i+1].Modified
+		}
+		if changedAt.IsZero() {
+			changedAt = time.Now()
+		}
+		revisions = append(revisions, models.EntryRevision{ChangedAt: changedAt, Entry: entryFromKDBX(h, group)})
+	}
+	if len(revisions) == 0 {
+		return nil
+	}
+	return im.AddRevisions(id, revisions)
+}
+
+// entryFromKDBX переводит запись KeePass в запись PassLedger: нестандартные строки становятся
+// дополнительными полями, защищённые — скрытыми
+func entryFromKDBX(e kdbx.Entry, group string) models.PasswordEntry {
+	out := models.PasswordEntry{
+		Title:    e.Get(kdbx.FieldTitle),
+		Username: e.Get(kdbx.FieldUserName),
+		Password: e.Get(kdbx.FieldPassword),
+		URL:      e.Get(kdbx.FieldURL),
+		Notes:    e.Get(kdbx.FieldNotes),
+		Group:    group,
+		Tags:     e.Tags,
+		OTP:      otpFromKDBX(e),
+	}
+	for _, s := range e.Strings {
+		if kdbx.IsStandardField(s.Key) || s.Key == kdbxOTPField || strings.HasPrefix(s.Key, "TimeOtp-") {
+			continue
+		}
+		typ := models.FieldText
+		if s.Protected {
+			typ = models.FieldHidden
+		}
+		out.Fields = append(out.Fields, models.CustomField{Name: s.Key, Value: s.Value, Type: typ})
+	}
+	return out
+}
+
+// otpFromKDBX собирает секрет TOTP из полей KeePassXC или KeePass
+func otpFromKDBX(e kdbx.Entry) string {
+	if otp := strings.TrimSpace(e.Get(kdbxOTPField)); otp != "" {
+		// старые KeePassXC писали «key=СЕКРЕТ&step=30&size=6»
+		if q, err := url.ParseQuery(otp); err == nil && !strings.Contains(otp, "://") && q.Get("key") != "" {
+			return otpURI(q.Get("key"), q.Get("step"), q.Get("size"), "")
+		}
+		return otp
+	}
+
+	var secret []byte
+	switch {
+	case e.Get(kdbxOTPBase32Field) != "":
+		return otpURI(e.Get(kdbxOTPBase32Field), e.Get(kdbxOTPPeriod), e.Get(kdbxOTPLength), e.Get(kdbxOTPAlgorithm))
+	case e.Get(kdbxOTPHexField) != "":
+		secret, _ = hex.DecodeString(strings.Join(strings.Fields(e.Get(kdbxOTPHexField)), ""))
+	case e.Get(kdbxOTPBase64Field) != "":
+		secret, _ = base64.StdEncoding.DecodeString(strings.TrimSpace(e.Get(kdbxOTPBase64Field)))
+	case e.Get(kdbxOTPTextField) != "":
+		secret = []byte(e.Get(kdbxOTPTextField))
+	}
+	if len(secret) == 0 {
+		return ""
+	}
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	return otpURI(encoded, e.Get(kdbxOTPPeriod), e.Get(kdbxOTPLength), e.Get(kdbxOTPAlgorithm))
+}
+
+// otpURI — секрет base32 как есть при параметрах по умолчанию, иначе otpauth:// URI
+func otpURI(secret, period, digits, algorithm string) string {
+	q := url.Values{}
+	if period != "" && period != "30" {
+		q.Set("period", period)
+	}
+	if digits != "" && digits != "6" {
+		q.Set("digits", digits)
+	}
+	// KeePass пишет алгоритм как HMAC-SHA-256
+	if algorithm = strings.ReplaceAll(strings.TrimPrefix(strings.ToUpper(algorithm), "HMAC-"), "-", ""); algorithm != "" && algorithm != "SHA1" {
+		q.Set("algorithm", algorithm)
+	}
+	secret = strings.ReplaceAll(strings.TrimSpace(secret), " ", "")
+	if len(q) == 0 {
+		return secret
+	}
+	q.Set("secret", secret)
+	return "otpauth://totp/?" + q.Encode()
+}
+
+// exportKDBX собирает все записи в базу KeePass; дерево групп сохраняется как есть
+func exportKDBX(database *sql.DB, keys *crypto.VaultKeys) (*kdbx.Database, error) {
+	entries, err := db.LoadAllEntries(database, keys)
+	if err != nil {
+		return nil, err
+	}
+	byGroup := map[string][]kdbx.Entry{}
+	for _, e := range entries {
+		ke, err := entryToKDBX(database, keys, e)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка экспорта записи '%s': %v", e.Title, err)
+		}
+		byGroup[e.Group] = append(byGroup[e.Group], ke)
+	}
+
+	groups := loadGroupTree(database, keys)
+	var build func(id int) kdbx.Group
+	build = func(id int) kdbx.Group {
+		g := kdbx.Group{Name: groups.byID[id].Name, Entries: byGroup[groups.byID[id].Path]}
+		for _, child := range groups.children[id] {
+			g.Groups = append(g.Groups, build(child))
+		}
+		return g
+	}
+	root := kdbx.Group{Name: "PassLedger", Entries: byGroup[""]}
+	for _, id := range groups.children[0] {
+		root.Groups = append(root.Groups, build(id))
+	}
+	return &kdbx.Database{Name: "PassLedger", Root: root}, nil
+}
+
+// entryToKDBX переводит запись вместе с вложениями и историей версий
+func entryToKDBX(database *sql.DB, keys *crypto.VaultKeys, e models.PasswordEntry) (kdbx.Entry, error) {
+	out := kdbxStrings(e)
+	attachments, err := db.ListAttachments(database, keys, e.ID)
+	if err != nil {
+		return out, err
+	}
+	for _, a := range attachments {
+		var buf bytes.Buffer
+		if err := db.WriteAttachment(database, keys, a.ID, &buf); err != nil {
+			return out, err
+		}
+		out.Binaries = append(out.Binaries, kdbx.Binary{Name: a.Name, Data: buf.Bytes()})
+	}
+
+	revisions, err := db.ListRevisions(database, keys, e.ID)
+	if err != nil {
+		return out, err
+	}
+	// в KeePass история идёт от старых версий к новым, а дата версии — когда её сохранили,
+	// т.е. когда была заменена предыдущая
+	for i := len(revisions) - 1; i >= 0; i-- {
+		h := kdbxStrings(revisions[i].Entry)
+		h.Created, h.Modified = e.Created, e.Created
+		if i+1 < len(revisions) {
+			h.Modified = revisions[i+1].ChangedAt
+		}
+		if h.Modified.IsZero() {
+			h.Modified = revisions[i].ChangedAt
+		}
+		out.History = append(out.History, h)
+	}
+	return out, nil
+}
+
+// kdbxStrings — строковые поля и теги записи в терминах KeePass
+func kdbxStrings(e models.PasswordEntry) kdbx.Entry {
+	out := kdbx.Entry{Tags: e.Tags, Created: e.Created, Modified: e.Modified}
+	out.Set(kdbx.FieldTitle, e.Title, false)
+	out.Set(kdbx.FieldUserName, e.Username, false)
+	out.Set(kdbx.FieldPassword, e.Password, true)
+	out.Set(kdbx.FieldURL, e.URL, false)
+	out.Set(kdbx.FieldNotes, e.Notes, false)
+	for _, f := range e.Fields {
+		// в KeePass имена полей уникальны и не совпадают со стандартными
+		name := f.Name
+		for i := 2; out.Has(name) || name == kdbxOTPField || strings.HasPrefix(name, "TimeOtp-"); i++ {
+			name = fmt.Sprintf("%s (%d)", f.Name, i)
+		}
+		out.Set(name, f.Value, f.Type == models.FieldHidden)
+	}
+	if e.OTP == "" {
+		return out
+	}
+
+	// otp читает KeePassXC, TimeOtp-* — KeePass; при импорте приоритет у otp
+	p, err := crypto.ParseOTP(e.OTP)
+	if err != nil {
+		out.Set(kdbxOTPField, e.OTP, true)
+		return out
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(p.Secret)
+	crypto.Wipe(p.Secret)
+	uri := e.OTP
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(uri)), "otpauth://") {
+		q := url.Values{"secret": {secret}}
+		if e.Title != "" {
+			q.Set("issuer", e.Title)
+		}
+		uri = "otpauth://totp/" + url.PathEscape(e.Title+":"+e.Username) + "?" + q.Encode()
+	}
+	out.Set(kdbxOTPField, uri, true)
+	out.Set(kdbxOTPBase32Field, secret, true)
+	if p.Digits != 6 {
+		out.Set(kdbxOTPLength, strconv.Itoa(p.Digits), false)
+	}
+	if p.Period != 30 {
+		out.Set(kdbxOTPPeriod, strconv.Itoa(p.Period), false)
+	}
+	if p.Algorithm != "SHA1" {
+		out.Set(kdbxOTPAlgorithm, "HMAC-"+strings.Replace(p.Algorithm, "SHA", "SHA-", 1), false)
+	}
+	return out
+}
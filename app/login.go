@@ -11,6 +11,8 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 
+	"github.com/reinbowARA/PassLedger/config"
+	"github.com/reinbowARA/PassLedger/crypto"
 	"github.com/reinbowARA/PassLedger/db"
 )
 
@@ -19,7 +21,7 @@ func ShowLoginWindow(a fyne.App) {
 	// Resize will be set later based on isFirstTime
 	win.CenterOnScreen()
 
-	settings, _ := LoadSettings()
+	settings, _ := config.Load()
 
 	var dbPath string = settings.DBPath
 	isFirstTime := false
@@ -34,7 +36,7 @@ func ShowLoginWindow(a fyne.App) {
 	confirmEntry.SetPlaceHolder("Повторите мастер-пароль")
 	confirmEntry.Hidden = !isFirstTime
 
-	warningLabel := widget.NewLabel("⚠️ Внимание! Мастер-пароль нельзя изменить после создания базы данных.\nЛучше запишите его на бумажку и храните в безопасном месте.")
+	warningLabel := widget.NewLabel("⚠️ Внимание! Забытый мастер-пароль восстановить невозможно (сменить его можно в меню «Инструменты»).\nЛучше запишите его на бумажку и храните в безопасном месте.")
 	warningLabel.Wrapping = fyne.TextWrapWord
 	warningLabel.Hidden = !isFirstTime
 
@@ -42,8 +44,6 @@ func ShowLoginWindow(a fyne.App) {
 	dbFolderLabel := widget.NewLabel("Выберите папку базы данных:")
 	dbFolderLabel.Hidden = !isFirstTime
 
-
-
 	dbFolderEntry := widget.NewEntry()
 	dbFolderEntry.SetPlaceHolder("Папка базы данных")
 	dbFolderEntry.SetText("data")
@@ -78,24 +78,28 @@ func ShowLoginWindow(a fyne.App) {
 	dbFileLabel := widget.NewLabel("Имя файла базы данных:")
 	dbFileLabel.Hidden = !isFirstTime
 
-
+	keyfileEntry, keyfileSelector := newKeyfileSelector(win, isFirstTime)
+	keyfileEntry.SetText(settings.KeyfilePath)
 
 	status := widget.NewLabel("")
 
 	var dbase *sql.DB
-	var key []byte
-	var err error
+	var keys *crypto.VaultKeys
 
 	var loginBtn *widget.Button = widget.NewButton("Войти", func() {
-		master := passwordEntry.Text
-		if master == "" {
+		if passwordEntry.Text == "" {
 			status.SetText("⚠️ Пароль не может быть пустым!")
 			return
 		}
+		keyfile, err := readKeyfile(keyfileEntry.Text)
+		if err != nil {
+			status.SetText("Ошибка: " + err.Error())
+			return
+		}
+		defer crypto.Wipe(keyfile)
 
 		if isFirstTime {
-			confirm := confirmEntry.Text
-			if confirm != master {
+			if confirmEntry.Text != passwordEntry.Text {
 				status.SetText("Пароли не совпадают!")
 				return
 			}
@@ -108,28 +112,37 @@ func ShowLoginWindow(a fyne.App) {
 				dbfile = "passwords.db"
 			}
 			dbPath = filepath.Join(dbfolder, dbfile)
-			dbase, key, err = db.CreateNewDatabase(dbPath, master)
+			master := []byte(passwordEntry.Text)
+			dbase, keys, err = db.CreateNewDatabase(dbPath, master, keyfile)
+			crypto.Wipe(master)
 			if err != nil {
 				status.SetText("Ошибка создания базы: " + err.Error())
 				return
 			}
 			// Save new dbPath to settings
 			settings.DBPath = dbPath
-			SaveSettings(settings)
-			entries, _ := db.LoadAllEntries(dbase, key)
-			ShowMainWindow(a, dbase, key, entries)
+			settings.KeyfilePath = keyfileEntry.Text
+			config.Save(settings)
+			entries, _ := db.LoadAllEntries(dbase, keys)
+			ShowMainWindow(a, dbase, keys, entries)
 			win.Close()
 			return
 		}
 
-		dbase, key, err = db.OpenAndAuthenticate(dbPath, master)
+		master := []byte(passwordEntry.Text)
+		dbase, keys, err = db.OpenAndAuthenticate(dbPath, master, keyfile)
+		crypto.Wipe(master)
 		if err != nil {
 			status.SetText("Ошибка: " + err.Error())
 			return
 		}
+		if settings.KeyfilePath != keyfileEntry.Text {
+			settings.KeyfilePath = keyfileEntry.Text
+			config.Save(settings)
+		}
 
-		entries, _ := db.LoadAllEntries(dbase, key)
-		ShowMainWindow(a, dbase, key, entries)
+		entries, _ := db.LoadAllEntries(dbase, keys)
+		ShowMainWindow(a, dbase, keys, entries)
 		win.Close()
 	})
 
@@ -137,6 +150,7 @@ func ShowLoginWindow(a fyne.App) {
 		widget.NewLabel("Введите мастер-пароль"),
 		passwordEntry,
 		confirmEntry,
+		keyfileSelector,
 		warningLabel,
 		dbFolderLabel,
 		container.NewHBox(browseFolderBtn, dbFolderEntryContainer),
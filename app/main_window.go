@@ -3,6 +3,8 @@ package app
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -12,17 +14,20 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"github.com/reinbowARA/PassLedger/config"
+	"github.com/reinbowARA/PassLedger/crypto"
 	"github.com/reinbowARA/PassLedger/db"
 	"github.com/reinbowARA/PassLedger/models"
 )
 
-func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.PasswordEntry) {
+func ShowMainWindow(a fyne.App, database *sql.DB, keys *crypto.VaultKeys, entries []models.PasswordEntry) {
 	win := a.NewWindow("Password Book")
 	win.Resize(fyne.NewSize(1000, 600))
 	win.CenterOnScreen()
 
-	groupsSlice := getUniqueGroupsFromDB(database, key)
-	var groupList *widget.List
+	groups := loadGroupTree(database, keys)
+	var groupList *widget.Tree
+	var tagSelect *widget.Select
 	var table *widget.Table
 	var popup *widget.PopUp
 	var overlay *widget.PopUp
@@ -33,23 +38,40 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 	currentFilters := models.SearchFilters{Title: true, Username: true, URL: true}
 	var selectedRow = -1
 	var settingsWindowOpen bool
+	var closeSettings func() // закрывает окно настроек без сохранения
+	var idle idleLock        // автоблокировка, запускается после загрузки настроек
+
+	// refreshTags обновляет список тегов в фильтре; если выбранного тега больше нет, фильтр сбрасывается
+	refreshTags := func() {
+		tagSelect.Options = tagOptions(database, keys)
+		for _, t := range tagSelect.Options {
+			if t == tagSelect.Selected {
+				tagSelect.Refresh()
+				return
+			}
+		}
+		tagSelect.SetSelected(allTags)
+	}
 
 	// === Toolbar ===
 
 	addBtn := widget.NewButtonWithIcon("Добавить", theme.ContentAddIcon(), func() {
-		showAddForm(win, database, key, func(filters models.SearchFilters) {
+		idle.touch()
+		showAddForm(win, database, keys, func(filters models.SearchFilters) {
 			currentFilters = filters
-			refreshListFiltered(database, key, &entries, win, currentGroup, searchText, currentFilters, detail)
-			groupsSlice = getUniqueGroupsFromDB(database, key)
+			refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+			groups = loadGroupTree(database, keys)
 			groupList.Refresh()
+			refreshTags()
 		})
 	})
 
 	searchEntry := widget.NewEntry()
 	searchEntry.SetPlaceHolder("Поиск...")
 	searchEntry.OnChanged = func(text string) {
+		idle.touch()
 		searchText = text
-		refreshListFiltered(database, key, &entries, win, currentGroup, searchText, currentFilters, detail)
+		refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
 	}
 	searchBox := container.New(
 		layout.NewGridWrapLayout(fyne.NewSize(250, 36)),
@@ -59,26 +81,65 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 	// Кнопка для настройки фильтров
 	filterBtn := widget.NewButtonWithIcon("Фильтры", theme.MenuIcon(), func() {
 		showFilterDialog(win, &currentFilters, func() {
-			refreshListFiltered(database, key, &entries, win, currentGroup, searchText, currentFilters, detail)
+			refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
 		})
 	})
 
-	selectedName := []string{"Инструменты", "Генератор пароля", "Экспорт", "Импорт"}
+	// Сортировка таблицы записей
+	sortNames := make([]string, len(entrySorts))
+	for i, s := range entrySorts {
+		sortNames[i] = s.name
+	}
+	sortSelect := widget.NewSelect(sortNames, nil)
+	sortSelect.SetSelectedIndex(selectedSort)
+	sortSelect.OnChanged = func(string) {
+		idle.touch()
+		selectedSort = sortSelect.SelectedIndex()
+		selectedRow = -1
+		refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+		table.Refresh()
+	}
+	sortContainer := container.New(
+		layout.NewGridWrapLayout(fyne.NewSize(190, 36)),
+		sortSelect)
+
+	selectedName := []string{"Инструменты", "Генератор пароля", "Экспорт", "Импорт", "Экспорт в KeePass", "Импорт из KeePass", "Экспорт в Bitwarden", "Импорт из Bitwarden", "Резервная копия", "Восстановить из копии", "Сменить мастер-пароль", "Параметры KDF", "История версий"}
 
 	// Выпадающий список инструментов
 	var toolsSelect *widget.Select
 	toolsSelect = widget.NewSelect(selectedName, func(value string) {
+		idle.touch()
+		onImport := func() {
+			refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+			groups = loadGroupTree(database, keys)
+			groupList.Refresh()
+			refreshTags()
+		}
 		switch value {
 		case selectedName[1]:
 			showPasswordGeneratorPopup(win)
 		case selectedName[2]:
-			showExportPopup(win, database, key)
+			showExportPopup(win, database, keys)
 		case selectedName[3]:
-			showImportPopup(win, database, key, func() {
-				refreshListFiltered(database, key, &entries, win, currentGroup, searchText, currentFilters, detail)
-				groupsSlice = getUniqueGroupsFromDB(database, key)
-				groupList.Refresh()
-			})
+			showImportPopup(win, database, keys, onImport)
+		case selectedName[4]:
+			showKDBXExportPopup(win, database, keys)
+		case selectedName[5]:
+			showKDBXImportPopup(win, database, keys, onImport)
+		case selectedName[6]:
+			showBitwardenExportPopup(win, database, keys)
+		case selectedName[7]:
+			showBitwardenImportPopup(win, database, keys, onImport)
+		case selectedName[8]:
+			showBackupPopup(win, database, keys)
+		case selectedName[9]:
+			showRestorePopup(win, database, keys, onImport)
+		case selectedName[10]:
+			showChangePasswordDialog(win, database)
+		case selectedName[11]:
+			showKDFDialog(win, database)
+		case selectedName[12]:
+			showHistorySettingsDialog(win, database)
 		}
 		if value != selectedName[0] {
 			toolsSelect.SetSelected(selectedName[0])
@@ -86,16 +147,17 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 	})
 	toolsSelect.SetSelected(selectedName[0])
 	toolSelectContainer := container.New(
-		layout.NewGridWrapLayout(fyne.NewSize(135, 36)),
+		layout.NewGridWrapLayout(fyne.NewSize(190, 36)),
 		toolsSelect)
 
-	settings, err := LoadSettings()
+	settings, err := config.Load()
 	if err != nil {
 		dialog.ShowError(err, win)
 		return
 	}
 
 	SettingsBtn := widget.NewButtonWithIcon("", theme.SettingsIcon(), func() {
+		idle.touch()
 		if settingsWindowOpen {
 			return
 		}
@@ -103,25 +165,27 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 		overlay = widget.NewModalPopUp(container.NewWithoutLayout(), win.Canvas())
 		overlay.Resize(fyne.NewSize(0, 0))
 		overlay.Show()
-		showSettingsForm(win, &settings, a, overlay, &settingsWindowOpen, func(newSettings models.Settings) {
+		closeSettings = showSettingsForm(win, &settings, a, overlay, &settingsWindowOpen, func(newSettings models.Settings) {
 			settings = newSettings
-			err := SaveSettings(settings)
+			err := config.Save(settings)
 			if err != nil {
 				dialog.ShowError(err, win)
 				return
 			}
+			idle.setTimeout(time.Duration(settings.LockMinutes) * time.Minute)
 			overlay.Hide()
 			settingsWindowOpen = false
 		})
 	})
 
 	exitBtn := widget.NewButtonWithIcon("Выйти", theme.LogoutIcon(), func() {
+		keys.Wipe()
 		a.Quit()
 	})
 	toolbar := container.NewHBox(
 		addBtn,
 		layout.NewSpacer(),
-		container.NewHBox(searchBox, filterBtn),
+		container.NewHBox(searchBox, filterBtn, sortContainer),
 		layout.NewSpacer(),
 		toolSelectContainer,
 		layout.NewSpacer(),
@@ -130,6 +194,8 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 	)
 
 	copyBtn := widget.NewButtonWithIcon("Скопировать пароль", theme.ContentCopyIcon(), nil)
+	historyBtn := widget.NewButtonWithIcon("История", theme.HistoryIcon(), nil)
+	attachBtn := widget.NewButtonWithIcon("Вложения", theme.FileIcon(), nil)
 	timerProgress := widget.NewProgressBar()
 	timerProgress.TextFormatter = func() string {
 		return ""
@@ -141,93 +207,159 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 	timerLabel := widget.NewLabel("")
 	timerLabel.Hide()
 	var cancel chan struct{}
+	fieldsBox := container.NewHBox() // кнопки копирования дополнительных полей выбранной записи
+
+	// copySecret копирует значение в буфер обмена и очищает его по таймеру
+	copySecret := func(value string) {
+		idle.touch()
+		if cancel != nil {
+			close(cancel)
+		}
+		cancel = make(chan struct{})
+		a.Clipboard().SetContent(value)
+		go runTimer(a, timerProgress, timerLabel, win, cancel, settings.TimerSeconds)
+	}
+	// код TOTP выбранной записи копируется так же, как пароль
+	otp := newOTPView(copySecret)
+
+	// === Теги ===
+
+	// фильтр по тегу под списком групп; работает вместе с выбранной группой
+	selectedTag = ""
+	tagSelect = widget.NewSelect(tagOptions(database, keys), nil)
+	tagSelect.SetSelected(allTags)
+	tagSelect.OnChanged = func(tag string) {
+		idle.touch()
+		if tag == allTags {
+			tag = ""
+		}
+		if tag == selectedTag {
+			return
+		}
+		selectedTag = tag
+		selectedRow = -1
+		refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+		table.Refresh()
+		detail.ParseMarkdown("")
+	}
 
 	// === Группы ===
 
-	groupList = widget.NewList(
-		func() int { return len(groupsSlice) + 1 }, // +1 для "+ Добавить группу"
-		func() fyne.CanvasObject {
-			// левая "кликабельная" часть — Button, справа — кнопки редактирования/удаления
+	// groups перечитывается после изменений, поэтому методы вызываются через замыкания
+	groupList = widget.NewTree(
+		func(uid widget.TreeNodeID) []widget.TreeNodeID { return groups.childUIDs(uid) },
+		func(uid widget.TreeNodeID) bool { return groups.isBranch(uid) },
+		func(branch bool) fyne.CanvasObject {
+			// левая "кликабельная" часть — Button, справа — кнопки редактирования/переноса/удаления
 			rowBtn := widget.NewButton("", nil)
+			rowBtn.Alignment = widget.ButtonAlignLeading
 			editBtn := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), nil)
+			moveBtn := widget.NewButtonWithIcon("", theme.MailForwardIcon(), nil)
 			delBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)
-			return container.NewBorder(nil, nil, nil, container.NewHBox(editBtn, delBtn), rowBtn)
+			return container.NewBorder(nil, nil, nil, container.NewHBox(editBtn, moveBtn, delBtn), rowBtn)
 		},
-		func(i widget.ListItemID, o fyne.CanvasObject) {
-			// формируем список: groupsSlice + последняя нода как "+ Добавить группу"
-			display := append(groupsSlice, "+ Добавить группу")
-			name := display[i]
-
-			// структура: Border( content=rowBtn, south=HBox(edit,del) )
+		func(uid widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			// структура: Border( content=rowBtn, right=HBox(edit,move,del) )
 			rowBtn := o.(*fyne.Container).Objects[0].(*widget.Button)
 			btns := o.(*fyne.Container).Objects[1].(*fyne.Container)
-			editBtn := btns.Objects[0].(*widget.Button)
-			delBtn := btns.Objects[1].(*widget.Button)
-
-			// Устанавливаем текст и поведение
-			rowBtn.SetText(name)
 
 			// Сценарии:
-			if name == "+ Добавить группу" {
+			switch uid {
+			case treeAddUID:
 				// Сделать видной кнопку как Add (без иконок справа)
-				editBtn.Hide()
-				delBtn.Hide()
+				btns.Hide()
+				rowBtn.SetText("+ Добавить группу")
+				rowBtn.SetIcon(nil)
 				rowBtn.Importance = widget.HighImportance
 				rowBtn.OnTapped = func() {
-					showAddGroup(win, database, key, &groupsSlice, groupList)
+					showAddGroup(win, database, keys, &groups, groupList, currentGroup)
 				}
+				rowBtn.Refresh()
+				return
+			case treeTrashUID:
+				// корзина — не группа: открывает диалог с удалёнными записями и группами
+				btns.Hide()
+				rowBtn.SetText(models.DefaultNameTrash)
+				rowBtn.SetIcon(theme.DeleteIcon())
+				rowBtn.Importance = widget.MediumImportance
+				rowBtn.OnTapped = func() {
+					idle.touch()
+					showTrashDialog(win, database, keys, func() {
+						selectedRow = -1
+						refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+						groups = loadGroupTree(database, keys)
+						groupList.Refresh()
+						refreshTags()
+						detail.ParseMarkdown("")
+					})
+				}
+				rowBtn.Refresh()
 				return
 			}
 
-			// Для группы models.DefaultNameAllGroups запрещаем редактировать/удалять
-			if name == models.DefaultNameAllGroups {
-				editBtn.Hide()
-				delBtn.Hide()
+			// Для пункта models.DefaultNameAllGroups запрещаем редактировать/удалять
+			name, path := models.DefaultNameAllGroups, models.DefaultNameAllGroups
+			if uid == treeAllUID {
+				btns.Hide()
 			} else {
-				editBtn.Show()
-				delBtn.Show()
-				editBtn.OnTapped = func() {
-					showRenameGroup(win, name, &entries, &groupsSlice, groupList, database, key, currentFilters, func() {
-						refreshListFiltered(database, key, &entries, win, models.DefaultNameAllGroups, "", currentFilters, detail)
+				id, _ := strconv.Atoi(uid)
+				name, path = groups.byID[id].Name, groups.byID[id].Path
+				btns.Show()
+				btns.Objects[0].(*widget.Button).OnTapped = func() {
+					showRenameGroup(win, id, &entries, &groups, groupList, database, keys, currentFilters, func() {
+						refreshListFiltered(database, keys, &entries, win, models.DefaultNameAllGroups, "", currentFilters, detail)
 					})
 				}
-				delBtn.OnTapped = func() {
-					dialog.ShowConfirm("Удаление группы", "Удалить группу '"+name+"' и все её записи?", func(ok bool) {
+				btns.Objects[1].(*widget.Button).OnTapped = func() {
+					idle.touch()
+					showMoveGroup(win, database, id, groups, func() {
+						groups = loadGroupTree(database, keys)
+						groupList.Refresh()
+						// выбранная группа могла переехать вместе с перенесённой
+						if db.InGroup(currentGroup, path) {
+							currentGroup = groups.byID[id].Path + currentGroup[len(path):]
+						}
+						refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+						table.Refresh()
+					})
+				}
+				btns.Objects[2].(*widget.Button).OnTapped = func() {
+					dialog.ShowConfirm("Удаление группы", "Переместить группу '"+path+"' со всеми подгруппами и записями в корзину?", func(ok bool) {
 						if ok {
-							var id int
-							id, err := db.DeleteEntriesInGroup(database, name)
+							err := db.DeleteGroup(database, id)
 							if err != nil {
 								dialog.ShowError(err, win)
 								return
 							}
-							err = db.DeleteGroup(database, id)
-							if err != nil {
-								dialog.ShowError(err, win)
-								return
-							}
-							groupsSlice = getUniqueGroupsFromDB(database, key)
+							groups = loadGroupTree(database, keys)
 							groupList.Refresh()
-							refreshListFiltered(database, key, &entries, win, models.DefaultNameAllGroups, "", currentFilters, detail)
+							refreshTags()
+							refreshListFiltered(database, keys, &entries, win, models.DefaultNameAllGroups, "", currentFilters, detail)
 						}
 					}, win)
 				}
 			}
-			// Нажатие на саму группу — фильтрация списка
+			rowBtn.SetText(name)
+			rowBtn.SetIcon(nil)
+			rowBtn.Importance = widget.MediumImportance
+			// Нажатие на саму группу — фильтрация списка (вместе с подгруппами)
 			rowBtn.OnTapped = func() {
+				idle.touch()
 				selectedRow = -1
-				currentGroup = name
-				refreshListFiltered(database, key, &entries, win, currentGroup, searchText, currentFilters, detail)
+				currentGroup = path
+				refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
 				table.Refresh()
 				win.Content().Refresh()
 				detail.ParseMarkdown("")
 			}
-
+			rowBtn.Refresh()
 		},
 	)
+	groupList.OpenAllBranches()
 
 	// === Учётки ===
 	table = widget.NewTableWithHeaders(
-		func() (int, int) { return len(entries), 5 }, // 5 колонок: Title, Username, URL, Group, Actions
+		func() (int, int) { return len(entries), 6 }, // 6 колонок: Title, Username, URL, Group, Modified, Actions
 		func() fyne.CanvasObject {
 			return widget.NewButton("", nil)
 		},
@@ -242,28 +374,59 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 			}
 			entry := entries[i.Row]
 			setOnTapped := func() {
+				idle.touch()
 				selectedRow = i.Row
 				table.Refresh()
 				var text string = ShowEntry(entry, true)
 				detail.ParseMarkdown(text)
 				copyBtn.OnTapped = func() {
-					if cancel != nil {
-						close(cancel)
+					copySecret(entry.Password)
+					if err := db.MarkEntryUsed(database, entry.ID); err == nil {
+						entry.LastUsed = time.Now()
+						for j := range entries {
+							if entries[j].ID == entry.ID {
+								entries[j].LastUsed = entry.LastUsed
+							}
+						}
+						detail.ParseMarkdown(ShowEntry(entry, true))
 					}
-					cancel = make(chan struct{})
-					a.Clipboard().SetContent(entry.Password)
-					go runTimer(a, timerProgress, timerLabel, win, cancel, settings.TimerSeconds)
+				}
+				// скрытые поля копируются как пароль, с очисткой буфера; остальные — как есть
+				fieldsBox.Objects = customFieldCopyButtons(entry.Fields, func(f models.CustomField) {
+					if f.Type == models.FieldHidden {
+						copySecret(f.Value)
+						return
+					}
+					idle.touch()
+					a.Clipboard().SetContent(f.Value)
+				})
+				fieldsBox.Refresh()
+				otp.show(entry.OTP)
+				attachBtn.OnTapped = func() {
+					idle.touch()
+					showAttachmentsDialog(win, database, keys, entry)
+				}
+				historyBtn.OnTapped = func() {
+					idle.touch()
+					showHistoryDialog(win, database, keys, entry, func() {
+						selectedRow = -1
+						refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+						groups = loadGroupTree(database, keys)
+						groupList.Refresh()
+						refreshTags()
+						detail.ParseMarkdown("")
+					})
 				}
 			}
 			// Установка выделения строки
 			if i.Row == selectedRow {
-				if i.Col < 4 {
+				if i.Col < 5 {
 					button.Importance = widget.WarningImportance // Выделение выбранной строки
 				} else {
 					button.Importance = widget.HighImportance
 				}
 			} else {
-				if i.Col < 4 {
+				if i.Col < 5 {
 					button.Importance = widget.LowImportance // Нормальный стиль
 				} else {
 					button.Importance = widget.HighImportance
@@ -287,27 +450,38 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 				button.SetText(entry.Group)
 				button.OnTapped = setOnTapped
 			case 4:
+				button.SetIcon(nil)
+				if entry.Modified.IsZero() {
+					button.SetText("")
+				} else {
+					button.SetText(entry.Modified.Format("02.01.2006"))
+				}
+				button.OnTapped = setOnTapped
+			case 5:
 				button.SetIcon(theme.SettingsIcon())
 				button.SetText("")
 				button.OnTapped = func() {
+					idle.touch()
 					selectedRow = i.Row
 					table.Refresh()
 					buttonEdit := widget.NewButton("Редактировать", func() {
-						showAddForm(win, database, key, func(filters models.SearchFilters) {
+						showAddForm(win, database, keys, func(filters models.SearchFilters) {
 							currentFilters = filters
-							refreshListFiltered(database, key, &entries, win, currentGroup, searchText, currentFilters, detail)
-							groupsSlice = getUniqueGroupsFromDB(database, key)
+							refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+							groups = loadGroupTree(database, keys)
 							groupList.Refresh()
+							refreshTags()
 							popup.Hide()
 						}, &entry)
 					})
 					buttonDelete := widget.NewButton("Удалить", func() {
-						dialog.ShowConfirm("Удаление", "Удалить запись?", func(ok bool) {
+						dialog.ShowConfirm("Удаление", "Переместить запись в корзину?", func(ok bool) {
 							if ok {
 								db.DeleteEntry(database, entry.ID)
-								refreshListFiltered(database, key, &entries, win, currentGroup, searchText, currentFilters, detail)
-								groupsSlice = getUniqueGroupsFromDB(database, key)
+								refreshListFiltered(database, keys, &entries, win, currentGroup, searchText, currentFilters, detail)
+								groups = loadGroupTree(database, keys)
 								groupList.Refresh()
+								refreshTags()
 								popup.Hide()
 							}
 						}, win)
@@ -341,6 +515,8 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 			case 3:
 				label.SetText(models.GROUP)
 			case 4:
+				label.SetText(models.MODIFIED)
+			case 5:
 				label.SetText("")
 			}
 		} else if id.Col < 0 {
@@ -352,7 +528,8 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 	table.SetColumnWidth(1, 150) // Username
 	table.SetColumnWidth(2, 175) // URL
 	table.SetColumnWidth(3, 100) // Group
-	table.SetColumnWidth(4, 50)  // Actions
+	table.SetColumnWidth(4, 100) // Modified
+	table.SetColumnWidth(5, 50)  // Actions
 
 	// === Панель деталей ====
 	copyBtn = widget.NewButtonWithIcon("Скопировать пароль", theme.ContentCopyIcon(), nil)
@@ -371,8 +548,12 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 		layout.NewVBoxLayout(),
 		container.NewPadded(detail),
 		layout.NewSpacer(),
+		container.NewPadded(otp.box),
+		container.NewPadded(fieldsBox),
 		container.NewHBox(
 			container.NewPadded(copyBtn),
+			container.NewPadded(historyBtn),
+			container.NewPadded(attachBtn),
 			container.NewPadded(timerLabel),
 			container.NewPadded(timerProgress),
 		),
@@ -381,10 +562,53 @@ func ShowMainWindow(a fyne.App, database *sql.DB, key []byte, entries []models.P
 	// === Макет ===
 	vs := container.NewVSplit(table, detailPanel)
 	//vs.SetOffset(0.2)
-	mainContent := container.NewHSplit(groupList, vs)
+	mainContent := container.NewHSplit(container.NewBorder(nil, tagSelect, nil, nil, groupList), vs)
 	mainContent.SetOffset(0.2)
 
 	content := container.NewBorder(toolbar, nil, nil, nil, mainContent)
 	win.SetContent(content)
+
+	// Автоблокировка: стираем ключи и расшифрованные записи, закрываем окно
+	// и показываем экран блокировки для той же открытой базы. Если поверх окна открыт
+	// диалог, форма записи или окно настроек, блокировка откладывается ещё на один таймаут,
+	// а затем они закрываются без сохранения введённого.
+	locked := false
+	idle.watch(win.Canvas())
+	busy := func() bool { return win.Canvas().Overlays().Top() != nil }
+	idle.start(time.Duration(settings.LockMinutes)*time.Minute, busy, func() {
+		if locked {
+			return
+		}
+		locked = true
+		idle.stop()
+		if settingsWindowOpen && closeSettings != nil {
+			closeSettings()
+		}
+		for _, o := range win.Canvas().Overlays().List() {
+			o.Hide()
+			win.Canvas().Overlays().Remove(o)
+		}
+		if cancel != nil {
+			close(cancel)
+			cancel = nil
+			a.Clipboard().SetContent("")
+		}
+		keys.Wipe()
+		for i := range entries {
+			entries[i] = models.PasswordEntry{}
+		}
+		entries = nil
+		fieldsBox.RemoveAll()
+		otp.hide()
+		detail.ParseMarkdown("")
+		showLockWindow(a, database)
+		win.Close()
+	})
+	// закрытие окна — выход из приложения: ключи сессии затираются
+	win.SetOnClosed(func() {
+		idle.stop()
+		otp.hide()
+		keys.Wipe()
+	})
 	win.Show()
 }
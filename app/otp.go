@@ -0,0 +1,101 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+)
+
+// otpView — текущий код TOTP выбранной записи с обратным отсчётом и кнопкой копирования
+type otpView struct {
+	box      *fyne.Container
+	code     *widget.Label
+	progress *widget.ProgressBar
+	copyBtn  *widget.Button
+	stop     chan struct{}
+}
+
+// newOTPView создаёт панель кода; onCopy получает код, действующий в момент нажатия
+func newOTPView(onCopy func(code string)) *otpView {
+	v := &otpView{
+		code:     widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true, Bold: true}),
+		progress: widget.NewProgressBar(),
+	}
+	v.copyBtn = widget.NewButtonWithIcon("Скопировать код", theme.ContentCopyIcon(), nil)
+	v.box = container.NewHBox(widget.NewLabel("TOTP:"), v.code, container.NewGridWrap(fyne.NewSize(120, 36), v.progress), v.copyBtn)
+	v.box.Hide()
+	v.copyBtn.OnTapped = func() {
+		if v.code.Text != "" {
+			onCopy(v.code.Text)
+		}
+	}
+	return v
+}
+
+// show запускает показ кода для секрета записи; пустой секрет скрывает панель
+func (v *otpView) show(secret string) {
+	v.hide()
+	if secret == "" {
+		return
+	}
+	p, err := crypto.ParseOTP(secret)
+	if err != nil {
+		v.code.SetText(err.Error())
+		v.progress.Hide()
+		v.copyBtn.Disable()
+		v.box.Show()
+		return
+	}
+	v.progress.Max = float64(p.Period)
+	v.progress.Show()
+	v.copyBtn.Enable()
+
+	update := func() {
+		code, remaining := crypto.TOTP(p, time.Now())
+		sec := int(remaining / time.Second)
+		v.code.SetText(code)
+		v.progress.TextFormatter = func() string { return fmt.Sprintf("%d сек", sec) }
+		v.progress.SetValue(float64(sec))
+	}
+	update()
+	v.box.Show()
+
+	stop := make(chan struct{})
+	v.stop = stop
+	go func() {
+		defer crypto.Wipe(p.Secret)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				fyne.Do(func() {
+					// панель могли переключить на другую запись, пока ждали главный поток
+					select {
+					case <-stop:
+					default:
+						update()
+					}
+				})
+			}
+		}
+	}()
+}
+
+// hide останавливает обновление кода и скрывает панель
+func (v *otpView) hide() {
+	if v.stop != nil {
+		close(v.stop)
+		v.stop = nil
+	}
+	v.code.SetText("")
+	v.box.Hide()
+}
@@ -1,9 +1,7 @@
 package app
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -15,41 +13,9 @@ import (
 	"github.com/reinbowARA/PassLedger/models"
 )
 
-const settingsFile = "settings.json"
-
-func LoadSettings() (models.Settings, error) {
-	settings := models.Settings{
-		DBPath:       models.DefaultDBPath,
-		ThemeVariant: 1,
-		TimerSeconds: models.TIME_CLEAR_PASSWD,
-	}
-
-	file, err := os.Open(settingsFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return settings, nil // Default settings
-		}
-		return settings, err
-	}
-	defer file.Close()
-
-	err = json.NewDecoder(file).Decode(&settings)
-	return settings, err
-}
-
-func SaveSettings(settings models.Settings) error {
-	file, err := os.Create(settingsFile)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(settings)
-}
-
-func showSettingsForm(parent fyne.Window, currentSettings *models.Settings, a fyne.App, overlay *widget.PopUp, settingsWindowOpen *bool, onSave func(models.Settings)) {
+// showSettingsForm открывает окно настроек и возвращает функцию, которая закрывает его,
+// отбрасывая несохранённые изменения, — её вызывает автоблокировка
+func showSettingsForm(parent fyne.Window, currentSettings *models.Settings, a fyne.App, overlay *widget.PopUp, settingsWindowOpen *bool, onSave func(models.Settings)) func() {
 	settingsWin := fyne.CurrentApp().NewWindow("Настройки")
 	settingsWin.Resize(fyne.NewSize(600, 400))
 	settingsWin.CenterOnScreen()
@@ -124,10 +90,21 @@ func showSettingsForm(parent fyne.Window, currentSettings *models.Settings, a fy
 
 	timerContainer := container.NewVBox(timerSlider, timerLabel)
 
+	lockSlider := widget.NewSlider(0, 60)
+	lockSlider.SetValue(float64(tempSettings.LockMinutes))
+	lockLabel := widget.NewLabel(lockMinutesText(tempSettings.LockMinutes))
+	lockSlider.OnChanged = func(value float64) {
+		tempSettings.LockMinutes = int(value)
+		lockLabel.SetText(lockMinutesText(int(value)))
+	}
+
+	lockContainer := container.NewVBox(lockSlider, lockLabel)
+
 	form := widget.NewForm(
 		widget.NewFormItem("Путь к БД*", dbPathContainer),
 		widget.NewFormItem("Тема", themeContainer),
 		widget.NewFormItem("Таймер очистки буфера (сек)", timerContainer),
+		widget.NewFormItem("Автоблокировка (мин)", lockContainer),
 	)
 
 	saveBtn := widget.NewButtonWithIcon("Сохранить", theme.ConfirmIcon(), func() {
@@ -136,8 +113,10 @@ func showSettingsForm(parent fyne.Window, currentSettings *models.Settings, a fy
 		}
 		newSettings := models.Settings{
 			DBPath:       dbPathEntry.Text,
+			KeyfilePath:  tempSettings.KeyfilePath,
 			ThemeVariant: tempSettings.ThemeVariant,
 			TimerSeconds: tempSettings.TimerSeconds,
+			LockMinutes:  tempSettings.LockMinutes,
 		}
 		onSave(newSettings)
 		overlay.Hide()
@@ -157,7 +136,7 @@ func showSettingsForm(parent fyne.Window, currentSettings *models.Settings, a fy
 		saveBtn.Enable()
 	})
 
-	cancelBtn := widget.NewButtonWithIcon("Отмена", theme.CancelIcon(), func() {
+	discard := func() {
 		if applied {
 			*currentSettings = originalSettings
 			if originalSettings.ThemeVariant == 0 {
@@ -169,7 +148,8 @@ func showSettingsForm(parent fyne.Window, currentSettings *models.Settings, a fy
 		overlay.Hide()
 		*settingsWindowOpen = false
 		settingsWin.Close()
-	})
+	}
+	cancelBtn := widget.NewButtonWithIcon("Отмена", theme.CancelIcon(), discard)
 
 	content := container.NewVBox(
 		form,
@@ -184,18 +164,15 @@ func showSettingsForm(parent fyne.Window, currentSettings *models.Settings, a fy
 	)
 
 	settingsWin.SetContent(container.NewPadded(content))
-	settingsWin.SetCloseIntercept(func() {
-		if applied {
-			*currentSettings = originalSettings
-			if originalSettings.ThemeVariant == 0 {
-				a.Settings().SetTheme(theme.LightTheme())
-			} else {
-				a.Settings().SetTheme(theme.DarkTheme())
-			}
-		}
-		overlay.Hide()
-		*settingsWindowOpen = false
-		settingsWin.Close()
-	})
+	settingsWin.SetCloseIntercept(discard)
 	settingsWin.Show()
+	return discard
+}
+
+// lockMinutesText — подпись к таймеру автоблокировки
+func lockMinutesText(minutes int) string {
+	if minutes == 0 {
+		return "Не блокировать"
+	}
+	return fmt.Sprintf("%d мин", minutes)
 }
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"database/sql"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// allTags — пункт фильтра по тегам, при котором теги не учитываются
+const allTags = "Все теги"
+
+// selectedTag — тег, выбранный в боковой панели, применяется в refreshListFiltered; "" — без фильтра
+var selectedTag string
+
+// tagOptions возвращает пункты фильтра по тегам: «Все теги» и теги базы по алфавиту
+func tagOptions(database *sql.DB, keys *crypto.VaultKeys) []string {
+	tags, err := db.GetTags(database, keys)
+	if err != nil {
+		return []string{allTags}
+	}
+	return append([]string{allTags}, tags...)
+}
+
+// hasTag проверяет, помечена ли запись тегом tag
+func hasTag(e models.PasswordEntry, tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// tagsMatch ищет q (в нижнем регистре) в тегах записи
+func tagsMatch(tags []string, q string) bool {
+	for _, t := range tags {
+		if strings.Contains(strings.ToLower(t), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// newTagsEditor возвращает редактор тегов записи в виде «чипов» и функцию, которая собирает теги.
+// Новый тег вводится или выбирается из существующих и добавляется по Enter или кнопкой;
+// несколько тегов можно ввести сразу через запятую.
+func newTagsEditor(tags []string, existing []string) (fyne.CanvasObject, func() []string) {
+	tags = append([]string{}, tags...)
+	chips := container.NewGridWrap(fyne.NewSize(130, 36))
+	input := widget.NewSelectEntry(existing)
+	input.SetPlaceHolder("Новый тег")
+
+	var rebuild func()
+	rebuild = func() {
+		chips.Objects = nil
+		for i, t := range tags {
+			chips.Add(widget.NewButtonWithIcon(t, theme.CancelIcon(), func() {
+				tags = append(tags[:i], tags[i+1:]...)
+				rebuild()
+			}))
+		}
+		chips.Refresh()
+	}
+	add := func() {
+		tags = db.ParseTags(strings.Join(append(tags, input.Text), ","))
+		input.SetText("")
+		rebuild()
+	}
+	input.OnSubmitted = func(string) { add() }
+	addBtn := widget.NewButtonWithIcon("", theme.ContentAddIcon(), add)
+	rebuild()
+
+	collect := func() []string {
+		// тег, введённый, но не добавленный кнопкой, тоже сохраняем
+		return db.ParseTags(strings.Join(append(tags, input.Text), ","))
+	}
+	return container.NewVBox(chips, container.NewBorder(nil, nil, nil, addBtn, input)), collect
+}
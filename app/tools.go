@@ -3,9 +3,13 @@ package app
 import (
 	"database/sql"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2"
@@ -14,6 +18,7 @@ import (
 	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/reinbowARA/PassLedger/config"
 	"github.com/reinbowARA/PassLedger/crypto"
 	"github.com/reinbowARA/PassLedger/db"
 	"github.com/reinbowARA/PassLedger/models"
@@ -99,8 +104,8 @@ func showPasswordGeneratorPopup(win fyne.Window) {
 	popup.Show()
 }
 
-func showExportPopup(win fyne.Window, database *sql.DB, key []byte) {
-	entries, err := db.LoadAllEntries(database, key)
+func showExportPopup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys) {
+	entries, err := db.LoadAllEntries(database, keys)
 	if err != nil {
 		dialog.ShowError(err, win)
 		return
@@ -113,14 +118,28 @@ func showExportPopup(win fyne.Window, database *sql.DB, key []byte) {
 			defer writer.Flush()
 
 			// Заголовки
-			headers := []string{"Title", "Username", "Password", "URL", "Notes", "Group"}
+			headers := []string{"Title", "Username", "Password", "URL", "Notes", "Group", "Fields", "Attachments", "Tags", "OTP"}
 			if err := writer.Write(headers); err != nil {
 				dialog.ShowError(err, win)
 				return
 			}
 
+			// Вложения сохраняются файлами в каталог рядом с CSV
+			csvPath := uc.URI().Path()
+			baseDir, attachmentsDir := filepath.Dir(csvPath), attachmentsDirFor(csvPath)
+
 			// Данные
 			for _, entry := range entries {
+				fields, err := encodeCSVFields(entry.Fields)
+				if err != nil {
+					dialog.ShowError(err, win)
+					return
+				}
+				attachments, err := exportEntryAttachments(database, keys, entry.ID, baseDir, attachmentsDir)
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("Ошибка экспорта вложений записи '%s': %v", entry.Title, err), win)
+					return
+				}
 				record := []string{
 					entry.Title,
 					entry.Username,
@@ -128,6 +147,10 @@ func showExportPopup(win fyne.Window, database *sql.DB, key []byte) {
 					entry.URL,
 					entry.Notes,
 					entry.Group,
+					fields,
+					attachments,
+					strings.Join(entry.Tags, ","),
+					entry.OTP,
 				}
 				if err := writer.Write(record); err != nil {
 					dialog.ShowError(err, win)
@@ -142,127 +165,241 @@ func showExportPopup(win fyne.Window, database *sql.DB, key []byte) {
 	fd.Show()
 }
 
-func showImportPopup(win fyne.Window, database *sql.DB, key []byte, onImport func()) {
+func showImportPopup(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, onImport func()) {
 	fd := dialog.NewFileOpen(func(uc fyne.URIReadCloser, e error) {
 		if uc != nil {
-			defer uc.Close()
-			reader := csv.NewReader(uc)
-			records, err := reader.ReadAll()
+			data, err := io.ReadAll(uc)
+			uc.Close()
 			if err != nil {
-				dialog.ShowError(fmt.Errorf("Ошибка чтения CSV файла, проверьте его на корректность"), win)
+				dialog.ShowError(err, win)
 				return
 			}
-			if len(records) < 2 {
-				dialog.ShowError(fmt.Errorf("CSV файл должен содержать заголовки и хотя бы одну строку данных"), win)
+			file, err := readCSV(data)
+			if err != nil {
+				dialog.ShowError(err, win)
 				return
 			}
 
-			headers := records[0]
-			data := records[1:]
-
-			// Найти индексы колонок
-			var titleIdx, usernameIdx, passwordIdx, urlIdx, notesIdx, groupIdx = -1, -1, -1, -1, -1, -1
-			for i, h := range headers {
-				switch strings.ToLower(h) {
-				case "title":
-					titleIdx = i
-				case "username":
-					usernameIdx = i
-				case "password":
-					passwordIdx = i
-				case "url":
-					urlIdx = i
-				case "notes":
-					notesIdx = i
-				case "group":
-					groupIdx = i
+			// Пути вложений в колонке Attachments отсчитываются от каталога CSV
+			baseDir := filepath.Dir(uc.URI().Path())
+			run := func(format *csvFormat, mapping []csvTarget) {
+				rows, report, err := prepareCSV(database, keys, file, format, mapping)
+				if err != nil {
+					dialog.ShowError(err, win)
+					return
+				}
+				if len(rows) == 0 {
+					showCSVReport(win, report)
+					return
 				}
+				groupSep := ""
+				if format != nil {
+					groupSep = format.groupSep
+				}
+				// Перед сохранением показать строки и выбрать действия для дублей
+				showCSVPreview(win, rows, report, func() {
+					if err := importCSV(database, keys, rows, groupSep, baseDir, report); err != nil {
+						dialog.ShowError(fmt.Errorf("Импорт отменён, база не изменена: %v", err), win)
+						return
+					}
+					if onImport != nil {
+						onImport()
+					}
+					showCSVReport(win, report)
+				})
 			}
-
-			// Проверка обязательных полей
-			if usernameIdx == -1 || passwordIdx == -1 || urlIdx == -1 {
-				dialog.ShowError(fmt.Errorf("Обязательные колонки: username, password, url"), win)
+			// Колонки известного формата сопоставляются сами, для остальных — пользователем
+			if format, mapping := detectCSVFormat(file.headers); format != nil {
+				run(format, mapping)
 				return
 			}
+			showCSVMappingDialog(win, file, func(mapping []csvTarget) {
+				run(nil, mapping)
+			})
+		}
+	}, win)
+	fd.SetFilter(storage.NewExtensionFileFilter([]string{".csv"}))
+	fd.Resize(fyne.NewSize(800, 600))
+	fd.Show()
+}
 
-			// Найти максимальный индекс для проверки корректности строк
-			maxIdx := usernameIdx
-			if passwordIdx > maxIdx {
-				maxIdx = passwordIdx
-			}
-			if urlIdx > maxIdx {
-				maxIdx = urlIdx
-			}
-			if titleIdx > maxIdx {
-				maxIdx = titleIdx
-			}
-			if notesIdx > maxIdx {
-				maxIdx = notesIdx
-			}
-			if groupIdx > maxIdx {
-				maxIdx = groupIdx
-			}
-
-			imported := 0
-			for _, row := range data {
-				if len(row) <= maxIdx {
-					dialog.ShowError(fmt.Errorf("Некорректная строка: недостаточно колонок"), win)
-					continue
-				}
+func showChangePasswordDialog(win fyne.Window, database *sql.DB) {
+	oldEntry := widget.NewPasswordEntry()
+	oldEntry.SetPlaceHolder("Текущий мастер-пароль")
+	newEntry := widget.NewPasswordEntry()
+	newEntry.SetPlaceHolder("Новый мастер-пароль")
+	confirmEntry := widget.NewPasswordEntry()
+	confirmEntry.SetPlaceHolder("Повторите новый мастер-пароль")
 
-				username := strings.TrimSpace(row[usernameIdx])
-				password := strings.TrimSpace(row[passwordIdx])
-				url := strings.TrimSpace(row[urlIdx])
+	settings, _ := config.Load()
+	oldKeyfileEntry, oldKeyfileSelector := newKeyfileSelector(win, false)
+	if required, _ := db.KeyfileRequired(database); required {
+		oldKeyfileEntry.SetText(settings.KeyfilePath)
+	}
+	newKeyfileEntry, newKeyfileSelector := newKeyfileSelector(win, true)
 
-				if username == "" || password == "" || url == "" {
-					continue // Пропустить неполные строки
-				}
+	form := widget.NewForm(
+		widget.NewFormItem("Текущий", oldEntry),
+		widget.NewFormItem("Текущий ключевой файл", oldKeyfileSelector),
+		widget.NewFormItem("Новый", newEntry),
+		widget.NewFormItem("Повтор", confirmEntry),
+		widget.NewFormItem("Новый ключевой файл", newKeyfileSelector),
+	)
 
-				title := ""
-				if titleIdx != -1 && titleIdx < len(row) {
-					title = strings.TrimSpace(row[titleIdx])
-				}
-				if title == "" {
-					// Взять из URL без http
-					title = extractTitleFromURL(url)
-				}
+	dlg := dialog.NewCustomConfirm("Смена мастер-пароля", models.SAVE, models.CANCEL, form, func(ok bool) {
+		if !ok {
+			return
+		}
+		if newEntry.Text == "" {
+			dialog.ShowError(fmt.Errorf("Пароль не может быть пустым"), win)
+			return
+		}
+		if newEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("Пароли не совпадают"), win)
+			return
+		}
+		oldKeyfile, err := readKeyfile(oldKeyfileEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		defer crypto.Wipe(oldKeyfile)
+		newKeyfile, err := readKeyfile(newKeyfileEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		defer crypto.Wipe(newKeyfile)
+		oldPassword, newPassword := []byte(oldEntry.Text), []byte(newEntry.Text)
+		err = db.ChangeMasterPassword(database, oldPassword, oldKeyfile, newPassword, newKeyfile)
+		crypto.Wipe(oldPassword)
+		crypto.Wipe(newPassword)
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		settings.KeyfilePath = newKeyfileEntry.Text
+		if err := config.Save(settings); err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		dialog.ShowInformation("Смена мастер-пароля", "Мастер-пароль изменён", win)
+	}, win)
+	dlg.Resize(fyne.NewSize(550, 0))
+	dlg.Show()
+}
 
-				notes := ""
-				if notesIdx != -1 && notesIdx < len(row) {
-					notes = strings.TrimSpace(row[notesIdx])
-				}
+func showKDFDialog(win fyne.Window, database *sql.DB) {
+	current, err := db.GetKDFParams(database)
+	if err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+	currentLabel := widget.NewLabel(current.String())
+	if pending, ok, _ := db.GetPendingKDFUpgrade(database); ok {
+		currentLabel.SetText(current.String() + "\nПри следующем входе: " + pending.String())
+	}
 
-				group := ""
-				if groupIdx != -1 && groupIdx < len(row) {
-					group = strings.TrimSpace(row[groupIdx])
-				}
+	algorithms := map[string]string{
+		"PBKDF2-Стрибог": crypto.KDFPBKDF2Streebog,
+		"Argon2id":       crypto.KDFArgon2id,
+	}
+	algorithmSelect := widget.NewSelect([]string{"PBKDF2-Стрибог", "Argon2id"}, nil)
+	algorithmSelect.SetSelected("Argon2id")
 
-				entry := models.PasswordEntry{
-					Title:    title,
-					Username: username,
-					Password: password,
-					URL:      url,
-					Notes:    notes,
-					Group:    group,
-				}
+	targetSlider := widget.NewSlider(0.5, 5)
+	targetSlider.Step = 0.5
+	targetSlider.SetValue(1)
+	targetLabel := widget.NewLabel("1.0 сек")
+	targetSlider.OnChanged = func(value float64) {
+		targetLabel.SetText(fmt.Sprintf("%.1f сек", value))
+	}
 
-				err := db.SaveEntry(database, key, entry)
+	var selected *crypto.KDFParams
+	resultLabel := widget.NewLabel("")
+	progress := widget.NewProgressBarInfinite()
+	progress.Hide()
+	var benchBtn *widget.Button
+	benchBtn = widget.NewButton("Подобрать параметры", func() {
+		// замер занимает секунды, поэтому идёт в фоне, а окно остаётся отзывчивым
+		target := time.Duration(targetSlider.Value * float64(time.Second))
+		algorithm := algorithms[algorithmSelect.Selected]
+		benchBtn.Disable()
+		algorithmSelect.Disable()
+		targetSlider.Disable()
+		resultLabel.SetText("Замер…")
+		progress.Show()
+		go func() {
+			params, err := crypto.BenchmarkKDF(algorithm, target)
+			fyne.Do(func() {
+				progress.Hide()
+				benchBtn.Enable()
+				algorithmSelect.Enable()
+				targetSlider.Enable()
 				if err != nil {
-					dialog.ShowError(fmt.Errorf("Ошибка импорта записи: %v", err), win)
+					resultLabel.SetText("")
+					dialog.ShowError(err, win)
 					return
 				}
-				imported++
-			}
+				selected = &params
+				resultLabel.SetText(params.String())
+			})
+		}()
+	})
 
-			dialog.ShowInformation("Импорт", fmt.Sprintf("Успешно импортировано %d записей", imported), win)
-			if onImport != nil {
-				onImport()
-			}
+	form := widget.NewForm(
+		widget.NewFormItem("Текущие", currentLabel),
+		widget.NewFormItem("Алгоритм", algorithmSelect),
+		widget.NewFormItem("Время входа", container.NewBorder(nil, nil, nil, targetLabel, targetSlider)),
+		widget.NewFormItem("", benchBtn),
+		widget.NewFormItem("Новые", container.NewVBox(resultLabel, progress)),
+	)
+
+	dlg := dialog.NewCustomConfirm("Параметры KDF", models.SAVE, models.CANCEL, form, func(ok bool) {
+		if !ok || selected == nil {
+			return
+		}
+		if err := db.ScheduleKDFUpgrade(database, *selected); err != nil {
+			dialog.ShowError(err, win)
+			return
 		}
+		dialog.ShowInformation("Параметры KDF", "Новые параметры будут применены при следующем входе", win)
 	}, win)
-	fd.SetFilter(storage.NewExtensionFileFilter([]string{".csv"}))
-	fd.Resize(fyne.NewSize(800, 600))
-	fd.Show()
+	dlg.Resize(fyne.NewSize(500, 0))
+	dlg.Show()
+}
+
+// encodeCSVFields записывает дополнительные поля в колонку Fields как JSON-массив,
+// чтобы при импорте сохранились порядок и типы полей
+func encodeCSVFields(fields []models.CustomField) (string, error) {
+	if len(fields) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(fields)
+	return string(data), err
+}
+
+// decodeCSVFields разбирает колонку Fields; пустое значение — нет полей
+func decodeCSVFields(s string) ([]models.CustomField, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var fields []models.CustomField
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		return nil, fmt.Errorf("некорректная колонка fields: %w", err)
+	}
+	for i := range fields {
+		switch fields[i].Type {
+		case models.FieldText, models.FieldHidden, models.FieldURL, models.FieldDate:
+		default: // неизвестный или не указанный тип
+			fields[i].Type = models.FieldText
+		}
+		if err := validateCustomField(fields[i]); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
 }
 
 func extractTitleFromURL(url string) string {
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// trashItem — строка диалога корзины: удалённая группа или запись
+type trashItem struct {
+	text    string
+	restore func() error
+	purge   func() error
+}
+
+// showTrashDialog показывает содержимое корзины с восстановлением и окончательным удалением.
+// onChange вызывается после любого изменения, чтобы обновить главное окно.
+func showTrashDialog(win fyne.Window, database *sql.DB, keys *crypto.VaultKeys, onChange func()) {
+	var items []trashItem
+	load := func() error {
+		groups, entries, err := db.ListTrash(database, keys)
+		if err != nil {
+			return err
+		}
+		items = items[:0]
+		for _, g := range groups {
+			id := g.Group.Id
+			items = append(items, trashItem{
+				text:    fmt.Sprintf("%s «%s» (записей: %d) — %s", models.GROUP, g.Group.Path, g.Entries, g.DeletedAt.Format("02.01.2006 15:04")),
+				restore: func() error { return db.RestoreGroup(database, id) },
+				purge:   func() error { return db.PurgeGroup(database, id) },
+			})
+		}
+		for _, e := range entries {
+			id := e.Entry.ID
+			text := e.Entry.Title
+			if e.Entry.Group != "" {
+				text += " [" + e.Entry.Group + "]"
+			}
+			items = append(items, trashItem{
+				text:    text + " — " + e.DeletedAt.Format("02.01.2006 15:04"),
+				restore: func() error { return db.RestoreEntry(database, id) },
+				purge:   func() error { return db.PurgeEntry(database, id) },
+			})
+		}
+		return nil
+	}
+	if err := load(); err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+
+	var list *widget.List
+	// apply выполняет действие над корзиной и перечитывает её
+	apply := func(action func() error) {
+		if err := action(); err != nil {
+			dialog.ShowError(err, win)
+		}
+		if err := load(); err != nil {
+			dialog.ShowError(err, win)
+		}
+		list.Refresh()
+		onChange()
+	}
+
+	list = widget.NewList(
+		func() int { return len(items) },
+		func() fyne.CanvasObject {
+			restoreBtn := widget.NewButtonWithIcon("", theme.ContentUndoIcon(), nil)
+			purgeBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)
+			return container.NewBorder(nil, nil, nil, container.NewHBox(restoreBtn, purgeBtn), widget.NewLabel(""))
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			item := items[i]
+			row := o.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(item.text)
+			btns := row.Objects[1].(*fyne.Container)
+			btns.Objects[0].(*widget.Button).OnTapped = func() {
+				apply(item.restore)
+			}
+			btns.Objects[1].(*widget.Button).OnTapped = func() {
+				dialog.ShowConfirm("Удалить навсегда", "Удалить без возможности восстановления?\n"+item.text, func(ok bool) {
+					if ok {
+						apply(item.purge)
+					}
+				}, win)
+			}
+		},
+	)
+
+	emptyBtn := widget.NewButtonWithIcon("Очистить корзину", theme.DeleteIcon(), func() {
+		if len(items) == 0 {
+			return
+		}
+		dialog.ShowConfirm("Очистить корзину", "Удалить всё содержимое корзины без возможности восстановления?", func(ok bool) {
+			if ok {
+				apply(func() error { return db.EmptyTrash(database) })
+			}
+		}, win)
+	})
+	emptyBtn.Importance = widget.DangerImportance
+
+	days, err := db.GetTrashDays(database)
+	if err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+	daysEntry := widget.NewEntry()
+	daysEntry.SetText(strconv.Itoa(days))
+	saveDaysBtn := widget.NewButtonWithIcon(models.SAVE, theme.DocumentSaveIcon(), func() {
+		days, err := strconv.Atoi(strings.TrimSpace(daysEntry.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("введите целое число"), win)
+			return
+		}
+		apply(func() error { return db.SetTrashDays(database, days) })
+	})
+
+	bottom := container.NewBorder(nil, nil,
+		widget.NewLabel("Очищать через (дней, 0 — никогда):"),
+		container.NewHBox(saveDaysBtn, emptyBtn),
+		daysEntry,
+	)
+	content := container.NewBorder(nil, bottom, nil, nil, list)
+
+	dlg := dialog.NewCustom(models.DefaultNameTrash, "Закрыть", content, win)
+	dlg.Resize(fyne.NewSize(750, 450))
+	dlg.Show()
+}
@@ -3,15 +3,20 @@ package app
 import (
 	"database/sql"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/reinbowARA/PassLedger/crypto"
 	"github.com/reinbowARA/PassLedger/db"
 	"github.com/reinbowARA/PassLedger/models"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
@@ -28,19 +33,86 @@ func ShowInfo(win fyne.Window, title, message string) {
 }
 
 // getUniqueGroupsFromDB грузит свежие группы из DB
-func getUniqueGroupsFromDB(database *sql.DB, key []byte) []string {
-	groups, err := db.GetGroup(database)
+func getUniqueGroupsFromDB(database *sql.DB, keys *crypto.VaultKeys) []string {
+	groups, err := db.GetGroup(database, keys)
 	if err != nil {
 		// если ошибка — возвращаем пустой набор кроме models.DefaultNameAllGroups
 		return []string{models.DefaultNameAllGroups}
 	}
 	out := []string{models.DefaultNameAllGroups}
 	for _, g := range groups {
-		out = append(out, g.Name)
+		out = append(out, g.Path)
 	}
 	return out
 }
 
+// newKeyfileSelector — поле пути к ключевому файлу с кнопкой выбора
+// и (если allowCreate) кнопкой генерации нового файла
+func newKeyfileSelector(win fyne.Window, allowCreate bool) (*widget.Entry, fyne.CanvasObject) {
+	pathEntry := widget.NewEntry()
+	pathEntry.SetPlaceHolder("Ключевой файл (необязательно)")
+
+	browseBtn := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+		fd := dialog.NewFileOpen(func(uc fyne.URIReadCloser, e error) {
+			if uc != nil {
+				pathEntry.SetText(uc.URI().Path())
+				uc.Close()
+			}
+		}, win)
+		fd.Resize(fyne.NewSize(800, 600))
+		fd.Show()
+	})
+	buttons := container.NewHBox(browseBtn)
+
+	if allowCreate {
+		// диалог сохранения Fyne сам создаёт или обрезает выбранный файл, поэтому выбирается
+		// папка, а файл создаёт GenerateKeyfile, который не перезаписывает существующие
+		createBtn := widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() {
+			fd := dialog.NewFolderOpen(func(dir fyne.ListableURI, e error) {
+				if dir == nil {
+					return
+				}
+				nameEntry := widget.NewEntry()
+				nameEntry.SetText("passledger.key")
+				items := []*widget.FormItem{widget.NewFormItem("Имя файла", nameEntry)}
+				dialog.ShowForm("Новый ключевой файл", "Создать", models.CANCEL, items, func(ok bool) {
+					if !ok || nameEntry.Text == "" {
+						return
+					}
+					path := filepath.Join(dir.Path(), nameEntry.Text)
+					if err := crypto.GenerateKeyfile(path); err != nil {
+						dialog.ShowError(err, win)
+						return
+					}
+					pathEntry.SetText(path)
+					dialog.ShowInformation("Ключевой файл", "Ключевой файл создан. Сохраните его копию: без него войти в базу нельзя.", win)
+				}, win)
+			}, win)
+			fd.Resize(fyne.NewSize(800, 600))
+			fd.Show()
+		})
+		buttons.Add(createBtn)
+	}
+
+	return pathEntry, container.NewBorder(nil, nil, nil, buttons, pathEntry)
+}
+
+// readKeyfile читает ключевой файл; пустой путь — ключевой файл не используется,
+// а пустой файл — ошибка, иначе база молча создалась бы без второго фактора
+func readKeyfile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать ключевой файл: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, db.ErrEmptyKeyfile
+	}
+	return data, nil
+}
+
 func maskPassword(p string) string {
 	if len(p) == 0 {
 		return ""
@@ -48,16 +120,20 @@ func maskPassword(p string) string {
 	return "********"
 }
 
-func refreshListFiltered(database *sql.DB, key []byte, entries *[]models.PasswordEntry, win fyne.Window, group, query string, filters models.SearchFilters, detail *widget.RichText) {
-	all, err := db.LoadAllEntries(database, key)
+func refreshListFiltered(database *sql.DB, keys *crypto.VaultKeys, entries *[]models.PasswordEntry, win fyne.Window, group, query string, filters models.SearchFilters, detail *widget.RichText) {
+	all, err := db.LoadAllEntries(database, keys)
 	if err != nil {
 		ShowInfo(win, "Ошибка", "Не удалось загрузить записи: "+err.Error())
 		return
 	}
 
+	// выбранная группа показывает и записи всех своих подгрупп
 	filtered := []models.PasswordEntry{}
 	for _, e := range all {
-		if group != "" && group != models.DefaultNameAllGroups && e.Group != group {
+		if group != "" && group != models.DefaultNameAllGroups && !db.InGroup(e.Group, group) {
+			continue
+		}
+		if selectedTag != "" && !hasTag(e, selectedTag) {
 			continue
 		}
 		if query != "" {
@@ -78,12 +154,21 @@ func refreshListFiltered(database *sql.DB, key []byte, entries *[]models.Passwor
 			if filters.Notes && strings.Contains(strings.ToLower(e.Notes), q) {
 				matches = true
 			}
+			if filters.Fields && customFieldsMatch(e.Fields, q) {
+				matches = true
+			}
+			if filters.Tags && tagsMatch(e.Tags, q) {
+				matches = true
+			}
 			if !matches {
 				continue
 			}
 		}
 		filtered = append(filtered, e)
 	}
+	if less := entrySorts[selectedSort].less; less != nil {
+		sort.SliceStable(filtered, func(i, j int) bool { return less(filtered[i], filtered[j]) })
+	}
 	*entries = filtered
 	if len(filtered) == 0 && query != "" {
 		detail.ParseMarkdown("# Ничего не найдено\n\nПо запросу: `" + query + "`")
@@ -94,6 +179,40 @@ func refreshListFiltered(database *sql.DB, key []byte, entries *[]models.Passwor
 	win.Content().Refresh()
 }
 
+// entrySort — вариант сортировки таблицы записей
+type entrySort struct {
+	name string
+	less func(a, b models.PasswordEntry) bool // nil — порядок добавления
+}
+
+// newerFirst сортирует по отметке времени от новых к старым; неизвестное время — в конце
+func newerFirst(at func(e models.PasswordEntry) time.Time) func(a, b models.PasswordEntry) bool {
+	return func(a, b models.PasswordEntry) bool { return at(a).After(at(b)) }
+}
+
+// entrySorts — варианты сортировки в выпадающем списке главного окна
+var entrySorts = []entrySort{
+	{"Порядок добавления", nil},
+	{models.TITLE, func(a, b models.PasswordEntry) bool {
+		return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+	}},
+	{models.CREATED, newerFirst(func(e models.PasswordEntry) time.Time { return e.Created })},
+	{models.MODIFIED, newerFirst(func(e models.PasswordEntry) time.Time { return e.Modified })},
+	{models.PASSWORD_CHANGED, newerFirst(func(e models.PasswordEntry) time.Time { return e.PasswordChanged })},
+	{models.LAST_USED, newerFirst(func(e models.PasswordEntry) time.Time { return e.LastUsed })},
+}
+
+// selectedSort — индекс выбранной сортировки в entrySorts, применяется в refreshListFiltered
+var selectedSort int
+
+// formatTime форматирует отметку времени записи; нулевое время — «—»
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "—"
+	}
+	return t.Format("02.01.2006 15:04")
+}
+
 func showFilterDialog(win fyne.Window, filters *models.SearchFilters, onChange func()) {
 	titleCb := widget.NewCheck(models.TITLE, nil)
 	titleCb.SetChecked(filters.Title)
@@ -110,12 +229,20 @@ func showFilterDialog(win fyne.Window, filters *models.SearchFilters, onChange f
 	notesCb := widget.NewCheck(models.NOTES, nil)
 	notesCb.SetChecked(filters.Notes)
 
+	fieldsCb := widget.NewCheck(models.FIELDS, nil)
+	fieldsCb.SetChecked(filters.Fields)
+
+	tagsCb := widget.NewCheck(models.TAGS, nil)
+	tagsCb.SetChecked(filters.Tags)
+
 	content := container.NewVBox(
 		titleCb,
 		usernameCb,
 		urlCb,
 		groupCb,
 		notesCb,
+		fieldsCb,
+		tagsCb,
 	)
 
 	dialog.ShowCustomConfirm("Выберите поля для поиска", models.CONFIRM, models.CANCEL, content, func(ok bool) {
@@ -125,6 +252,8 @@ func showFilterDialog(win fyne.Window, filters *models.SearchFilters, onChange f
 			filters.URL = urlCb.Checked
 			filters.Group = groupCb.Checked
 			filters.Notes = notesCb.Checked
+			filters.Fields = fieldsCb.Checked
+			filters.Tags = tagsCb.Checked
 			onChange()
 		}
 	}, win)
@@ -142,6 +271,22 @@ func ShowEntry(entry models.PasswordEntry, hidePasswd bool) (text string) {
 **URL:** %s
 **Заметки:** %s `,
 		entry.Title, entry.Group, entry.Username, entry.Password, entry.URL, entry.Notes)
+	if len(entry.Tags) > 0 {
+		text += "\n**Теги:** " + strings.Join(entry.Tags, ", ")
+	}
+	if len(entry.Fields) > 0 {
+		text += "\n" + formatCustomFields(entry.Fields, hidePasswd)
+	}
+	// у записей из старых баз и у версий из истории отметок времени нет
+	if !entry.Created.IsZero() || !entry.Modified.IsZero() || !entry.LastUsed.IsZero() {
+		text += fmt.Sprintf(`
+
+**Создано:** %s
+**Изменено:** %s
+**Пароль изменён:** %s
+**Использовано:** %s `,
+			formatTime(entry.Created), formatTime(entry.Modified), formatTime(entry.PasswordChanged), formatTime(entry.LastUsed))
+	}
 	return
 }
 
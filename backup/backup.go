@@ -0,0 +1,383 @@
+// Package backup читает и пишет переносимую резервную копию PassLedger: всё хранилище
+// одним файлом, зашифрованным отдельной парольной фразой на тех же примитивах, что и база
+// (Кузнечик-MGM, Стрибог, PBKDF2-Стрибог или Argon2id).
+//
+// Формат файла:
+//
+//	"PLBACKUP" | версия (uint16, BE) | длина заголовка (uint32, BE) | заголовок (JSON) | фрагменты
+//	фрагмент: длина (uint32, BE) | шифротекст crypto.EncryptData
+//
+// Заголовок открыт: в нём параметры KDF, соль и контрольное значение ключа, по которому
+// неверная парольная фраза отличается от повреждённого файла. Данные — поток gzip, нарезанный
+// на фрагменты по 64 КиБ; каждый фрагмент шифруется отдельно, а в его присоединённые данные
+// входят всё, что стоит перед фрагментами, номер фрагмента и признак последнего. Поэтому подмена
+// заголовка, перестановка и усечение фрагментов обнаруживаются так же, как подмена данных,
+// а ни копия, ни хранилище не собираются в памяти целиком.
+//
+// Внутри gzip — записи «длина (uint32, BE) | JSON»: сначала models.SnapshotInfo, затем
+// models.SnapshotEntry по одной; сразу за записью идёт содержимое её вложений подряд.
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// Version — версия формата, которую пишет NewWriter. Копии версии 1 (весь снимок одним
+// шифротекстом) по-прежнему читаются.
+const Version = 2
+
+var magic = []byte("PLBACKUP")
+
+// maxHeaderSize ограничивает заголовок, чтобы повреждённая длина не заставила читать гигабайты
+const maxHeaderSize = 64 * 1024
+
+// maxRecordSize ограничивает запись внутри потока: сводку со всеми группами или запись
+// хранилища с историей версий
+const maxRecordSize = 64 << 20
+
+// Пределы параметров KDF. Заголовок проверяется только после вывода ключа, поэтому подменённые
+// параметры не должны заставить считать KDF часами или занять всю память.
+const (
+	maxPBKDF2Iterations = 5_000_000
+	maxArgon2Time       = 64
+	maxArgon2Memory     = 1 << 20 // КиБ, 1 ГиБ
+	maxArgon2Threads    = 16
+)
+
+var (
+	// ErrNotBackup — файл не начинается с сигнатуры резервной копии
+	ErrNotBackup = errors.New("файл не является резервной копией PassLedger")
+	// ErrPassphrase — парольная фраза не подошла к контрольному значению
+	ErrPassphrase = errors.New("неверная парольная фраза резервной копии")
+	// ErrCorrupted — не прошла проверка целостности заголовка или данных
+	ErrCorrupted = errors.New("резервная копия повреждена: проверка целостности не пройдена")
+)
+
+// header — открытая часть файла
+type header struct {
+	KDF   crypto.KDFParams `json:"kdf"`
+	Salt  []byte           `json:"salt"`
+	Check []byte           `json:"check"`
+}
+
+// checkKDF проверяет параметры KDF из заголовка по пределам до вывода ключа
+func checkKDF(p crypto.KDFParams) error {
+	switch p.Algorithm {
+	case crypto.KDFPBKDF2Streebog:
+		if p.Iterations > maxPBKDF2Iterations {
+			return fmt.Errorf("%w: слишком много итераций PBKDF2: %d", ErrCorrupted, p.Iterations)
+		}
+	case crypto.KDFArgon2id:
+		if p.Time > maxArgon2Time || p.Memory > maxArgon2Memory || p.Threads > maxArgon2Threads {
+			return fmt.Errorf("%w: параметры Argon2id вне допустимых пределов", ErrCorrupted)
+		}
+	}
+	return p.Validate()
+}
+
+// limitKDF уменьшает параметры базы до пределов, которые согласится считать NewReader
+func limitKDF(p crypto.KDFParams) crypto.KDFParams {
+	p.Iterations = min(p.Iterations, maxPBKDF2Iterations)
+	p.Time = min(p.Time, maxArgon2Time)
+	p.Memory = min(p.Memory, maxArgon2Memory)
+	p.Threads = min(p.Threads, maxArgon2Threads)
+	return p
+}
+
+// deriveKeys выводит из парольной фразы ключ шифрования данных и контрольное значение
+func deriveKeys(passphrase string, h header) (encKey, check []byte, err error) {
+	master, err := crypto.DeriveKEK([]byte(passphrase), h.Salt, h.KDF)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.Wipe(master)
+	encKey, err = crypto.KDF_GOSTR3411_2012_256(master, []byte("резервная копия"), h.Salt, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encKey, crypto.HMACStreebog256(master, []byte("verifier")), nil
+}
+
+// encodePrefix — сигнатура, версия и заголовок: всё, что предшествует данным
+func encodePrefix(h header) ([]byte, error) {
+	hdr, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	prefix := append([]byte(nil), magic...)
+	prefix = binary.BigEndian.AppendUint16(prefix, Version)
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(hdr)))
+	return append(prefix, hdr...), nil
+}
+
+// Writer шифрует резервную копию по мере поступления снимка и реализует db.SnapshotWriter.
+// Close обязателен: он дописывает последний фрагмент, без которого копия считается усечённой.
+type Writer struct {
+	frames  *frameWriter
+	zw      *gzip.Writer
+	started bool
+	left    int   // записей ещё не передано
+	data    int64 // байт содержимого вложений последней записи ещё не передано
+}
+
+// NewWriter пишет в w заголовок копии, ключ которой выводится из парольной фразы с параметрами p.
+// Параметры сверх пределов, которые согласится считать NewReader, уменьшаются до них.
+func NewWriter(w io.Writer, passphrase string, p crypto.KDFParams) (*Writer, error) {
+	if passphrase == "" {
+		return nil, errors.New("парольная фраза резервной копии не может быть пустой")
+	}
+	salt, err := crypto.GenerateSalt(16)
+	if err != nil {
+		return nil, err
+	}
+	h := header{KDF: limitKDF(p), Salt: salt}
+	encKey, check, err := deriveKeys(passphrase, h)
+	if err != nil {
+		return nil, err
+	}
+	h.Check = check
+
+	prefix, err := encodePrefix(h)
+	if err != nil {
+		crypto.Wipe(encKey)
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		crypto.Wipe(encKey)
+		return nil, err
+	}
+	frames := newFrameWriter(w, encKey, prefix)
+	return &Writer{frames: frames, zw: gzip.NewWriter(frames)}, nil
+}
+
+// writeRecord пишет в поток одну запись JSON
+func (w *Writer) writeRecord(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(data)
+	if len(data) > maxRecordSize {
+		return fmt.Errorf("запись резервной копии слишком велика: %d байт", len(data))
+	}
+	if err := binary.Write(w.zw, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.zw.Write(data)
+	return err
+}
+
+// WriteInfo пишет сводку снимка; она идёт первой
+func (w *Writer) WriteInfo(info models.SnapshotInfo) error {
+	if w.started {
+		return errors.New("сводка снимка уже записана")
+	}
+	w.started, w.left = true, info.Entries
+	return w.writeRecord(info)
+}
+
+// WriteEntry пишет очередную запись; содержимое её вложений передаётся следом через Write
+func (w *Writer) WriteEntry(se models.SnapshotEntry) error {
+	if !w.started || w.left == 0 {
+		return errors.New("записей больше, чем указано в сводке снимка")
+	}
+	if w.data != 0 {
+		return errors.New("содержимое вложений предыдущей записи передано не полностью")
+	}
+	for _, att := range se.Attachments {
+		if att.Size < 0 {
+			return fmt.Errorf("вложение '%s': отрицательный размер", att.Name)
+		}
+		w.data += att.Size
+	}
+	w.left--
+	return w.writeRecord(se)
+}
+
+// Write пишет содержимое вложений последней записи
+func (w *Writer) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.data {
+		return 0, errors.New("содержимое вложения больше его размера")
+	}
+	n, err := w.zw.Write(p)
+	w.data -= int64(n)
+	return n, err
+}
+
+// Close завершает поток и шифрует последний фрагмент; w, переданный в NewWriter, не закрывается
+func (w *Writer) Close() error {
+	defer crypto.Wipe(w.frames.key)
+	if w.left != 0 || w.data != 0 {
+		return errors.New("снимок передан не полностью")
+	}
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+	return w.frames.Close()
+}
+
+// Reader расшифровывает резервную копию по мере чтения и реализует db.SnapshotReader.
+// Целостность каждого фрагмента проверяется до того, как его содержимое отдаётся дальше.
+type Reader struct {
+	info   models.SnapshotInfo
+	frames *frameReader
+	zr     *gzip.Reader  // поток версии 2
+	legacy []legacyEntry // копия версии 1, расшифрованная целиком
+	left   int           // записей ещё не прочитано
+	data   io.Reader     // содержимое вложений последней записи
+}
+
+// NewReader проверяет заголовок и парольную фразу и читает сводку снимка
+func NewReader(r io.Reader, passphrase string) (*Reader, error) {
+	fixed := make([]byte, len(magic)+2+4)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, ErrNotBackup
+	}
+	if !bytes.Equal(fixed[:len(magic)], magic) {
+		return nil, ErrNotBackup
+	}
+	version := binary.BigEndian.Uint16(fixed[len(magic):])
+	if version != 1 && version != Version {
+		return nil, fmt.Errorf("резервная копия версии %d не поддерживается: обновите PassLedger", version)
+	}
+	size := binary.BigEndian.Uint32(fixed[len(magic)+2:])
+	if size > maxHeaderSize {
+		return nil, ErrCorrupted
+	}
+	hdr := make([]byte, size)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, ErrCorrupted
+	}
+	var h header
+	if err := json.Unmarshal(hdr, &h); err != nil {
+		return nil, ErrCorrupted
+	}
+	if err := checkKDF(h.KDF); err != nil {
+		return nil, err
+	}
+
+	encKey, check, err := deriveKeys(passphrase, h)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(encKey)
+	if !crypto.HmacEqual(check, h.Check) {
+		return nil, ErrPassphrase
+	}
+	prefix := append(fixed, hdr...)
+	if version == 1 {
+		return readLegacy(r, encKey, prefix)
+	}
+
+	frames := newFrameReader(r, encKey, prefix)
+	zr, err := gzip.NewReader(frames)
+	if err != nil {
+		frames.Close()
+		return nil, corrupted(err)
+	}
+	rd := &Reader{frames: frames, zr: zr, data: bytes.NewReader(nil)}
+	if err := rd.readRecord(&rd.info); err != nil {
+		rd.Close()
+		return nil, err
+	}
+	if rd.info.Entries < 0 {
+		rd.Close()
+		return nil, ErrCorrupted
+	}
+	rd.left = rd.info.Entries
+	return rd, nil
+}
+
+// corrupted оборачивает ошибку разбора расшифрованных данных в ErrCorrupted
+func corrupted(err error) error {
+	if errors.Is(err, ErrCorrupted) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrCorrupted, err)
+}
+
+// readRecord читает из потока одну запись JSON
+func (r *Reader) readRecord(v any) error {
+	var size uint32
+	if err := binary.Read(r.zr, binary.BigEndian, &size); err != nil {
+		return corrupted(err)
+	}
+	if size > maxRecordSize {
+		return ErrCorrupted
+	}
+	data := make([]byte, size)
+	defer crypto.Wipe(data)
+	if _, err := io.ReadFull(r.zr, data); err != nil {
+		return corrupted(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return corrupted(err)
+	}
+	return nil
+}
+
+// Info — сводка снимка: группы, число записей и настройки хранения
+func (r *Reader) Info() models.SnapshotInfo {
+	return r.info
+}
+
+// NextEntry возвращает следующую запись или io.EOF, когда записи кончились и проверен конец
+// потока. Непрочитанное содержимое вложений предыдущей записи пропускается.
+func (r *Reader) NextEntry() (models.SnapshotEntry, error) {
+	if _, err := io.Copy(io.Discard, r.data); err != nil {
+		return models.SnapshotEntry{}, corrupted(err)
+	}
+	if r.left == 0 {
+		if r.zr != nil {
+			// за последней записью поток должен кончаться: это проверяет и контрольную сумму
+			// gzip, и признак последнего фрагмента
+			if n, err := io.Copy(io.Discard, r.zr); err != nil || n > 0 {
+				return models.SnapshotEntry{}, ErrCorrupted
+			}
+		}
+		return models.SnapshotEntry{}, io.EOF
+	}
+	r.left--
+	if r.legacy != nil {
+		var se models.SnapshotEntry
+		se, r.data = r.legacy[0].entry()
+		r.legacy = r.legacy[1:]
+		return se, nil
+	}
+
+	var se models.SnapshotEntry
+	if err := r.readRecord(&se); err != nil {
+		return se, err
+	}
+	var size int64
+	for _, att := range se.Attachments {
+		if att.Size < 0 {
+			return se, ErrCorrupted
+		}
+		size += att.Size
+	}
+	r.data = io.LimitReader(r.zr, size)
+	return se, nil
+}
+
+// Read читает содержимое вложений последней записи: их размеры — в SnapshotEntry.Attachments
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.data.Read(p)
+}
+
+// Close стирает ключ и расшифрованный остаток фрагмента; r, переданный в NewReader, не закрывается
+func (r *Reader) Close() error {
+	if r.frames != nil {
+		r.frames.Close()
+	}
+	return nil
+}
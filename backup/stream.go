@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+)
+
+// chunkSize — размер открытого текста одного фрагмента
+const chunkSize = 64 * 1024
+
+// maxFrameSize ограничивает шифротекст фрагмента: открытый текст и служебные байты MGM
+const maxFrameSize = chunkSize + 1024
+
+// frameAD — присоединённые данные фрагмента: всё, что стоит в файле перед фрагментами,
+// номер фрагмента и признак последнего
+func frameAD(prefix []byte, index uint64, last bool) []byte {
+	ad := binary.BigEndian.AppendUint64(slices.Clip(prefix), index)
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// frameWriter шифрует поток фрагментами. Полный фрагмент уходит, только когда за ним
+// появляются данные, поэтому последний фрагмент всегда шифруется в Close с признаком last.
+type frameWriter struct {
+	w      io.Writer
+	key    []byte
+	prefix []byte
+	index  uint64
+	buf    []byte
+}
+
+func newFrameWriter(w io.Writer, key, prefix []byte) *frameWriter {
+	return &frameWriter{w: w, key: key, prefix: prefix, buf: make([]byte, 0, chunkSize)}
+}
+
+func (f *frameWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if len(f.buf) == chunkSize {
+			if err := f.flush(false); err != nil {
+				return 0, err
+			}
+		}
+		k := min(chunkSize-len(f.buf), len(p))
+		f.buf = append(f.buf, p[:k]...)
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// flush шифрует накопленный фрагмент и пишет его с длиной
+func (f *frameWriter) flush(last bool) error {
+	ct, err := crypto.EncryptData(f.key, f.buf, frameAD(f.prefix, f.index, last))
+	crypto.Wipe(f.buf)
+	f.buf = f.buf[:0]
+	if err != nil {
+		return err
+	}
+	f.index++
+	if err := binary.Write(f.w, binary.BigEndian, uint32(len(ct))); err != nil {
+		return err
+	}
+	_, err = f.w.Write(ct)
+	return err
+}
+
+// Close шифрует последний фрагмент; у пустого потока он тоже есть, только пустой
+func (f *frameWriter) Close() error {
+	return f.flush(true)
+}
+
+// frameReader расшифровывает фрагменты по одному. Конец файла до фрагмента с признаком
+// last и данные после него — признаки усечения или подмены.
+type frameReader struct {
+	r      io.Reader
+	key    []byte
+	prefix []byte
+	index  uint64
+	ct     []byte
+	plain  []byte
+	buf    []byte // ещё не отданная часть plain
+	done   bool
+}
+
+func newFrameReader(r io.Reader, key, prefix []byte) *frameReader {
+	return &frameReader{r: r, key: slices.Clone(key), prefix: prefix, ct: make([]byte, maxFrameSize)}
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.done {
+			return 0, io.EOF
+		}
+		if err := f.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// next читает и расшифровывает следующий фрагмент
+func (f *frameReader) next() error {
+	crypto.Wipe(f.plain)
+	f.plain, f.buf = nil, nil
+	var size uint32
+	if err := binary.Read(f.r, binary.BigEndian, &size); err != nil {
+		return ErrCorrupted
+	}
+	if size > maxFrameSize {
+		return ErrCorrupted
+	}
+	ct := f.ct[:size]
+	if _, err := io.ReadFull(f.r, ct); err != nil {
+		return ErrCorrupted
+	}
+	pt, err := crypto.DecryptData(f.key, ct, frameAD(f.prefix, f.index, false))
+	if err != nil {
+		if pt, err = crypto.DecryptData(f.key, ct, frameAD(f.prefix, f.index, true)); err != nil {
+			return ErrCorrupted
+		}
+		f.done = true
+		crypto.Wipe(f.key)
+		if _, err := io.ReadFull(f.r, make([]byte, 1)); err != io.EOF {
+			return ErrCorrupted
+		}
+	}
+	f.index++
+	f.plain, f.buf = pt, pt
+	return nil
+}
+
+// Close стирает ключ и расшифрованный фрагмент
+func (f *frameReader) Close() error {
+	crypto.Wipe(f.key)
+	crypto.Wipe(f.plain)
+	f.plain, f.buf = nil, nil
+	return nil
+}
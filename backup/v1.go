@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// legacySnapshot — содержимое копии версии 1: весь снимок одним JSON, вложения внутри записей
+type legacySnapshot struct {
+	Groups    []models.SnapshotGroup  `json:"groups"`
+	Entries   []legacyEntry           `json:"entries"`
+	History   models.HistoryRetention `json:"history"`
+	TrashDays int                     `json:"trash_days"`
+}
+
+type legacyEntry struct {
+	models.SnapshotEntry
+	Attachments []legacyAttachment `json:"attachments,omitempty"`
+}
+
+type legacyAttachment struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Data    []byte    `json:"data"`
+}
+
+// entry — запись в виде версии 2 и содержимое её вложений подряд
+func (e legacyEntry) entry() (models.SnapshotEntry, io.Reader) {
+	se := e.SnapshotEntry
+	var data []io.Reader
+	for _, att := range e.Attachments {
+		se.Attachments = append(se.Attachments, models.SnapshotAttachment{Name: att.Name, Created: att.Created, Size: int64(len(att.Data))})
+		data = append(data, bytes.NewReader(att.Data))
+	}
+	return se, io.MultiReader(data...)
+}
+
+// readLegacy расшифровывает копию версии 1: данные в ней — один шифротекст, поэтому
+// она читается в память целиком
+func readLegacy(r io.Reader, encKey, prefix []byte) (*Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := crypto.DecryptData(encKey, data, prefix)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	defer crypto.Wipe(plain)
+
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	var snap legacySnapshot
+	if err := json.NewDecoder(zr).Decode(&snap); err != nil {
+		return nil, corrupted(err)
+	}
+	return &Reader{
+		info: models.SnapshotInfo{
+			Groups:    snap.Groups,
+			Entries:   len(snap.Entries),
+			History:   snap.History,
+			TrashDays: snap.TrashDays,
+		},
+		legacy: snap.Entries,
+		left:   len(snap.Entries),
+		data:   bytes.NewReader(nil),
+	}, nil
+}
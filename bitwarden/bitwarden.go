@@ -0,0 +1,157 @@
+// Package bitwarden читает и пишет JSON-экспорт Bitwarden: открытый и защищённый паролем
+// (encrypted + passwordProtected). Перенос записей в базу PassLedger и обратно делает вызывающий.
+package bitwarden
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Типы элементов хранилища Bitwarden
+const (
+	TypeLogin      = 1
+	TypeSecureNote = 2
+	TypeCard       = 3
+	TypeIdentity   = 4
+	TypeSSHKey     = 5
+)
+
+// Типы пользовательских полей
+const (
+	FieldText    = 0
+	FieldHidden  = 1
+	FieldBoolean = 2
+	FieldLinked  = 3 // ссылка на поле логина, своего значения нет
+)
+
+// ErrPasswordRequired — экспорт защищён паролем, а пароль не указан
+var ErrPasswordRequired = errors.New("экспорт Bitwarden защищён паролем")
+
+// Export — содержимое открытого JSON-экспорта
+type Export struct {
+	Encrypted bool     `json:"encrypted"`
+	Folders   []Folder `json:"folders"`
+	Items     []Item   `json:"items"`
+}
+
+// Folder — папка; вложенность Bitwarden задаёт именем через «/»: «Работа/Проект»
+type Folder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Item — элемент хранилища. Карта, личность и SSH-ключ хранятся словарями
+// «ключ JSON → значение», чтобы не описывать каждое их поле отдельно.
+type Item struct {
+	PasswordHistory []PasswordHistory `json:"passwordHistory,omitempty"`
+	RevisionDate    string            `json:"revisionDate,omitempty"`
+	CreationDate    string            `json:"creationDate,omitempty"`
+	DeletedDate     string            `json:"deletedDate,omitempty"`
+	ID              string            `json:"id"`
+	FolderID        *string           `json:"folderId"`
+	Type            int               `json:"type"`
+	Reprompt        int               `json:"reprompt"`
+	Name            string            `json:"name"`
+	Notes           *string           `json:"notes"`
+	Favorite        bool              `json:"favorite"`
+	Fields          []Field           `json:"fields,omitempty"`
+	Login           *Login            `json:"login,omitempty"`
+	SecureNote      *SecureNote       `json:"secureNote,omitempty"`
+	Card            map[string]string `json:"card,omitempty"`
+	Identity        map[string]string `json:"identity,omitempty"`
+	SSHKey          map[string]string `json:"sshKey,omitempty"`
+}
+
+// Field — пользовательское поле элемента
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  int    `json:"type"`
+}
+
+// Login — данные входа
+type Login struct {
+	URIs     []URI  `json:"uris,omitempty"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	TOTP     string `json:"totp,omitempty"`
+}
+
+// URI — адрес сайта; match — правило сопоставления, для переноса не важно
+type URI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+// SecureNote — заметка; тип у Bitwarden всегда 0
+type SecureNote struct {
+	Type int `json:"type"`
+}
+
+// PasswordHistory — прежний пароль и когда он перестал действовать (RFC 3339)
+type PasswordHistory struct {
+	LastUsedDate string `json:"lastUsedDate"`
+	Password     string `json:"password"`
+}
+
+// header — общие поля открытого и зашифрованного экспорта
+type header struct {
+	Encrypted         bool `json:"encrypted"`
+	PasswordProtected bool `json:"passwordProtected"`
+}
+
+// NeedsPassword сообщает, защищён ли экспорт паролем
+func NeedsPassword(data []byte) (bool, error) {
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return false, fmt.Errorf("файл не является экспортом Bitwarden: %w", err)
+	}
+	return h.Encrypted && h.PasswordProtected, nil
+}
+
+// Decode разбирает экспорт; для защищённого паролем нужен password
+func Decode(data []byte, password string) (*Export, error) {
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("файл не является экспортом Bitwarden: %w", err)
+	}
+	if h.Encrypted {
+		if !h.PasswordProtected {
+			return nil, errors.New("экспорт зашифрован ключом учётной записи Bitwarden; выгрузите его заново в формате «JSON (Encrypted)» с типом «Защищённый паролем» или в открытом JSON")
+		}
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		plain, err := decrypt(data, password)
+		if err != nil {
+			return nil, err
+		}
+		data = plain
+	}
+	var e Export
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("некорректный экспорт Bitwarden: %w", err)
+	}
+	if e.Encrypted {
+		return nil, errors.New("некорректный экспорт Bitwarden: внутри зашифрованного файла снова зашифрованные данные")
+	}
+	return &e, nil
+}
+
+// Encode сериализует экспорт; непустой password включает защиту паролем
+func Encode(e *Export, password string) ([]byte, error) {
+	out := *e
+	out.Encrypted = false
+	if out.Folders == nil {
+		out.Folders = []Folder{}
+	}
+	if out.Items == nil {
+		out.Items = []Item{}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil || password == "" {
+		return data, err
+	}
+	return encrypt(data, password)
+}
@@ -0,0 +1,110 @@
+package bitwarden
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testExport() *Export {
+	folder := "f1"
+	notes := "заметка"
+	return &Export{
+		Folders: []Folder{{ID: folder, Name: "Работа/Проект"}},
+		Items: []Item{{
+			ID:       "i1",
+			FolderID: &folder,
+			Type:     TypeLogin,
+			Name:     "Сервер",
+			Notes:    &notes,
+			Fields:   []Field{{Name: "PIN", Value: "4321", Type: FieldHidden}},
+			Login: &Login{
+				URIs:     []URI{{URI: "ssh://srv.example.org"}},
+				Username: "admin",
+				Password: "s3cr3t-пароль",
+			},
+		}},
+	}
+}
+
+func TestEncodeDecodePassword(t *testing.T) {
+	want := testExport()
+	data, err := Encode(want, "пароль экспорта")
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if ok, err := NeedsPassword(data); err != nil || !ok {
+		t.Fatalf("NeedsPassword = %v, %v", ok, err)
+	}
+	got, err := Decode(data, "пароль экспорта")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("после Encode и Decode:\n%+v\nожидалось\n%+v", got, want)
+	}
+	if _, err := Decode(data, "другой пароль"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("неверный пароль: %v", err)
+	}
+	if _, err := Decode(data, ""); !errors.Is(err, ErrPasswordRequired) {
+		t.Errorf("без пароля: %v", err)
+	}
+}
+
+// Экспорт с Argon2id собирается вручную: сами мы пишем только PBKDF2
+func TestDecodeArgon2id(t *testing.T) {
+	plain, err := Encode(testExport(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory, parallelism := 16, 2
+	p := protected{
+		Encrypted:         true,
+		PasswordProtected: true,
+		Salt:              "c2FsdC1zdHJpbmc=",
+		KdfType:           kdfArgon2id,
+		KdfIterations:     3,
+		KdfMemory:         &memory,
+		KdfParallelism:    &parallelism,
+	}
+	encKey, macKey, err := deriveKeys("пароль", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.EncKeyValidation, err = encryptString([]byte(NewID()), encKey, macKey); err != nil {
+		t.Fatal(err)
+	}
+	if p.Data, err = encryptString(plain, encKey, macKey); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(data, "пароль")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, testExport()) {
+		t.Errorf("расшифровано %+v", got)
+	}
+	if _, err := Decode(data, "не тот"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("неверный пароль: %v", err)
+	}
+}
+
+// Параметры KDF из файла сверх пределов Bitwarden отклоняются до вывода ключа
+func TestKDFLimits(t *testing.T) {
+	memory, parallelism := 64, 4
+	tests := map[string]protected{
+		"итерации PBKDF2":  {KdfType: kdfPBKDF2, KdfIterations: 1 << 30},
+		"проходы Argon2id": {KdfType: kdfArgon2id, KdfIterations: 1 << 30, KdfMemory: &memory, KdfParallelism: &parallelism},
+		"нет памяти":       {KdfType: kdfArgon2id, KdfIterations: 3, KdfParallelism: &parallelism},
+	}
+	for name, p := range tests {
+		if _, _, err := deriveKeys("пароль", p); err == nil {
+			t.Errorf("%s: параметры приняты", name)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package bitwarden
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+)
+
+// Функции вывода ключа экспорта, защищённого паролем
+const (
+	kdfPBKDF2   = 0
+	kdfArgon2id = 1
+)
+
+// exportPBKDF2Iterations — значение по умолчанию в Bitwarden
+const exportPBKDF2Iterations = 600000
+
+// encString тип 2: AES-256-CBC с HMAC-SHA256 в формате «2.iv|шифротекст|mac» (всё в base64)
+const encTypeAESCBCHMAC = "2"
+
+var (
+	// ErrWrongPassword — пароль не подошёл к проверочному значению экспорта
+	ErrWrongPassword = errors.New("неверный пароль экспорта Bitwarden")
+	errCorrupted     = errors.New("повреждённые данные экспорта Bitwarden")
+)
+
+// protected — экспорт, защищённый паролем. data — зашифрованный открытый JSON-экспорт,
+// encKeyValidation — зашифрованная случайная строка для проверки пароля.
+type protected struct {
+	Encrypted         bool   `json:"encrypted"`
+	PasswordProtected bool   `json:"passwordProtected"`
+	Salt              string `json:"salt"`
+	KdfType           int    `json:"kdfType"`
+	KdfIterations     int    `json:"kdfIterations"`
+	KdfMemory         *int   `json:"kdfMemory"`      // МиБ, только Argon2id
+	KdfParallelism    *int   `json:"kdfParallelism"` // только Argon2id
+	EncKeyValidation  string `json:"encKeyValidation_DO_NOT_EDIT"`
+	Data              string `json:"data"`
+}
+
+// deriveKeys выводит ключ как Bitwarden: PBKDF2-SHA256 или Argon2id по паролю и соли-строке,
+// затем растягивает его HKDF-Expand в ключи шифрования и MAC
+func deriveKeys(password string, p protected) (encKey, macKey []byte, err error) {
+	var master []byte
+	switch p.KdfType {
+	case kdfPBKDF2:
+		if p.KdfIterations < 5000 || p.KdfIterations > 2000000 {
+			return nil, nil, fmt.Errorf("некорректное число итераций PBKDF2: %d", p.KdfIterations)
+		}
+		master = pbkdf2.Key([]byte(password), []byte(p.Salt), p.KdfIterations, 32, sha256.New)
+	case kdfArgon2id:
+		// Bitwarden допускает до 10 проходов, 1024 МиБ и 16 потоков
+		if p.KdfMemory == nil || p.KdfParallelism == nil ||
+			*p.KdfMemory < 1 || *p.KdfMemory > 1024 || *p.KdfParallelism < 1 || *p.KdfParallelism > 16 {
+			return nil, nil, errors.New("некорректные параметры Argon2id экспорта Bitwarden")
+		}
+		if p.KdfIterations < 1 || p.KdfIterations > 10 {
+			return nil, nil, fmt.Errorf("некорректное число проходов Argon2id: %d", p.KdfIterations)
+		}
+		// для Argon2 Bitwarden берёт в качестве соли SHA-256 от строки соли
+		salt := sha256.Sum256([]byte(p.Salt))
+		master = argon2.IDKey([]byte(password), salt[:], uint32(p.KdfIterations), uint32(*p.KdfMemory)*1024, uint8(*p.KdfParallelism), 32)
+	default:
+		return nil, nil, fmt.Errorf("неподдерживаемый тип KDF экспорта Bitwarden: %d", p.KdfType)
+	}
+	defer crypto.Wipe(master)
+
+	encKey, macKey = make([]byte, 32), make([]byte, 32)
+	if _, err := hkdf.Expand(sha256.New, master, []byte("enc")).Read(encKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err := hkdf.Expand(sha256.New, master, []byte("mac")).Read(macKey); err != nil {
+		return nil, nil, err
+	}
+	return encKey, macKey, nil
+}
+
+func decrypt(data []byte, password string) ([]byte, error) {
+	var p protected
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("некорректный экспорт Bitwarden: %w", err)
+	}
+	encKey, macKey, err := deriveKeys(password, p)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(encKey)
+	defer crypto.Wipe(macKey)
+
+	if _, err := decryptString(p.EncKeyValidation, encKey, macKey); err != nil {
+		return nil, ErrWrongPassword
+	}
+	return decryptString(p.Data, encKey, macKey)
+}
+
+func encrypt(plain []byte, password string) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	p := protected{
+		Encrypted:         true,
+		PasswordProtected: true,
+		Salt:              base64.StdEncoding.EncodeToString(salt),
+		KdfType:           kdfPBKDF2,
+		KdfIterations:     exportPBKDF2Iterations,
+	}
+	encKey, macKey, err := deriveKeys(password, p)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(encKey)
+	defer crypto.Wipe(macKey)
+
+	if p.EncKeyValidation, err = encryptString([]byte(NewID()), encKey, macKey); err != nil {
+		return nil, err
+	}
+	if p.Data, err = encryptString(plain, encKey, macKey); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// decryptString проверяет MAC и расшифровывает encString типа 2
+func decryptString(s string, encKey, macKey []byte) ([]byte, error) {
+	typ, rest, ok := strings.Cut(s, ".")
+	if !ok || typ != encTypeAESCBCHMAC {
+		return nil, errors.New("неподдерживаемый формат шифрования экспорта Bitwarden")
+	}
+	parts := strings.Split(rest, "|")
+	if len(parts) != 3 {
+		return nil, errCorrupted
+	}
+	var raw [3][]byte
+	for i, part := range parts {
+		b, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return nil, errCorrupted
+		}
+		raw[i] = b
+	}
+	iv, ct, tag := raw[0], raw[1], raw[2]
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ct)
+	if !hmac.Equal(tag, mac.Sum(nil)) {
+		return nil, errCorrupted
+	}
+	if len(iv) != aes.BlockSize || len(ct) == 0 || len(ct)%aes.BlockSize != 0 {
+		return nil, errCorrupted
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, ct)
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(out[len(out)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errCorrupted
+	}
+	return out[:len(out)-pad], nil
+}
+
+func encryptString(plain, encKey, macKey []byte) (string, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return "", err
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	ct := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, ct)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ct)
+	enc := base64.StdEncoding.EncodeToString
+	return encTypeAESCBCHMAC + "." + enc(iv) + "|" + enc(ct) + "|" + enc(mac.Sum(nil)), nil
+}
+
+// NewID — случайный UUID версии 4 для id папок и элементов, как у Bitwarden
+func NewID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
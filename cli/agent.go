@@ -0,0 +1,376 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// DefaultAgentTimeout — через сколько простоя агент забывает ключ и завершается
+const DefaultAgentTimeout = 15 * time.Minute
+
+// agentRequest — запрос к агенту, одна JSON-строка на соединение
+type agentRequest struct {
+	Op      string                `json:"op"`
+	Entry   *models.PasswordEntry `json:"entry,omitempty"`
+	ID      int                   `json:"id,omitempty"`
+	Name    string                `json:"name,omitempty"`
+	NewName string                `json:"new_name,omitempty"`
+	Parent  string                `json:"parent,omitempty"`
+}
+
+// agentResponse — ответ агента
+type agentResponse struct {
+	Error   string                 `json:"error,omitempty"`
+	Entries []models.PasswordEntry `json:"entries,omitempty"`
+	Groups  []models.Groups        `json:"groups,omitempty"`
+}
+
+// операции протокола агента
+const (
+	opEntries     = "entries"
+	opAddEntry    = "add_entry"
+	opUpdateEntry = "update_entry"
+	opDeleteEntry = "delete_entry"
+	opGroups      = "groups"
+	opAddGroup    = "add_group"
+	opMoveGroup   = "move_group"
+	opRenameGroup = "rename_group"
+	opDeleteGroup = "delete_group"
+	opLock        = "lock"
+)
+
+// agentSocketPath — путь к сокету агента для базы dbPath. Сокет лежит в каталоге,
+// доступном только владельцу, а имя зависит от пути к базе, чтобы агенты разных баз не пересекались.
+func agentSocketPath(dbPath string) (string, error) {
+	abs, err := filepath.Abs(dbPath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	dir = filepath.Join(dir, fmt.Sprintf("passledger-%d", os.Getuid()))
+	return filepath.Join(dir, "agent-"+hex.EncodeToString(sum[:6])+".sock"), nil
+}
+
+// prepareSocketDir создаёт каталог сокета с правами 0700. Каталог, заранее созданный
+// другим пользователем (например, в общем /tmp), не используется.
+func prepareSocketDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s не является каталогом", dir)
+	}
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		return fmt.Errorf("каталог сокета %s принадлежит другому пользователю (uid %d): удалите его или задайте XDG_RUNTIME_DIR", dir, uid)
+	}
+	if info.Mode().Perm() != 0700 {
+		return os.Chmod(dir, 0700)
+	}
+	return nil
+}
+
+// errPeerUnknown — платформа не сообщает, от какого пользователя пришло соединение
+var errPeerUnknown = errors.New("владелец соединения неизвестен")
+
+// checkPeer отклоняет соединения от других пользователей. Права каталога сокета и так
+// не пускают их к агенту; проверка нужна на случай, если права окажутся шире.
+func checkPeer(conn net.Conn) error {
+	uid, err := peerUID(conn)
+	if errors.Is(err, errPeerUnknown) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("соединение от другого пользователя (uid %d)", uid)
+	}
+	return nil
+}
+
+// controlConn вызывает f с дескриптором Unix-сокета соединения
+func controlConn(conn net.Conn, f func(fd int) error) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errors.New("соединение не через Unix-сокет")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := raw.Control(func(fd uintptr) { ferr = f(int(fd)) }); err != nil {
+		return err
+	}
+	return ferr
+}
+
+// cmdAgent открывает базу и держит ключ в памяти, обслуживая команды через Unix-сокет
+func cmdAgent(e *env, args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", DefaultAgentTimeout, "")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	socketPath, err := agentSocketPath(e.opts.dbPath)
+	if err != nil {
+		return err
+	}
+	if client, ok := dialAgent(e.opts.dbPath); ok {
+		client.close()
+		return errors.New("агент для этой базы уже запущен")
+	}
+
+	v, err := openLocalVault(e)
+	if err != nil {
+		return err
+	}
+	defer v.close()
+
+	if err := prepareSocketDir(filepath.Dir(socketPath)); err != nil {
+		return err
+	}
+	os.Remove(socketPath) // сокет от аварийно завершённого агента
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stderr, "Агент запущен: %s\n", socketPath)
+	reason := serveAgent(listener, v, *timeout)
+	fmt.Fprintf(e.stderr, "Агент остановлен: %s\n", reason)
+	return nil
+}
+
+// serveAgent обслуживает соединения до команды lock, сигнала или истечения таймаута простоя
+func serveAgent(listener net.Listener, v vault, timeout time.Duration) string {
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.NewTimer(timeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	// при выходе mu остаётся захваченным: текущий запрос завершится,
+	// а новые не начнутся до закрытия базы
+	var mu sync.Mutex
+	defer mu.Lock()
+	locked := make(chan struct{})
+	var lockOnce sync.Once
+	for {
+		select {
+		case conn, ok := <-conns:
+			if !ok {
+				return "сокет закрыт"
+			}
+			if timer != nil {
+				timer.Reset(timeout)
+			}
+			go func() {
+				defer conn.Close()
+				if checkPeer(conn) != nil {
+					return
+				}
+				conn.SetDeadline(time.Now().Add(30 * time.Second))
+				var req agentRequest
+				if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+					return
+				}
+				if req.Op == opLock {
+					json.NewEncoder(conn).Encode(agentResponse{})
+					lockOnce.Do(func() { close(locked) })
+					return
+				}
+				mu.Lock()
+				resp := handleAgentRequest(v, req)
+				mu.Unlock()
+				json.NewEncoder(conn).Encode(resp)
+			}()
+		case <-locked:
+			return "заблокирован командой lock"
+		case <-idle:
+			return "истёк таймаут простоя"
+		case <-signals:
+			return "получен сигнал завершения"
+		}
+	}
+}
+
+func handleAgentRequest(v vault, req agentRequest) (resp agentResponse) {
+	var err error
+	switch req.Op {
+	case opEntries:
+		resp.Entries, err = v.entries()
+	case opAddEntry, opUpdateEntry:
+		if req.Entry == nil {
+			err = errors.New("запрос без записи")
+		} else if req.Op == opAddEntry {
+			err = v.addEntry(*req.Entry)
+		} else {
+			err = v.updateEntry(*req.Entry)
+		}
+	case opDeleteEntry:
+		err = v.deleteEntry(req.ID)
+	case opGroups:
+		resp.Groups, err = v.groups()
+	case opAddGroup:
+		err = v.addGroup(req.Name, req.Parent)
+	case opMoveGroup:
+		err = v.moveGroup(req.Name, req.Parent)
+	case opRenameGroup:
+		err = v.renameGroup(req.Name, req.NewName)
+	case opDeleteGroup:
+		err = v.deleteGroup(req.Name)
+	default:
+		err = fmt.Errorf("неизвестная операция %q", req.Op)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return
+}
+
+// cmdLock просит агента забыть ключ и завершиться
+func cmdLock(e *env, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("%w: lock не принимает аргументов", errUsage)
+	}
+	client, ok := dialAgent(e.opts.dbPath)
+	if !ok {
+		return errors.New("агент для этой базы не запущен")
+	}
+	_, err := client.call(agentRequest{Op: opLock})
+	return err
+}
+
+// agentClient — vault, который выполняет команды через запущенного агента
+type agentClient struct {
+	socketPath string
+}
+
+// dialAgent проверяет, что агент для базы dbPath запущен и отвечает
+func dialAgent(dbPath string) (*agentClient, bool) {
+	socketPath, err := agentSocketPath(dbPath)
+	if err != nil {
+		return nil, false
+	}
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return nil, false
+	}
+	conn.Close()
+	return &agentClient{socketPath: socketPath}, true
+}
+
+func (c *agentClient) call(req agentRequest) (agentResponse, error) {
+	var resp agentResponse
+	conn, err := net.DialTimeout("unix", c.socketPath, time.Second)
+	if err != nil {
+		return resp, fmt.Errorf("агент недоступен: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("ошибка ответа агента: %w", err)
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+func (c *agentClient) close() error {
+	return nil
+}
+
+func (c *agentClient) entries() ([]models.PasswordEntry, error) {
+	resp, err := c.call(agentRequest{Op: opEntries})
+	return resp.Entries, err
+}
+
+func (c *agentClient) addEntry(e models.PasswordEntry) error {
+	_, err := c.call(agentRequest{Op: opAddEntry, Entry: &e})
+	return err
+}
+
+func (c *agentClient) updateEntry(e models.PasswordEntry) error {
+	_, err := c.call(agentRequest{Op: opUpdateEntry, Entry: &e})
+	return err
+}
+
+func (c *agentClient) deleteEntry(id int) error {
+	_, err := c.call(agentRequest{Op: opDeleteEntry, ID: id})
+	return err
+}
+
+func (c *agentClient) groups() ([]models.Groups, error) {
+	resp, err := c.call(agentRequest{Op: opGroups})
+	return resp.Groups, err
+}
+
+func (c *agentClient) addGroup(name, parent string) error {
+	_, err := c.call(agentRequest{Op: opAddGroup, Name: name, Parent: parent})
+	return err
+}
+
+func (c *agentClient) moveGroup(path, parent string) error {
+	_, err := c.call(agentRequest{Op: opMoveGroup, Name: path, Parent: parent})
+	return err
+}
+
+func (c *agentClient) renameGroup(path, newName string) error {
+	_, err := c.call(agentRequest{Op: opRenameGroup, Name: path, NewName: newName})
+	return err
+}
+
+func (c *agentClient) deleteGroup(path string) error {
+	_, err := c.call(agentRequest{Op: opDeleteGroup, Name: path})
+	return err
+}
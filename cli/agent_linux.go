@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerUID возвращает uid процесса на другом конце соединения (SO_PEERCRED)
+func peerUID(conn net.Conn) (int, error) {
+	var uid int
+	err := controlConn(conn, func(fd int) error {
+		cred, err := unix.GetsockoptUcred(fd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+		if err != nil {
+			return err
+		}
+		uid = int(cred.Uid)
+		return nil
+	})
+	return uid, err
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cli
+
+import "os"
+
+// fileOwner на платформах без uid владельца не определяет
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
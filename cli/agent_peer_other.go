@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package cli
+
+import "net"
+
+// peerUID здесь не поддерживается: от чужих пользователей защищают права каталога сокета
+func peerUID(conn net.Conn) (int, error) {
+	return 0, errPeerUnknown
+}
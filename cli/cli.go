@@ -0,0 +1,177 @@
+// Package cli — консольный режим PassLedger: работа с базой из терминала и по SSH.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/reinbowARA/PassLedger/config"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+const usage = `Использование: passledger [общие флаги] <команда> [аргументы]
+
+Общие флаги:
+  -db PATH            путь к базе (по умолчанию из settings.json)
+  -keyfile PATH       ключевой файл (по умолчанию из settings.json)
+  -password-stdin     читать мастер-пароль из первой строки stdin
+  -json               вывод в формате JSON
+  -no-agent           не обращаться к агенту, открыть базу самостоятельно
+
+Команды:
+  ls [-group G] [-tag T] [-q ТЕКСТ]  список записей (-group — вместе с подгруппами; группы
+                                      задаются путём: Работа/Почта)
+  get ID|НАЗВАНИЕ [-show] [-field F]  показать запись (F: title, username, password, url, notes, group,
+                                      tags, otp — текущий код TOTP — или имя дополнительного поля)
+  add -title T [-user U] [-url U] [-notes N] [-group G] [-tags T1,T2] [-otp] [-gen [-length N]]
+                                      добавить запись (пароль запрашивается, если не -gen;
+                                      -otp запрашивает секрет TOTP)
+  edit ID|НАЗВАНИЕ [-title T] [-user U] [-url U] [-notes N] [-group G] [-tags T1,T2] [-password] [-otp] [-gen [-length N]]
+                                      изменить указанные поля записи (-tags "" снимает все теги,
+                                      пустой секрет -otp убирает TOTP)
+  rm ID|НАЗВАНИЕ                      переместить запись в корзину
+  groups                              дерево групп
+  group add ИМЯ [-parent ПУТЬ] | group rename ПУТЬ НОВОЕ_ИМЯ | group move ПУТЬ [РОДИТЕЛЬ] | group rm ПУТЬ -y
+                                      управление группами (move без родителя — на верхний уровень,
+                                      rm перемещает в корзину подгруппы и записи группы)
+  gen [-length N] [-no-upper] [-no-lower] [-no-digits] [-no-special] [-space] [-brackets]
+                                      сгенерировать пароль
+  agent [-timeout 15m]                разблокировать базу один раз и обслуживать команды
+                                      через Unix-сокет (0 — без таймаута простоя)
+  lock                                забыть ключ и остановить агента
+`
+
+// errUsage — ошибка в аргументах командной строки
+var errUsage = errors.New("неверные аргументы")
+
+// globalOptions — общие флаги всех команд
+type globalOptions struct {
+	dbPath        string
+	keyfilePath   string
+	passwordStdin bool
+	json          bool
+	noAgent       bool
+}
+
+// command — подкоманда; vault открывается только для команд, которым нужна база
+type command struct {
+	needVault bool
+	run       func(env *env, args []string) error
+}
+
+var commands = map[string]command{
+	"ls":     {needVault: true, run: cmdList},
+	"get":    {needVault: true, run: cmdGet},
+	"add":    {needVault: true, run: cmdAdd},
+	"edit":   {needVault: true, run: cmdEdit},
+	"rm":     {needVault: true, run: cmdRemove},
+	"groups": {needVault: true, run: cmdGroups},
+	"group":  {needVault: true, run: cmdGroup},
+	"gen":    {needVault: false, run: cmdGenerate},
+	"agent":  {needVault: false, run: cmdAgent},
+	"lock":   {needVault: false, run: cmdLock},
+}
+
+// env — окружение выполнения команды
+type env struct {
+	opts   globalOptions
+	vault  vault
+	prompt *prompter
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// IsCommand сообщает, запускает ли аргумент консольный режим: команда или общий флаг
+func IsCommand(arg string) bool {
+	if _, ok := commands[arg]; ok || arg == "help" {
+		return true
+	}
+	if !strings.HasPrefix(arg, "-") {
+		return false
+	}
+	name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	switch name {
+	case "db", "keyfile", "password-stdin", "json", "no-agent", "h", "help":
+		return true
+	}
+	return false
+}
+
+// Run выполняет консольную команду и возвращает код завершения
+func Run(args []string) int {
+	e := &env{stdout: os.Stdout, stderr: os.Stderr, prompt: newPrompter(os.Stdin, os.Stderr)}
+	err := run(e, args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		fmt.Fprint(e.stdout, usage)
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(e.stderr, "passledger: %v\n\n%s", err, usage)
+		return 2
+	default:
+		fmt.Fprintf(e.stderr, "passledger: %v\n", err)
+		return 1
+	}
+}
+
+func run(e *env, args []string) error {
+	settings, _ := config.Load()
+
+	fs := flag.NewFlagSet("passledger", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&e.opts.dbPath, "db", settings.DBPath, "")
+	fs.StringVar(&e.opts.keyfilePath, "keyfile", settings.KeyfilePath, "")
+	fs.BoolVar(&e.opts.passwordStdin, "password-stdin", false, "")
+	fs.BoolVar(&e.opts.json, "json", false, "")
+	fs.BoolVar(&e.opts.noAgent, "no-agent", false, "")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() == 0 || fs.Arg(0) == "help" {
+		return flag.ErrHelp
+	}
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("%w: неизвестная команда %q", errUsage, name)
+	}
+	if e.opts.dbPath == "" {
+		e.opts.dbPath = models.DefaultDBPath
+	}
+
+	if cmd.needVault {
+		v, err := openVault(e)
+		if err != nil {
+			return err
+		}
+		defer v.close()
+		e.vault = v
+	}
+	return cmd.run(e, fs.Args()[1:])
+}
+
+// parseArgs разбирает флаги подкоманды, допуская их после позиционных аргументов
+// (passledger get 5 -show)
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
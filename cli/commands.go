@@ -0,0 +1,414 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// findEntry ищет запись по id или (без учёта регистра) по названию
+func findEntry(entries []models.PasswordEntry, ref string) (models.PasswordEntry, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		for _, e := range entries {
+			if e.ID == id {
+				return e, nil
+			}
+		}
+		return models.PasswordEntry{}, fmt.Errorf("запись с id %d не найдена", id)
+	}
+	var found []models.PasswordEntry
+	for _, e := range entries {
+		if strings.EqualFold(e.Title, ref) {
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return models.PasswordEntry{}, fmt.Errorf("запись %q не найдена", ref)
+	case 1:
+		return found[0], nil
+	default:
+		ids := make([]string, len(found))
+		for i, e := range found {
+			ids[i] = strconv.Itoa(e.ID)
+		}
+		return models.PasswordEntry{}, fmt.Errorf("несколько записей с названием %q (id: %s), укажите id", ref, strings.Join(ids, ", "))
+	}
+}
+
+// entryRef разбирает флаги команды и возвращает единственный позиционный аргумент — ссылку на запись
+func entryRef(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 1 {
+		return "", fmt.Errorf("%w: укажите id или название записи", errUsage)
+	}
+	return positional[0], nil
+}
+
+func cmdList(e *env, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	group := fs.String("group", "", "")
+	tag := fs.String("tag", "", "")
+	query := fs.String("q", "", "")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	entries, err := e.vault.entries()
+	if err != nil {
+		return err
+	}
+	// -group ПУТЬ показывает и записи подгрупп
+	q := strings.ToLower(*query)
+	out := make([]models.PasswordEntry, 0, len(entries))
+	for _, entry := range entries {
+		if *group != "" && !db.InGroup(entry.Group, db.JoinGroupPath(*group)) {
+			continue
+		}
+		if *tag != "" && !slices.Contains(entry.Tags, *tag) {
+			continue
+		}
+		if q != "" && !strings.Contains(strings.ToLower(entry.Title), q) &&
+			!strings.Contains(strings.ToLower(entry.Username), q) &&
+			!strings.Contains(strings.ToLower(entry.URL), q) {
+			continue
+		}
+		entry.Password = ""
+		entry.OTP = ""
+		out = append(out, entry)
+	}
+	return printEntries(e, out)
+}
+
+func cmdGet(e *env, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	show := fs.Bool("show", false, "")
+	field := fs.String("field", "", "")
+	ref, err := entryRef(fs, args)
+	if err != nil {
+		return err
+	}
+
+	entries, err := e.vault.entries()
+	if err != nil {
+		return err
+	}
+	entry, err := findEntry(entries, ref)
+	if err != nil {
+		return err
+	}
+	if entry.OTP != "" {
+		p, err := crypto.ParseOTP(entry.OTP)
+		if err != nil {
+			return err
+		}
+		entry.OTPCode, _ = crypto.TOTP(p, time.Now())
+		crypto.Wipe(p.Secret)
+	}
+	if *field != "" {
+		value, err := entryField(entry, *field)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, value)
+		return nil
+	}
+	if !*show {
+		entry.Password = ""
+		entry.OTP = ""
+		entry.Fields = append([]models.CustomField(nil), entry.Fields...)
+		for i := range entry.Fields {
+			if entry.Fields[i].Type == models.FieldHidden {
+				entry.Fields[i].Value = ""
+			}
+		}
+	}
+	return printEntry(e, entry)
+}
+
+func entryField(entry models.PasswordEntry, field string) (string, error) {
+	switch field {
+	case "title":
+		return entry.Title, nil
+	case "username":
+		return entry.Username, nil
+	case "password":
+		return entry.Password, nil
+	case "url":
+		return entry.URL, nil
+	case "notes":
+		return entry.Notes, nil
+	case "group":
+		return entry.Group, nil
+	case "tags":
+		return strings.Join(entry.Tags, ","), nil
+	case "otp":
+		if entry.OTP == "" {
+			return "", fmt.Errorf("у записи %q нет секрета TOTP", entry.Title)
+		}
+		return entry.OTPCode, nil
+	}
+	for _, f := range entry.Fields {
+		if f.Name == field {
+			return f.Value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: неизвестное поле %q", errUsage, field)
+}
+
+// entryFlags — флаги полей записи, общие для add и edit
+type entryFlags struct {
+	title, username, url, notes, group, tags *string
+	generate, otp                            *bool
+	length                                   *int
+}
+
+func newEntryFlags(fs *flag.FlagSet) entryFlags {
+	return entryFlags{
+		title:    fs.String("title", "", ""),
+		username: fs.String("user", "", ""),
+		url:      fs.String("url", "", ""),
+		notes:    fs.String("notes", "", ""),
+		group:    fs.String("group", "", ""),
+		tags:     fs.String("tags", "", ""),
+		generate: fs.Bool("gen", false, ""),
+		otp:      fs.Bool("otp", false, ""),
+		length:   fs.Int("length", 16, ""),
+	}
+}
+
+// entryPassword генерирует пароль записи (-gen) или запрашивает его
+func entryPassword(e *env, f entryFlags) (string, error) {
+	if *f.generate {
+		return crypto.GeneratePassword(defaultGeneratorOptions(*f.length))
+	}
+	secret, err := e.prompt.newSecret("Пароль записи: ")
+	defer crypto.Wipe(secret)
+	return string(secret), err
+}
+
+// entryOTP запрашивает секрет TOTP (-otp) и проверяет его; пустая строка убирает TOTP из записи
+func entryOTP(e *env) (string, error) {
+	raw, err := e.prompt.secret("Секрет TOTP (otpauth://totp/... или base32, пусто — убрать): ", false)
+	defer crypto.Wipe(raw)
+	if err != nil {
+		return "", err
+	}
+	secret := string(bytes.TrimSpace(raw))
+	if secret != "" {
+		p, err := crypto.ParseOTP(secret)
+		if err != nil {
+			return "", err
+		}
+		crypto.Wipe(p.Secret)
+	}
+	return secret, nil
+}
+
+func cmdAdd(e *env, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	f := newEntryFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("%w: лишние аргументы: %s", errUsage, strings.Join(positional, " "))
+	}
+	if *f.title == "" {
+		return fmt.Errorf("%w: укажите -title", errUsage)
+	}
+	password, err := entryPassword(e, f)
+	if err != nil {
+		return err
+	}
+	var otp string
+	if *f.otp {
+		if otp, err = entryOTP(e); err != nil {
+			return err
+		}
+	}
+	entry := models.PasswordEntry{
+		Title:    *f.title,
+		Username: *f.username,
+		Password: password,
+		URL:      *f.url,
+		Notes:    *f.notes,
+		Group:    *f.group,
+		Tags:     db.ParseTags(*f.tags),
+		OTP:      otp,
+	}
+	if err := e.vault.addEntry(entry); err != nil {
+		return err
+	}
+	if *f.generate {
+		return printValue(e, "password", password)
+	}
+	return nil
+}
+
+func cmdEdit(e *env, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	f := newEntryFlags(fs)
+	changePassword := fs.Bool("password", false, "")
+	ref, err := entryRef(fs, args)
+	if err != nil {
+		return err
+	}
+
+	entries, err := e.vault.entries()
+	if err != nil {
+		return err
+	}
+	entry, err := findEntry(entries, ref)
+	if err != nil {
+		return err
+	}
+
+	// меняем только явно указанные поля
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "title":
+			entry.Title = *f.title
+		case "user":
+			entry.Username = *f.username
+		case "url":
+			entry.URL = *f.url
+		case "notes":
+			entry.Notes = *f.notes
+		case "group":
+			entry.Group = *f.group
+		case "tags":
+			entry.Tags = db.ParseTags(*f.tags)
+		}
+	})
+	if *changePassword || *f.generate {
+		entry.Password, err = entryPassword(e, f)
+		if err != nil {
+			return err
+		}
+	}
+	if *f.otp {
+		if entry.OTP, err = entryOTP(e); err != nil {
+			return err
+		}
+	}
+	if err := e.vault.updateEntry(entry); err != nil {
+		return err
+	}
+	if *f.generate {
+		return printValue(e, "password", entry.Password)
+	}
+	return nil
+}
+
+func cmdRemove(e *env, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	ref, err := entryRef(fs, args)
+	if err != nil {
+		return err
+	}
+	entries, err := e.vault.entries()
+	if err != nil {
+		return err
+	}
+	entry, err := findEntry(entries, ref)
+	if err != nil {
+		return err
+	}
+	return e.vault.deleteEntry(entry.ID)
+}
+
+func cmdGroups(e *env, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("%w: groups не принимает аргументов", errUsage)
+	}
+	groups, err := e.vault.groups()
+	if err != nil {
+		return err
+	}
+	return printGroups(e, groups)
+}
+
+func cmdGroup(e *env, args []string) error {
+	fs := flag.NewFlagSet("group", flag.ContinueOnError)
+	confirm := fs.Bool("y", false, "")
+	parent := fs.String("parent", "", "")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("%w: укажите add, rename, move или rm", errUsage)
+	}
+
+	switch sub, rest := positional[0], positional[1:]; {
+	case sub == "add" && len(rest) == 1:
+		return e.vault.addGroup(rest[0], *parent)
+	case sub == "rename" && len(rest) == 2:
+		return e.vault.renameGroup(rest[0], rest[1])
+	case sub == "move" && (len(rest) == 1 || len(rest) == 2):
+		// без родителя группа переносится на верхний уровень
+		return e.vault.moveGroup(rest[0], strings.Join(rest[1:], ""))
+	case sub == "rm" && len(rest) == 1:
+		if !*confirm {
+			return errors.New("группа перемещается в корзину вместе со всеми записями, подтвердите флагом -y")
+		}
+		return e.vault.deleteGroup(rest[0])
+	default:
+		return fmt.Errorf("%w: group add ИМЯ [-parent ПУТЬ] | group rename ПУТЬ НОВОЕ_ИМЯ | group move ПУТЬ [РОДИТЕЛЬ] | group rm ПУТЬ -y", errUsage)
+	}
+}
+
+func defaultGeneratorOptions(length int) models.PasswordGeneratorOptions {
+	return models.PasswordGeneratorOptions{
+		Length:       length,
+		UseUppercase: true,
+		UseLowercase: true,
+		UseDigits:    true,
+		UseSpecial:   true,
+	}
+}
+
+func cmdGenerate(e *env, args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	length := fs.Int("length", 16, "")
+	noUpper := fs.Bool("no-upper", false, "")
+	noLower := fs.Bool("no-lower", false, "")
+	noDigits := fs.Bool("no-digits", false, "")
+	noSpecial := fs.Bool("no-special", false, "")
+	space := fs.Bool("space", false, "")
+	brackets := fs.Bool("brackets", false, "")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if *length < 1 {
+		return fmt.Errorf("%w: неверная длина", errUsage)
+	}
+	options := models.PasswordGeneratorOptions{
+		Length:       *length,
+		UseUppercase: !*noUpper,
+		UseLowercase: !*noLower,
+		UseDigits:    !*noDigits,
+		UseSpecial:   !*noSpecial,
+		UseSpace:     *space,
+		UseBrackets:  *brackets,
+	}
+	password, err := crypto.GeneratePassword(options)
+	if err != nil {
+		return err
+	}
+	return printValue(e, "password", password)
+}
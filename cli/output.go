@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+func printJSON(e *env, v any) error {
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printEntries(e *env, entries []models.PasswordEntry) error {
+	if e.opts.json {
+		return printJSON(e, entries)
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\t%s\t%s\t%s\t%s\n", models.TITLE, models.LOGIN, models.URL, models.GROUP)
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", entry.ID, entry.Title, entry.Username, entry.URL, entry.Group)
+	}
+	return w.Flush()
+}
+
+func printEntry(e *env, entry models.PasswordEntry) error {
+	if e.opts.json {
+		return printJSON(e, entry)
+	}
+	password := entry.Password
+	if password == "" {
+		password = "******** (показать: -show)"
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%d\n", entry.ID)
+	fmt.Fprintf(w, "%s:\t%s\n", models.TITLE, entry.Title)
+	fmt.Fprintf(w, "%s:\t%s\n", models.GROUP, entry.Group)
+	fmt.Fprintf(w, "%s:\t%s\n", models.LOGIN, entry.Username)
+	fmt.Fprintf(w, "%s:\t%s\n", models.PASSWD, password)
+	fmt.Fprintf(w, "%s:\t%s\n", models.URL, entry.URL)
+	fmt.Fprintf(w, "%s:\t%s\n", models.NOTES, entry.Notes)
+	if entry.OTPCode != "" {
+		fmt.Fprintf(w, "TOTP:\t%s\n", entry.OTPCode)
+	}
+	if entry.OTP != "" {
+		fmt.Fprintf(w, "%s:\t%s\n", models.OTP, entry.OTP)
+	}
+	if len(entry.Tags) > 0 {
+		fmt.Fprintf(w, "%s:\t%s\n", models.TAGS, strings.Join(entry.Tags, ", "))
+	}
+	for _, f := range entry.Fields {
+		value := f.Value
+		if f.Type == models.FieldHidden && value == "" {
+			value = "******** (показать: -show)"
+		}
+		fmt.Fprintf(w, "%s:\t%s\n", f.Name, value)
+	}
+	fmt.Fprintf(w, "%s:\t%s\n", models.CREATED, formatTime(entry.Created))
+	fmt.Fprintf(w, "%s:\t%s\n", models.MODIFIED, formatTime(entry.Modified))
+	fmt.Fprintf(w, "%s:\t%s\n", models.PASSWORD_CHANGED, formatTime(entry.PasswordChanged))
+	fmt.Fprintf(w, "%s:\t%s\n", models.LAST_USED, formatTime(entry.LastUsed))
+	return w.Flush()
+}
+
+// formatTime выводит отметку времени записи; нулевое время — «—»
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "—"
+	}
+	return t.Format("02.01.2006 15:04")
+}
+
+func printGroups(e *env, groups []models.Groups) error {
+	if e.opts.json {
+		if groups == nil {
+			groups = []models.Groups{}
+		}
+		return printJSON(e, groups)
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\t%s\n", models.GROUP)
+	// подгруппы выводятся под родителем с отступом
+	children := map[int][]models.Groups{}
+	known := map[int]bool{}
+	for _, g := range groups {
+		known[g.Id] = true
+	}
+	for _, g := range groups {
+		parent := g.ParentId
+		if !known[parent] {
+			parent = 0
+		}
+		children[parent] = append(children[parent], g)
+	}
+	var walk func(parent, depth int)
+	walk = func(parent, depth int) {
+		for _, g := range children[parent] {
+			fmt.Fprintf(w, "%s\t%s%s\n", strconv.Itoa(g.Id), strings.Repeat("  ", depth), g.Name)
+			walk(g.Id, depth+1)
+		}
+	}
+	walk(0, 0)
+	return w.Flush()
+}
+
+// printValue выводит одиночное значение: как есть или {"name": value} с -json
+func printValue(e *env, name, value string) error {
+	if e.opts.json {
+		return printJSON(e, map[string]string{name: value})
+	}
+	_, err := fmt.Fprintln(e.stdout, value)
+	return err
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+)
+
+// prompter читает секреты: с терминала без эха или построчно из stdin,
+// если stdin не терминал (скрипты, конвейеры)
+type prompter struct {
+	in     *os.File
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func newPrompter(in *os.File, out io.Writer) *prompter {
+	return &prompter{in: in, reader: bufio.NewReader(in), out: out}
+}
+
+// isTerminal сообщает, подключён ли stdin к терминалу
+func (p *prompter) isTerminal() bool {
+	return term.IsTerminal(int(p.in.Fd()))
+}
+
+// readLine читает одну строку из stdin без завершающего перевода строки
+func (p *prompter) readLine() ([]byte, error) {
+	line, err := p.reader.ReadBytes('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || len(line) == 0) {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("stdin закончился раньше, чем ожидалось")
+		}
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// secret запрашивает секрет: на терминале — без эха, иначе — строкой из stdin.
+// Секрет возвращается в []byte, чтобы вызывающий мог затереть его после использования.
+func (p *prompter) secret(label string, forceStdin bool) ([]byte, error) {
+	if forceStdin || !p.isTerminal() {
+		return p.readLine()
+	}
+	fmt.Fprint(p.out, label)
+	b, err := term.ReadPassword(int(p.in.Fd()))
+	fmt.Fprintln(p.out)
+	if err != nil {
+		crypto.Wipe(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// newSecret запрашивает новый секрет; на терминале — дважды для подтверждения
+func (p *prompter) newSecret(label string) ([]byte, error) {
+	first, err := p.secret(label, false)
+	if err != nil || !p.isTerminal() {
+		return first, err
+	}
+	second, err := p.secret("Повторите: ", false)
+	if err != nil {
+		crypto.Wipe(first)
+		return nil, err
+	}
+	defer crypto.Wipe(second)
+	if !bytes.Equal(first, second) {
+		crypto.Wipe(first)
+		return nil, errors.New("значения не совпадают")
+	}
+	return first, nil
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/db"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// vault — хранилище, с которым работают команды: открытая база или запущенный агент
+type vault interface {
+	entries() ([]models.PasswordEntry, error)
+	addEntry(e models.PasswordEntry) error
+	updateEntry(e models.PasswordEntry) error
+	deleteEntry(id int) error
+	groups() ([]models.Groups, error)
+	addGroup(name, parent string) error
+	moveGroup(path, parent string) error
+	renameGroup(path, newName string) error
+	deleteGroup(path string) error
+	close() error
+}
+
+// openVault подключается к агенту, если он запущен для этой базы, иначе
+// запрашивает мастер-пароль и открывает базу через db.OpenAndAuthenticate
+func openVault(e *env) (vault, error) {
+	if !e.opts.noAgent {
+		if client, ok := dialAgent(e.opts.dbPath); ok {
+			return client, nil
+		}
+	}
+	return openLocalVault(e)
+}
+
+// localVault — база, открытая в этом процессе
+type localVault struct {
+	db   *sql.DB
+	keys *crypto.VaultKeys
+}
+
+func openLocalVault(e *env) (*localVault, error) {
+	if _, err := os.Stat(e.opts.dbPath); err != nil {
+		return nil, fmt.Errorf("база не найдена: %s", e.opts.dbPath)
+	}
+	var keyfile []byte
+	if e.opts.keyfilePath != "" {
+		data, err := os.ReadFile(e.opts.keyfilePath)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать ключевой файл: %w", err)
+		}
+		if len(data) == 0 {
+			return nil, db.ErrEmptyKeyfile
+		}
+		keyfile = data
+		defer crypto.Wipe(keyfile)
+	}
+	master, err := e.prompt.secret("Мастер-пароль: ", e.opts.passwordStdin)
+	if err != nil {
+		return nil, err
+	}
+	database, keys, err := db.OpenAndAuthenticate(e.opts.dbPath, master, keyfile)
+	crypto.Wipe(master)
+	if err != nil {
+		return nil, err
+	}
+	return &localVault{db: database, keys: keys}, nil
+}
+
+func (v *localVault) close() error {
+	v.keys.Wipe()
+	return v.db.Close()
+}
+
+func (v *localVault) entries() ([]models.PasswordEntry, error) {
+	return db.LoadAllEntries(v.db, v.keys)
+}
+
+func (v *localVault) addEntry(e models.PasswordEntry) error {
+	_, err := db.SaveEntry(v.db, v.keys, e)
+	return err
+}
+
+func (v *localVault) updateEntry(e models.PasswordEntry) error {
+	return db.UpdateEntry(v.db, v.keys, e)
+}
+
+func (v *localVault) deleteEntry(id int) error {
+	return db.DeleteEntry(v.db, id)
+}
+
+func (v *localVault) groups() ([]models.Groups, error) {
+	return db.GetGroup(v.db, v.keys)
+}
+
+func (v *localVault) addGroup(name, parent string) error {
+	return db.AddGroup(v.db, v.keys, name, parent)
+}
+
+// moveGroup переносит группу path внутрь группы parent; пустой parent — на верхний уровень
+func (v *localVault) moveGroup(path, parent string) error {
+	id, err := db.FindGroup(v.db, v.keys, path)
+	if err != nil {
+		return err
+	}
+	parentID := 0
+	if parent != "" {
+		if parentID, err = db.FindGroup(v.db, v.keys, parent); err != nil {
+			return err
+		}
+	}
+	return db.MoveGroup(v.db, id, parentID)
+}
+
+func (v *localVault) renameGroup(path, newName string) error {
+	id, err := db.FindGroup(v.db, v.keys, path)
+	if err != nil {
+		return err
+	}
+	return db.UpdateGroup(v.db, v.keys, id, newName)
+}
+
+// deleteGroup перемещает группу вместе с подгруппами и записями в корзину, как в окне приложения
+func (v *localVault) deleteGroup(path string) error {
+	id, err := db.FindGroup(v.db, v.keys, path)
+	if err != nil {
+		return err
+	}
+	return db.DeleteGroup(v.db, id)
+}
@@ -0,0 +1,47 @@
+// Package config читает и сохраняет settings.json. Пакет не зависит от графического
+// интерфейса, поэтому его используют и окна приложения, и консольный режим.
+package config
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+const settingsFile = "settings.json"
+
+// Load читает настройки; если файла ещё нет, возвращает настройки по умолчанию
+func Load() (models.Settings, error) {
+	settings := models.Settings{
+		DBPath:       models.DefaultDBPath,
+		ThemeVariant: 1,
+		TimerSeconds: models.TIME_CLEAR_PASSWD,
+		LockMinutes:  models.TIME_AUTO_LOCK,
+	}
+
+	file, err := os.Open(settingsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil // Default settings
+		}
+		return settings, err
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(&settings)
+	return settings, err
+}
+
+// Save записывает настройки в settings.json
+func Save(settings models.Settings) error {
+	file, err := os.Create(settingsFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(settings)
+}
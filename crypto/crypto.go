@@ -3,22 +3,26 @@ package crypto
 import (
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 
 	gost_kuznechik "github.com/pedroalbanese/gogost/gost3412128"
+	"github.com/pedroalbanese/gogost/mgm"
 )
 
-// PKCS7 padding
-func pkcs7Pad(b []byte, blockSize int) []byte {
-	pad := blockSize - (len(b) % blockSize)
-	out := make([]byte, len(b)+pad)
-	copy(out, b)
-	for i := len(b); i < len(out); i++ {
-		out[i] = byte(pad)
-	}
-	return out
-}
+// Версии формата шифротекста (первый байт blob'а)
+const (
+	FormatMGM byte = 0x01 // Кузнечик-MGM: version||nonce||CT||tag
+)
+
+const (
+	mgmNonceSize = 16
+	mgmTagSize   = 16
+)
+
+// ErrAuthFailed — имитовставка не сошлась: данные повреждены, подменены или ключ неверный
+var ErrAuthFailed = errors.New("ошибка проверки целостности данных")
 
 func pkcs7Unpad(b []byte) ([]byte, error) {
 	if len(b) == 0 {
@@ -37,32 +41,65 @@ func pkcs7Unpad(b []byte) ([]byte, error) {
 	return b[:len(b)-pad], nil
 }
 
-// EncryptData шифрует данные Кузнечиком (CBC + PKCS7). Возвращает IV||CT.
-func EncryptData(key, plaintext []byte) ([]byte, error) {
+func newMGM(key []byte) (cipher.AEAD, error) {
 	if len(key) != 32 {
 		return nil, fmt.Errorf("ключ должен быть 32 байта")
 	}
+	return mgm.NewMGM(gost_kuznechik.NewCipher(key), mgmTagSize)
+}
 
-	// создаём блок Кузнечик
-	block := gost_kuznechik.NewCipher(key)
-
-	blockSize := block.BlockSize() // должен быть 16
-	iv := make([]byte, blockSize)
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+// EncryptData шифрует данные Кузнечиком в режиме MGM.
+// Возвращает version||nonce||CT||tag. Байт версии и ad (контекст: к чему привязан
+// шифротекст) входят в присоединённые данные; ad в blob не сохраняется.
+func EncryptData(key, plaintext, ad []byte) ([]byte, error) {
+	aead, err := newMGM(key)
+	if err != nil {
 		return nil, err
 	}
 
-	padded := pkcs7Pad(plaintext, blockSize)
-	ct := make([]byte, len(padded))
+	nonce := make([]byte, mgmNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	// MGM требует, чтобы старший бит nonce был сброшен
+	nonce[0] &= 0x7f
 
-	mode := cipher.NewCBCEncrypter(block, iv)
-	mode.CryptBlocks(ct, padded)
+	header := []byte{FormatMGM}
+	out := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+mgmTagSize)
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, append(header, ad...)), nil
+}
 
-	return append(iv, ct...), nil
+// DecryptData проверяет имитовставку и только затем расшифровывает данные,
+// ожидает blob в формате EncryptData и тот же ad, что был при шифровании.
+// Открытый текст возвращается в новом буфере: вызывающий затирает его через Wipe.
+func DecryptData(key, blob, ad []byte) ([]byte, error) {
+	aead, err := newMGM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < 1+mgmNonceSize+mgmTagSize {
+		return nil, fmt.Errorf("короткий шифротекст")
+	}
+	if blob[0] != FormatMGM {
+		return nil, fmt.Errorf("неизвестная версия формата шифротекста: %d", blob[0])
+	}
+	header := []byte{blob[0]}
+	nonce := blob[1 : 1+mgmNonceSize]
+	if nonce[0]&0x80 != 0 {
+		return nil, ErrAuthFailed
+	}
+	pt, err := aead.Open(nil, nonce, blob[1+mgmNonceSize:], append(header, ad...))
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return pt, nil
 }
 
-// DecryptData расшифровывает данные, ожидает IV||CT
-func DecryptData(key, ciphertext []byte) ([]byte, error) {
+// DecryptLegacyCBC расшифровывает старый формат IV||CT (CBC + PKCS7).
+// Целостность этот формат не проверяет, поэтому он нужен только для миграции старых баз.
+func DecryptLegacyCBC(key, ciphertext []byte) ([]byte, error) {
 	if len(key) != 32 {
 		return nil, fmt.Errorf("ключ должен быть 32 байта")
 	}
@@ -83,5 +120,10 @@ func DecryptData(key, ciphertext []byte) ([]byte, error) {
 	mode := cipher.NewCBCDecrypter(block, iv)
 	mode.CryptBlocks(pt, ct)
 
-	return pkcs7Unpad(pt)
+	unpadded, err := pkcs7Unpad(pt)
+	if err != nil {
+		Wipe(pt)
+		return nil, err
+	}
+	return unpadded, nil
 }
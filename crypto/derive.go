@@ -23,7 +23,8 @@ func KDF_GOSTR3411_2012_256(seed, label, context []byte, keySize int) ([]byte, e
 	if keySize <= 0 || keySize > 64 {
 		return nil, fmt.Errorf("неверный размер ключа: %d", keySize)
 	}
-	var out []byte
+	// ёмкость с запасом на целое число блоков, чтобы append не оставлял копий ключа в старых массивах
+	out := make([]byte, 0, (keySize+31)/32*32)
 	counter := uint32(1)
 	for len(out) < keySize {
 		h := hmac.New(func() hash.Hash { return gost_streebog.New() }, seed)
@@ -34,9 +35,12 @@ func KDF_GOSTR3411_2012_256(seed, label, context []byte, keySize int) ([]byte, e
 		var b [4]byte
 		binary.BigEndian.PutUint32(b[:], counter)
 		h.Write(b[:])
-		out = append(out, h.Sum(nil)...)
+		sum := h.Sum(nil)
+		out = append(out, sum...)
+		Wipe(sum)
 		counter++
 	}
+	Wipe(out[keySize:])
 	return out[:keySize], nil
 }
 
@@ -45,11 +49,13 @@ func KDF_GOSTR3411_2012_256(seed, label, context []byte, keySize int) ([]byte, e
 func DeriveKeyFromPassword(password []byte, salt []byte, iterations int) ([]byte, error) {
 	// 1) первичный HMAC от пароля
 	hmacKey := HMACStreebog256(password, password)
+	defer Wipe(hmacKey)
 
 	// 2) PBKDF2 с функцией Streebog
 	pbkdf2Key := pbkdf2.Key(hmacKey, salt, iterations, 32, func() hash.Hash {
 		return gost_streebog.New()
 	})
+	defer Wipe(pbkdf2Key)
 
 	// 3) Дополнительный KDF
 	label := []byte("шифр")
@@ -60,3 +66,89 @@ func DeriveKeyFromPassword(password []byte, salt []byte, iterations int) ([]byte
 	}
 	return finalKey, nil
 }
+
+// VaultKeys — подключи, выведенные из случайного ключа хранилища; это ключи сессии,
+// которые живут от входа до блокировки или выхода.
+// Пароль защищает только сам ключ хранилища (см. WrapKey), поэтому смена пароля
+// или параметров KDF не требует перешифрования записей.
+// Подключи лежат в SecureBuffer и затираются вызовом Wipe.
+type VaultKeys struct {
+	Enc    []byte // шифрование полей записей
+	MAC    []byte // имитовставки служебных данных (verifier)
+	Search []byte // слепые индексы для поиска
+
+	buf *SecureBuffer
+}
+
+// метки KDF для подключей хранилища
+var (
+	labelEnc    = []byte("PassLedger enc")
+	labelMAC    = []byte("PassLedger mac")
+	labelSearch = []byte("PassLedger search")
+	labelWrap   = []byte("PassLedger vault key")
+)
+
+// GenerateVaultKey создаёт новый случайный 32-байтовый ключ хранилища
+func GenerateVaultKey() ([]byte, error) {
+	return GenerateSalt(32)
+}
+
+// DeriveVaultKeys выводит подключи из ключа хранилища через KDF_GOSTR3411_2012_256 с разными метками.
+// Сам vaultKey не сохраняется; вызывающий затирает его после вызова.
+func DeriveVaultKeys(vaultKey []byte) (*VaultKeys, error) {
+	buf, err := NewSecureBuffer(3 * 32)
+	if err != nil {
+		return nil, err
+	}
+	labels := [][]byte{labelEnc, labelMAC, labelSearch}
+	subkeys := make([][]byte, len(labels))
+	for i, label := range labels {
+		k, err := KDF_GOSTR3411_2012_256(vaultKey, label, nil, 32)
+		if err != nil {
+			buf.Destroy()
+			return nil, err
+		}
+		subkeys[i] = buf.Bytes()[i*32 : (i+1)*32 : (i+1)*32]
+		copy(subkeys[i], k)
+		Wipe(k)
+	}
+	return &VaultKeys{Enc: subkeys[0], MAC: subkeys[1], Search: subkeys[2], buf: buf}, nil
+}
+
+// WrapKey шифрует ключ хранилища ключом, выведенным из пароля (KEK)
+func WrapKey(kek, vaultKey []byte) ([]byte, error) {
+	return EncryptData(kek, vaultKey, labelWrap)
+}
+
+// UnwrapKey расшифровывает ключ хранилища; ErrAuthFailed означает неверный KEK.
+// Вызывающий затирает результат после DeriveVaultKeys.
+func UnwrapKey(kek, wrapped []byte) ([]byte, error) {
+	return DecryptData(kek, wrapped, labelWrap)
+}
+
+// CompositeKey объединяет мастер-пароль и содержимое ключевого файла в секрет для KDF.
+// Без ключевого файла возвращает копию пароля, чтобы старые базы открывались прежним ключом.
+// Результат всегда новый буфер, вызывающий затирает его после вывода ключа.
+func CompositeKey(password, keyfile []byte) []byte {
+	if len(keyfile) == 0 {
+		return append([]byte(nil), password...)
+	}
+	h := gost_streebog.New()
+	h.Write(keyfile)
+	digest := h.Sum(nil)
+	defer Wipe(digest)
+	return HMACStreebog256(digest, password)
+}
+
+// Wipe затирает подключи и освобождает их память; после вызова ключи пусты,
+// и любая попытка шифрования ими завершится ошибкой. Повторный вызов безопасен.
+func (k *VaultKeys) Wipe() {
+	if k == nil {
+		return
+	}
+	for _, b := range [][]byte{k.Enc, k.MAC, k.Search} {
+		Wipe(b)
+	}
+	k.Enc, k.MAC, k.Search = nil, nil, nil
+	k.buf.Destroy()
+}
@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Алгоритмы вывода ключа из мастер-пароля
+const (
+	KDFPBKDF2Streebog = "pbkdf2-streebog"
+	KDFArgon2id       = "argon2id"
+)
+
+// KDFParams — алгоритм и стоимость вывода ключа из мастер-пароля
+type KDFParams struct {
+	Algorithm  string `json:"algorithm"`
+	Iterations int    `json:"iterations,omitempty"` // PBKDF2
+	Memory     uint32 `json:"memory,omitempty"`     // Argon2id, КиБ
+	Time       uint32 `json:"time,omitempty"`       // Argon2id, число проходов
+	Threads    uint8  `json:"threads,omitempty"`    // Argon2id, параллелизм
+}
+
+// DefaultKDFParams — параметры для новых баз
+func DefaultKDFParams() KDFParams {
+	return KDFParams{Algorithm: KDFPBKDF2Streebog, Iterations: 20000}
+}
+
+// Validate проверяет, что параметры допустимы и не слишком слабые
+func (p KDFParams) Validate() error {
+	switch p.Algorithm {
+	case KDFPBKDF2Streebog:
+		if p.Iterations < 1000 {
+			return fmt.Errorf("слишком мало итераций PBKDF2: %d", p.Iterations)
+		}
+	case KDFArgon2id:
+		if p.Time < 1 || p.Threads < 1 {
+			return fmt.Errorf("неверные параметры Argon2id: time=%d, threads=%d", p.Time, p.Threads)
+		}
+		if p.Memory < 8*1024 || p.Memory > 4*1024*1024 {
+			return fmt.Errorf("память Argon2id должна быть от 8 МиБ до 4 ГиБ: %d КиБ", p.Memory)
+		}
+	default:
+		return fmt.Errorf("неизвестный алгоритм KDF: %q", p.Algorithm)
+	}
+	return nil
+}
+
+// String — краткое описание параметров для интерфейса
+func (p KDFParams) String() string {
+	if p.Algorithm == KDFArgon2id {
+		return fmt.Sprintf("Argon2id (память %d МиБ, проходов %d, потоков %d)", p.Memory/1024, p.Time, p.Threads)
+	}
+	return fmt.Sprintf("PBKDF2-Стрибог (%d итераций)", p.Iterations)
+}
+
+// DeriveKEK выводит ключ шифрования ключа хранилища из пароля по заданным параметрам
+func DeriveKEK(password, salt []byte, p KDFParams) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	switch p.Algorithm {
+	case KDFArgon2id:
+		// та же схема, что в DeriveKeyFromPassword, но вместо PBKDF2 — Argon2id
+		hmacKey := HMACStreebog256(password, password)
+		defer Wipe(hmacKey)
+		argonKey := argon2.IDKey(hmacKey, salt, p.Time, p.Memory, p.Threads, 32)
+		defer Wipe(argonKey)
+		return KDF_GOSTR3411_2012_256(argonKey, []byte("шифр"), []byte(""), 32)
+	default:
+		return DeriveKeyFromPassword(password, salt, p.Iterations)
+	}
+}
+
+// BenchmarkKDF подбирает параметры алгоритма так, чтобы вывод ключа на этой машине
+// занимал примерно target
+func BenchmarkKDF(algorithm string, target time.Duration) (KDFParams, error) {
+	salt := make([]byte, 16)
+	password := []byte("benchmark")
+	measure := func(p KDFParams) (time.Duration, error) {
+		start := time.Now()
+		_, err := DeriveKEK(password, salt, p)
+		// на грубых часах замер может дать ноль, а на него дальше делится целевое время
+		return max(time.Since(start), time.Millisecond), err
+	}
+
+	switch algorithm {
+	case KDFPBKDF2Streebog:
+		p := KDFParams{Algorithm: KDFPBKDF2Streebog, Iterations: 10000}
+		elapsed, err := measure(p)
+		if err != nil {
+			return KDFParams{}, err
+		}
+		p.Iterations = max(int(float64(p.Iterations)*float64(target)/float64(elapsed)), 1000)
+		return p, nil
+	case KDFArgon2id:
+		threads := uint8(min(runtime.NumCPU(), 4))
+		p := KDFParams{Algorithm: KDFArgon2id, Memory: 64 * 1024, Time: 1, Threads: threads}
+		elapsed, err := measure(p)
+		if err != nil {
+			return KDFParams{}, err
+		}
+		p.Time = uint32(max(int(float64(target)/float64(elapsed)), 1))
+		return p, nil
+	default:
+		return KDFParams{}, fmt.Errorf("неизвестный алгоритм KDF: %q", algorithm)
+	}
+}
@@ -0,0 +1,46 @@
+package crypto
+
+import "runtime"
+
+// Wipe затирает буфер с секретом. Строки Go неизменяемы и затереть их нельзя,
+// поэтому секреты по возможности держатся в []byte и затираются сразу после использования.
+func Wipe(b []byte) {
+	clear(b)
+	runtime.KeepAlive(b)
+}
+
+// SecureBuffer — память для ключей сессии. На Unix она выделяется вне кучи Go
+// и закрепляется в оперативной памяти (mlock), чтобы ключ не попал в swap;
+// Destroy затирает и освобождает её.
+type SecureBuffer struct {
+	data    []byte
+	release func([]byte)
+}
+
+// NewSecureBuffer выделяет буфер из size нулевых байт
+func NewSecureBuffer(size int) (*SecureBuffer, error) {
+	data, release, err := allocLocked(size)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureBuffer{data: data, release: release}, nil
+}
+
+// Bytes возвращает содержимое буфера; после Destroy — nil
+func (b *SecureBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Destroy затирает буфер и возвращает память системе. Повторный вызов ничего не делает.
+func (b *SecureBuffer) Destroy() {
+	if b == nil || b.data == nil {
+		return
+	}
+	data := b.data
+	b.data = nil
+	Wipe(data)
+	b.release(data)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package crypto
+
+// allocLocked на платформах без mlock выделяет обычный буфер, который только затирается
+func allocLocked(size int) ([]byte, func([]byte), error) {
+	return make([]byte, size), func([]byte) {}, nil
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package crypto
+
+import (
+	"log"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// mlockWarning предупреждает о незакреплённой памяти один раз за запуск
+var mlockWarning sync.Once
+
+// allocLocked выделяет анонимную память через mmap и закрепляет её через mlock.
+// Если лимит RLIMIT_MEMLOCK не позволяет закрепить страницы, память всё равно
+// используется: она вне кучи Go и затирается при освобождении, но может попасть в swap,
+// о чём в журнал пишется предупреждение.
+func allocLocked(size int) ([]byte, func([]byte), error) {
+	data, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, err
+	}
+	lockErr := unix.Mlock(data)
+	if lockErr != nil {
+		mlockWarning.Do(func() {
+			log.Printf("не удалось закрепить память для ключей (mlock): %v; ключи могут попасть в swap, увеличьте лимит RLIMIT_MEMLOCK", lockErr)
+		})
+	}
+	release := func(b []byte) {
+		if lockErr == nil {
+			unix.Munlock(b)
+		}
+		unix.Munmap(b)
+	}
+	return data, release, nil
+}
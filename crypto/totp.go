@@ -0,0 +1,129 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTPParams — параметры генератора одноразовых кодов TOTP (RFC 6238)
+type OTPParams struct {
+	Secret    []byte
+	Algorithm string // SHA1, SHA256 или SHA512
+	Digits    int
+	Period    int // длительность шага в секундах
+	Issuer    string
+	Account   string
+}
+
+// ErrInvalidOTP — строка не является ни otpauth://totp URI, ни секретом в base32
+var ErrInvalidOTP = errors.New("некорректный секрет TOTP: ожидается otpauth://totp/... или base32")
+
+// ParseOTP разбирает секрет TOTP: URI otpauth://totp/... (как в QR-кодах) или
+// секрет в base32, для которого берутся параметры по умолчанию: SHA1, 6 цифр, 30 секунд
+func ParseOTP(s string) (OTPParams, error) {
+	s = strings.TrimSpace(s)
+	p := OTPParams{Algorithm: "SHA1", Digits: 6, Period: 30}
+	if !strings.HasPrefix(strings.ToLower(s), "otpauth://") {
+		secret, err := decodeBase32Secret(s)
+		if err != nil {
+			return OTPParams{}, err
+		}
+		p.Secret = secret
+		return p, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return OTPParams{}, ErrInvalidOTP
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return OTPParams{}, fmt.Errorf("поддерживается только TOTP, а не %q", u.Host)
+	}
+	q := u.Query()
+	if p.Secret, err = decodeBase32Secret(q.Get("secret")); err != nil {
+		return OTPParams{}, err
+	}
+	if a := q.Get("algorithm"); a != "" {
+		p.Algorithm = strings.ToUpper(a)
+		if p.Algorithm != "SHA1" && p.Algorithm != "SHA256" && p.Algorithm != "SHA512" {
+			return OTPParams{}, fmt.Errorf("неподдерживаемый алгоритм TOTP %q", a)
+		}
+	}
+	if d := q.Get("digits"); d != "" {
+		if p.Digits, err = strconv.Atoi(d); err != nil || p.Digits < 6 || p.Digits > 8 {
+			return OTPParams{}, fmt.Errorf("число цифр TOTP должно быть от 6 до 8")
+		}
+	}
+	if per := q.Get("period"); per != "" {
+		if p.Period, err = strconv.Atoi(per); err != nil || p.Period <= 0 {
+			return OTPParams{}, fmt.Errorf("некорректный период TOTP %q", per)
+		}
+	}
+	// метка — «издатель:аккаунт», издатель может дублироваться параметром issuer
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		p.Issuer, p.Account = issuer, strings.TrimSpace(account)
+	} else {
+		p.Account = label
+	}
+	if issuer := q.Get("issuer"); issuer != "" {
+		p.Issuer = issuer
+	}
+	return p, nil
+}
+
+// decodeBase32Secret декодирует секрет без учёта регистра, пробелов и дополнения '='
+func decodeBase32Secret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(s))
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return nil, ErrInvalidOTP
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil || len(secret) == 0 {
+		return nil, ErrInvalidOTP
+	}
+	return secret, nil
+}
+
+// TOTP вычисляет код на момент t и сколько времени он ещё действует
+func TOTP(p OTPParams, t time.Time) (code string, remaining time.Duration) {
+	period := int64(p.Period)
+	counter := t.Unix() / period
+	remaining = time.Duration(period-t.Unix()%period) * time.Second
+
+	var newHash func() hash.Hash
+	switch p.Algorithm {
+	case "SHA256":
+		newHash = sha256.New
+	case "SHA512":
+		newHash = sha512.New
+	default:
+		newHash = sha1.New
+	}
+	mac := hmac.New(newHash, p.Secret)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// динамическое усечение (RFC 4226, раздел 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < p.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", p.Digits, value%mod), remaining
+}
@@ -2,9 +2,13 @@ package crypto
 
 import (
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math/big"
+	"os"
 
 	"github.com/reinbowARA/PassLedger/models"
 )
@@ -64,3 +68,29 @@ func GeneratePassword(options models.PasswordGeneratorOptions) (string, error) {
 	}
 	return string(password), nil
 }
+
+// GenerateKeyfile создаёт ключевой файл из 64 случайных байт (в hex) с правами только для владельца.
+// Файл пишется без перевода строки в конце: ключом служат байты файла как есть, и редактор,
+// убирающий последний перевод строки, иначе сделал бы базу недоступной. Существующий файл
+// не перезаписывается: это может быть ключевой файл другой базы.
+func GenerateKeyfile(path string) error {
+	b, err := GenerateSalt(64)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("файл %s уже существует: выберите другое имя", path)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(hex.EncodeToString(b)))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,234 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// AttachmentChunkSize — размер открытого текста одного зашифрованного фрагмента вложения.
+// Файл никогда не держится в памяти целиком: читается, шифруется и пишется по фрагментам.
+const AttachmentChunkSize = 64 * 1024
+
+// attachmentNameAD — присоединённые данные имени вложения
+func attachmentNameAD(id int) []byte {
+	return []byte(fmt.Sprintf("attachments:%d:name", id))
+}
+
+// chunkAD — присоединённые данные фрагмента: id вложения, номер и признак последнего
+// фрагмента, так что перестановка, подмена и усечение фрагментов обнаруживаются
+func chunkAD(id, seq int, last bool) []byte {
+	if last {
+		return []byte(fmt.Sprintf("attachments:%d:%d:last", id, seq))
+	}
+	return []byte(fmt.Sprintf("attachments:%d:%d", id, seq))
+}
+
+// AddAttachment шифрует содержимое r по фрагментам и прикрепляет его к записи entryID
+func AddAttachment(dbConn *sql.DB, keys *crypto.VaultKeys, entryID int, name string, r io.Reader) (models.Attachment, error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	defer tx.Rollback()
+	att, err := addAttachment(tx, keys, entryID, name, r)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Attachment{}, err
+	}
+	return att, nil
+}
+
+func addAttachment(tx *sql.Tx, keys *crypto.VaultKeys, entryID int, name string, r io.Reader) (models.Attachment, error) {
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM entries WHERE id = ?)`, entryID).Scan(&exists); err != nil {
+		return models.Attachment{}, err
+	}
+	if !exists {
+		return models.Attachment{}, fmt.Errorf("запись с id %d не найдена", entryID)
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(`INSERT INTO attachments (entry_id, name, size, created_at) VALUES (?, X'', 0, ?)`, entryID, now.Unix())
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	id64, err := result.LastInsertId()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	id := int(id64)
+
+	nameCT, err := crypto.EncryptData(keys.Enc, []byte(name), attachmentNameAD(id))
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	// читаем на фрагмент вперёд, чтобы знать, какой фрагмент последний
+	cur := make([]byte, AttachmentChunkSize)
+	next := make([]byte, AttachmentChunkSize)
+	defer crypto.Wipe(cur)
+	defer crypto.Wipe(next)
+	n, err := readChunk(r, cur)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	var size int64
+	for seq := 0; ; seq++ {
+		var m int
+		if n == AttachmentChunkSize {
+			if m, err = readChunk(r, next); err != nil {
+				return models.Attachment{}, err
+			}
+		}
+		last := m == 0
+		ct, err := crypto.EncryptData(keys.Enc, cur[:n], chunkAD(id, seq, last))
+		if err != nil {
+			return models.Attachment{}, err
+		}
+		if _, err := tx.Exec(`INSERT INTO attachment_chunks (attachment_id, seq, data) VALUES (?, ?, ?)`, id, seq, ct); err != nil {
+			return models.Attachment{}, err
+		}
+		size += int64(n)
+		if last {
+			break
+		}
+		cur, next, n = next, cur, m
+	}
+
+	if _, err := tx.Exec(`UPDATE attachments SET name = ?, size = ? WHERE id = ?`, nameCT, size, id); err != nil {
+		return models.Attachment{}, err
+	}
+	return models.Attachment{ID: id, EntryID: entryID, Name: name, Size: size, Created: now}, nil
+}
+
+// readChunk заполняет buf из r; возвращает 0 в конце данных
+func readChunk(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// ListAttachments возвращает вложения записи в порядке добавления
+func ListAttachments(dbConn *sql.DB, keys *crypto.VaultKeys, entryID int) ([]models.Attachment, error) {
+	return listAttachments(dbConn, keys, entryID)
+}
+
+func listAttachments(q querier, keys *crypto.VaultKeys, entryID int) ([]models.Attachment, error) {
+	rows, err := q.Query(`SELECT id, name, size, created_at FROM attachments WHERE entry_id = ? ORDER BY id`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Attachment
+	for rows.Next() {
+		a := models.Attachment{EntryID: entryID}
+		var nameCT []byte
+		var created int64
+		if err := rows.Scan(&a.ID, &nameCT, &a.Size, &created); err != nil {
+			return nil, err
+		}
+		name, err := crypto.DecryptData(keys.Enc, nameCT, attachmentNameAD(a.ID))
+		if err != nil {
+			return nil, fmt.Errorf("вложение %d: %w", a.ID, err)
+		}
+		a.Name = string(name)
+		a.Created = time.Unix(created, 0)
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// WriteAttachment расшифровывает вложение id в w по одному фрагменту за раз.
+// Если данные повреждены, запись в w прерывается с ошибкой.
+func WriteAttachment(dbConn *sql.DB, keys *crypto.VaultKeys, id int, w io.Writer) error {
+	return writeAttachment(dbConn, keys, id, w)
+}
+
+func writeAttachment(q querier, keys *crypto.VaultKeys, id int, w io.Writer) error {
+	var size int64
+	err := q.QueryRow(`SELECT size FROM attachments WHERE id = ?`, id).Scan(&size)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("вложение с id %d не найдено", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.Query(`SELECT seq, data FROM attachment_chunks WHERE attachment_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var written int64
+	expected, finished := 0, false
+	for rows.Next() {
+		var seq int
+		var ct []byte
+		if err := rows.Scan(&seq, &ct); err != nil {
+			return err
+		}
+		if seq != expected || finished {
+			return fmt.Errorf("вложение %d: %w", id, crypto.ErrAuthFailed)
+		}
+		pt, err := crypto.DecryptData(keys.Enc, ct, chunkAD(id, seq, false))
+		if errors.Is(err, crypto.ErrAuthFailed) {
+			pt, err = crypto.DecryptData(keys.Enc, ct, chunkAD(id, seq, true))
+			finished = err == nil
+		}
+		if err != nil {
+			return fmt.Errorf("вложение %d, фрагмент %d: %w", id, seq, err)
+		}
+		_, err = w.Write(pt)
+		written += int64(len(pt))
+		crypto.Wipe(pt)
+		if err != nil {
+			return err
+		}
+		expected++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !finished || written != size {
+		return fmt.Errorf("вложение %d неполное: %w", id, crypto.ErrAuthFailed)
+	}
+	return nil
+}
+
+// DeleteAttachment удаляет вложение вместе с его фрагментами
+func DeleteAttachment(dbConn *sql.DB, id int) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM attachment_chunks WHERE attachment_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM attachments WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteEntryAttachments удаляет вложения записей, выбранных подзапросом entryIDs
+func deleteEntryAttachments(tx *sql.Tx, entryIDs string, args ...any) error {
+	_, err := tx.Exec(`DELETE FROM attachment_chunks WHERE attachment_id IN (
+		SELECT id FROM attachments WHERE entry_id IN (`+entryIDs+`))`, args...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM attachments WHERE entry_id IN (`+entryIDs+`)`, args...)
+	return err
+}
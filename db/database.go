@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -15,22 +16,47 @@ import (
 //go:embed table.sql
 var DefaultDBCreateTable embed.FS
 
-func OpenOrCreateDatabase(dbPath, masterPassword string) (*sql.DB, []byte, error) {
+var (
+	ErrWrongPassword   = errors.New("неверный мастер-пароль")
+	ErrKeyfileRequired = errors.New("для этой базы нужен ключевой файл")
+	// ErrEmptyKeyfile — ключевой файл пуст: он не добавил бы к паролю ни одного байта секрета
+	ErrEmptyKeyfile = errors.New("ключевой файл пуст: выберите другой файл")
+)
+
+// OpenOrCreateDatabase открывает базу или создаёт новую, если файла ещё нет.
+// keyfile — содержимое ключевого файла или nil, если он не используется; пустой файл — ошибка.
+func OpenOrCreateDatabase(dbPath string, masterPassword, keyfile []byte) (*sql.DB, *crypto.VaultKeys, error) {
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		return CreateNewDatabase(dbPath, masterPassword)
+		return CreateNewDatabase(dbPath, masterPassword, keyfile)
 	}
-	return OpenAndAuthenticate(dbPath, masterPassword)
+	return OpenAndAuthenticate(dbPath, masterPassword, keyfile)
 }
 
-func CreateNewDatabase(dbPath, masterPassword string) (db *sql.DB, key []byte, err error) {
-	err = os.MkdirAll(filepath.Dir(dbPath), 0700)
-	if err != nil {
-		return
+// CreateNewDatabase создаёт базу dbPath. Если создать её не удалось, соединение закрывается,
+// а файл, созданный этим вызовом, удаляется, чтобы не оставлять недоделанную базу.
+func CreateNewDatabase(dbPath string, masterPassword, keyfile []byte) (_ *sql.DB, _ *crypto.VaultKeys, err error) {
+	if keyfile != nil && len(keyfile) == 0 {
+		return nil, nil, ErrEmptyKeyfile
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
+		return nil, nil, err
 	}
-	db, err = sql.Open("sqlite3", dbPath)
+	_, statErr := os.Stat(dbPath)
+	created := os.IsNotExist(statErr)
+	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		db.Close()
+		if created {
+			os.Remove(dbPath)
+			os.Remove(dbPath + "-journal")
+		}
+	}()
 
 	schema, err := DefaultDBCreateTable.ReadFile("table.sql")
 	if err != nil {
@@ -40,33 +66,228 @@ func CreateNewDatabase(dbPath, masterPassword string) (db *sql.DB, key []byte, e
 		return nil, nil, err
 	}
 
-	salt, _ := crypto.GenerateSalt(16)
-	iterations := 20000
-	key, _ = crypto.DeriveKeyFromPassword([]byte(masterPassword), salt, iterations)
-	verifier := crypto.HMACStreebog256(key, []byte("verifier"))
-	_, err = db.Exec(`INSERT INTO meta (id, salt, iterations, verifier) VALUES (1, ?, ?, ?)`, salt, iterations, verifier)
+	salt, err := crypto.GenerateSalt(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	kdf := crypto.DefaultKDFParams()
+	kek, err := passwordKEK(masterPassword, keyfile, salt, kdf)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.Wipe(kek)
+	vaultKey, err := crypto.GenerateVaultKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.Wipe(vaultKey)
+	wrapped, err := crypto.WrapKey(kek, vaultKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := crypto.DeriveVaultKeys(vaultKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = db.Exec(`INSERT INTO meta (id, salt, kdf, iterations, argon_memory, argon_time, argon_threads, verifier, cipher_version, wrapped_key, keyfile_required, schema_version)
+		VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		salt, kdf.Algorithm, kdf.Iterations, kdf.Memory, kdf.Time, kdf.Threads, vaultVerifier(keys), CurrentCipherVersion, wrapped, len(keyfile) > 0, CurrentSchemaVersion)
 	if err != nil {
+		keys.Wipe()
 		return nil, nil, err
 	}
-	return db, key, nil
+	return db, keys, nil
 }
 
-func OpenAndAuthenticate(dbPath, masterPassword string) (*sql.DB, []byte, error) {
+// OpenAndAuthenticate открывает существующую базу и проверяет мастер-пароль.
+// Пароль проверяется до любых изменений в файле: неверный пароль или чужая база не должны
+// приводить к миграции и резервной копии. При любой ошибке соединение с базой закрывается.
+func OpenAndAuthenticate(dbPath string, masterPassword, keyfile []byte) (_ *sql.DB, _ *crypto.VaultKeys, err error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, nil, err
 	}
-	row := db.QueryRow(`SELECT salt, iterations, verifier FROM meta WHERE id = 1`)
-	var salt []byte
-	var iterations int
-	var verifier []byte
-	if err := row.Scan(&salt, &iterations, &verifier); err != nil {
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+	version, err := checkSchemaVersion(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	kek, keys, err := checkCredentials(db, version, masterPassword, keyfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.Wipe(kek)
+	defer func() {
+		if err != nil && keys != nil {
+			keys.Wipe()
+		}
+	}()
+
+	err = migrate(db, dbPath, version, func(tx *sql.Tx) error {
+		if keys == nil {
+			// база до появления ключа хранилища: записи зашифрованы ключом из пароля
+			if err := upgradeCipher(tx, kek); err != nil {
+				return err
+			}
+			var err error
+			if keys, err = upgradeKeyHierarchy(tx, kek); err != nil {
+				return err
+			}
+		} else if err := upgradeCipher(tx, keys.Enc); err != nil {
+			return err
+		}
+		if err := encryptGroupNames(tx, keys); err != nil {
+			return err
+		}
+		if err := upgradeGroupPaths(tx, keys); err != nil {
+			return err
+		}
+		return purgeExpiredTrash(tx)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := applyPendingKDFUpgrade(db, masterPassword, keyfile); err != nil {
+		return nil, nil, err
+	}
+	return db, keys, nil
+}
+
+// checkCredentials проверяет мастер-пароль, ничего не меняя в файле. Колонки meta, которые
+// читает проверка, у старой базы появляются только в миграциях, поэтому миграции применяются
+// в транзакции, которая затем откатывается. Для базы без ключа хранилища возвращается ключ
+// из пароля kek, для остальных — ключи хранилища.
+func checkCredentials(dbConn *sql.DB, version int, masterPassword, keyfile []byte) (kek []byte, keys *crypto.VaultKeys, err error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	if err := applyMigrations(tx, version); err != nil {
+		return nil, nil, err
+	}
+	var wrapped []byte
+	if err := tx.QueryRow(`SELECT wrapped_key FROM meta WHERE id = 1`).Scan(&wrapped); err != nil {
 		return nil, nil, errors.New("ошибка чтения метаданных БД")
 	}
-	key, _ := crypto.DeriveKeyFromPassword([]byte(masterPassword), salt, iterations)
+	if wrapped == nil {
+		kek, err = authenticateLegacy(tx, masterPassword, keyfile)
+		return kek, nil, err
+	}
+	keys, err = authenticate(tx, masterPassword, keyfile)
+	return nil, keys, err
+}
+
+// Unlock проверяет мастер-пароль для уже открытой базы и возвращает ключи хранилища.
+// Используется при входе и при разблокировке после автоблокировки окна.
+func Unlock(db *sql.DB, masterPassword, keyfile []byte) (*crypto.VaultKeys, error) {
+	keys, err := authenticate(db, masterPassword, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyPendingKDFUpgrade(db, masterPassword, keyfile); err != nil {
+		keys.Wipe()
+		return nil, err
+	}
+	return keys, nil
+}
+
+// vaultVerifier — контрольное значение ключа хранилища, хранится в meta.verifier
+func vaultVerifier(keys *crypto.VaultKeys) []byte {
+	return crypto.HMACStreebog256(keys.MAC, []byte("verifier"))
+}
+
+// deriveKEK выводит ключ из мастер-пароля и ключевого файла по параметрам из meta
+func deriveKEK(db querier, masterPassword, keyfile []byte) ([]byte, error) {
+	salt, p, err := readKDFParams(db)
+	if err != nil {
+		return nil, err
+	}
+	var keyfileRequired bool
+	if err := db.QueryRow(`SELECT keyfile_required FROM meta WHERE id = 1`).Scan(&keyfileRequired); err != nil {
+		return nil, errors.New("ошибка чтения метаданных БД")
+	}
+	if keyfileRequired && len(keyfile) == 0 {
+		return nil, ErrKeyfileRequired
+	}
+	if !keyfileRequired && len(keyfile) > 0 {
+		// ключевой файл указан для базы, которая его не использует
+		return nil, wrongCredentials(true)
+	}
+	return passwordKEK(masterPassword, keyfile, salt, p)
+}
+
+// passwordKEK выводит KEK из мастер-пароля и ключевого файла, затирая промежуточный буфер.
+// Сам пароль затирает вызывающий код.
+func passwordKEK(masterPassword, keyfile, salt []byte, p crypto.KDFParams) ([]byte, error) {
+	secret := crypto.CompositeKey(masterPassword, keyfile)
+	defer crypto.Wipe(secret)
+	return crypto.DeriveKEK(secret, salt, p)
+}
+
+// wrongCredentials — ошибка неверного пароля; если используется ключевой файл,
+// сообщение не уточняет, что именно из двух неверно
+func wrongCredentials(withKeyfile bool) error {
+	if withKeyfile {
+		return fmt.Errorf("%w или ключевой файл", ErrWrongPassword)
+	}
+	return ErrWrongPassword
+}
+
+// authenticate выводит KEK из мастер-пароля, расшифровывает им ключ хранилища
+// и сверяет подключи с verifier из meta
+func authenticate(db querier, masterPassword, keyfile []byte) (*crypto.VaultKeys, error) {
+	kek, err := deriveKEK(db, masterPassword, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(kek)
+	var wrapped, verifier []byte
+	if err := db.QueryRow(`SELECT wrapped_key, verifier FROM meta WHERE id = 1`).Scan(&wrapped, &verifier); err != nil {
+		return nil, errors.New("ошибка чтения метаданных БД")
+	}
+	vaultKey, err := crypto.UnwrapKey(kek, wrapped)
+	if err != nil {
+		return nil, wrongCredentials(len(keyfile) > 0)
+	}
+	keys, err := crypto.DeriveVaultKeys(vaultKey)
+	crypto.Wipe(vaultKey)
+	if err != nil {
+		return nil, err
+	}
+	if !crypto.HmacEqual(vaultVerifier(keys), verifier) {
+		keys.Wipe()
+		return nil, errors.New("ключ хранилища не совпадает с контрольным значением")
+	}
+	return keys, nil
+}
+
+// authenticateLegacy проверяет мастер-пароль базы без ключа хранилища,
+// где verifier = HMAC(ключ из пароля, "verifier")
+func authenticateLegacy(db querier, masterPassword, keyfile []byte) ([]byte, error) {
+	key, err := deriveKEK(db, masterPassword, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	var verifier []byte
+	if err := db.QueryRow(`SELECT verifier FROM meta WHERE id = 1`).Scan(&verifier); err != nil {
+		return nil, errors.New("ошибка чтения метаданных БД")
+	}
 	expected := crypto.HMACStreebog256(key, []byte("verifier"))
 	if !crypto.HmacEqual(expected, verifier) {
-		return nil, nil, errors.New("неверный мастер-пароль")
+		crypto.Wipe(key)
+		return nil, ErrWrongPassword
 	}
-	return db, key, nil
+	return key, nil
+}
+
+// querier — общий интерфейс *sql.DB и *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
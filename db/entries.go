@@ -2,57 +2,290 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/reinbowARA/PassLedger/crypto"
 	"github.com/reinbowARA/PassLedger/models"
 )
 
-func getOrCreateGroup(dbConn *sql.DB, name string) (sql.NullInt64, error) {
-	if name == "" {
-		return sql.NullInt64{Valid: false}, nil
-	}
+// getOrCreateGroup возвращает группу по пути, создавая недостающие уровни; если путь ведёт
+// в корзину, группа достаётся оттуда вместе с родителями. Пустой путь — запись без группы.
+func getOrCreateGroup(dbConn querier, keys *crypto.VaultKeys, path string) (sql.NullInt64, error) {
 	var id sql.NullInt64
-	err := dbConn.QueryRow(`SELECT id FROM groups WHERE name = ?`, name).Scan(&id)
-	if err == sql.ErrNoRows {
-		result, err := dbConn.Exec(`INSERT INTO groups (name) VALUES (?)`, name)
+	restore := false
+	for _, name := range SplitGroupPath(path) {
+		childID, trashed, err := findChildGroup(dbConn, keys, id, name)
+		if err == sql.ErrNoRows {
+			childID, err = createGroup(dbConn, keys, id, name)
+		}
 		if err != nil {
 			return sql.NullInt64{}, err
 		}
-		insertID, _ := result.LastInsertId()
-		id = sql.NullInt64{Int64: insertID, Valid: true}
-	} else if err != nil {
-		return sql.NullInt64{}, err
+		restore = restore || trashed
+		id = sql.NullInt64{Int64: childID, Valid: true}
+	}
+	if restore {
+		if err := restoreGroupPath(dbConn, id.Int64); err != nil {
+			return sql.NullInt64{}, err
+		}
 	}
 	return id, nil
 }
 
-// SaveEntry сохраняет новую запись (шифрует поля)
-func SaveEntry(dbConn *sql.DB, key []byte, e models.PasswordEntry) error {
-	groupId, err := getOrCreateGroup(dbConn, e.Group)
+// createGroup добавляет подгруппу name группы parent: как и у записей, id входит в присоединённые данные,
+// поэтому имя шифруется после вставки строки
+func createGroup(dbConn querier, keys *crypto.VaultKeys, parent sql.NullInt64, name string) (int64, error) {
+	result, err := dbConn.Exec(`INSERT INTO groups (name, name_index, parent_id) VALUES (X'', ?, ?)`, groupIndex(keys, name), parent)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	encTitle, _ := crypto.EncryptData(key, []byte(e.Title))
-	encUser, _ := crypto.EncryptData(key, []byte(e.Username))
-	encPass, _ := crypto.EncryptData(key, []byte(e.Password))
-	var encURL []byte
-	if e.URL != "" {
-		encURL, _ = crypto.EncryptData(key, []byte(e.URL))
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
 	}
-	var encNotes []byte
-	if e.Notes != "" {
-		encNotes, _ = crypto.EncryptData(key, []byte(e.Notes))
+	ct, err := encryptGroupName(keys, int(id), name)
+	if err != nil {
+		return 0, err
 	}
+	_, err = dbConn.Exec(`UPDATE groups SET name = ? WHERE id = ?`, ct, id)
+	return id, err
+}
 
-	_, err = dbConn.Exec(`INSERT INTO entries (title, username, password, url, notes, group_id)
-		VALUES (?, ?, ?, ?, ?, ?)`, encTitle, encUser, encPass, encURL, encNotes, groupId)
-	return err
+// groupIndex — слепой индекс имени группы: HMAC на подключе Search. Позволяет искать
+// группу по точному имени и проверять уникальность, не храня имя открытым текстом.
+func groupIndex(keys *crypto.VaultKeys, name string) []byte {
+	return crypto.HMACStreebog256(keys.Search, []byte("groups:name:"+name))
+}
+
+// groupAD — присоединённые данные имени группы
+func groupAD(id int) []byte {
+	return []byte(fmt.Sprintf("groups:%d:name", id))
+}
+
+func encryptGroupName(keys *crypto.VaultKeys, id int, name string) ([]byte, error) {
+	pt := []byte(name)
+	defer crypto.Wipe(pt)
+	return crypto.EncryptData(keys.Enc, pt, groupAD(id))
+}
+
+func decryptGroupName(keys *crypto.VaultKeys, id int, ct []byte) (string, error) {
+	pt, err := crypto.DecryptData(keys.Enc, ct, groupAD(id))
+	if err != nil {
+		return "", fmt.Errorf("группа %d: %w", id, err)
+	}
+	defer crypto.Wipe(pt)
+	return string(pt), nil
+}
+
+// fieldAD — присоединённые данные поля: шифротекст привязан к id записи и имени колонки,
+// поэтому перенос blob'а в другую строку или колонку обнаруживается при расшифровании
+func fieldAD(id int, field string) []byte {
+	return []byte(fmt.Sprintf("entries:%d:%s", id, field))
+}
+
+func encryptField(keys *crypto.VaultKeys, id int, field, value string) ([]byte, error) {
+	pt := []byte(value)
+	defer crypto.Wipe(pt)
+	return crypto.EncryptData(keys.Enc, pt, fieldAD(id, field))
+}
+
+func decryptField(keys *crypto.VaultKeys, id int, field string, ct []byte) (string, error) {
+	if len(ct) == 0 {
+		return "", nil
+	}
+	pt, err := crypto.DecryptData(keys.Enc, ct, fieldAD(id, field))
+	if err != nil {
+		return "", fmt.Errorf("запись %d, поле %s: %w", id, field, err)
+	}
+	defer crypto.Wipe(pt)
+	return string(pt), nil
+}
+
+// encodeCustomFields сериализует дополнительные поля для шифрования; нет полей — пустая строка
+func encodeCustomFields(fields []models.CustomField) (string, error) {
+	if len(fields) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeCustomFields разбирает результат encodeCustomFields
+func decodeCustomFields(s string) ([]models.CustomField, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var fields []models.CustomField
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		return nil, fmt.Errorf("ошибка чтения дополнительных полей: %w", err)
+	}
+	return fields, nil
+}
+
+// encryptEntry шифрует поля записи в порядке entryFields
+func encryptEntry(keys *crypto.VaultKeys, id int, e models.PasswordEntry) ([][]byte, error) {
+	fields, err := encodeCustomFields(e.Fields)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{e.Title, e.Username, e.Password, e.URL, e.Notes, fields, e.OTP}
+	out := make([][]byte, len(values))
+	for i, v := range values {
+		ct, err := encryptField(keys, id, entryFields[i], v)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = ct
+	}
+	return out, nil
+}
+
+// decryptEntry расшифровывает поля записи, заданные в порядке entryFields
+func decryptEntry(keys *crypto.VaultKeys, id int, ct [][]byte, group string) (models.PasswordEntry, error) {
+	values := make([]string, len(entryFields))
+	for i, field := range entryFields {
+		var err error
+		values[i], err = decryptField(keys, id, field, ct[i])
+		if err != nil {
+			return models.PasswordEntry{}, err
+		}
+	}
+	fields, err := decodeCustomFields(values[5])
+	if err != nil {
+		return models.PasswordEntry{}, fmt.Errorf("запись %d: %w", id, err)
+	}
+	return models.PasswordEntry{
+		ID:       id,
+		Title:    values[0],
+		Username: values[1],
+		Password: values[2],
+		URL:      values[3],
+		Notes:    values[4],
+		Group:    group,
+		Fields:   fields,
+		OTP:      values[6],
+	}, nil
+}
+
+// entryTimeColumns — колонки отметок времени записи в порядке entryTimes
+const entryTimeColumns = "created_at, modified_at, password_changed_at, last_used_at"
+
+// entryTimes — отметки времени записи в виде, в котором они хранятся (Unix-время или NULL)
+type entryTimes [4]sql.NullInt64
+
+// dest возвращает указатели для Scan в порядке entryTimeColumns
+func (t *entryTimes) dest() []any {
+	return []any{&t[0], &t[1], &t[2], &t[3]}
+}
+
+// apply переносит отметки времени в запись
+func (t *entryTimes) apply(e *models.PasswordEntry) {
+	at := func(v sql.NullInt64) time.Time {
+		if !v.Valid {
+			return time.Time{}
+		}
+		return time.Unix(v.Int64, 0)
+	}
+	e.Created = at(t[0])
+	e.Modified = at(t[1])
+	e.PasswordChanged = at(t[2])
+	e.LastUsed = at(t[3])
+}
+
+// loadEntry загружает и расшифровывает одну запись
+func loadEntry(q querier, keys *crypto.VaultKeys, id int) (models.PasswordEntry, error) {
+	ct := make([][]byte, len(entryFields))
+	var groupID sql.NullInt64
+	err := q.QueryRow(`SELECT title, username, password, url, notes, fields, otp, group_id FROM entries WHERE id = ?`, id).
+		Scan(&ct[0], &ct[1], &ct[2], &ct[3], &ct[4], &ct[5], &ct[6], &groupID)
+	if err == sql.ErrNoRows {
+		return models.PasswordEntry{}, fmt.Errorf("запись с id %d не найдена", id)
+	}
+	if err != nil {
+		return models.PasswordEntry{}, err
+	}
+	var group string
+	if groupID.Valid {
+		if group, err = loadGroupPath(q, keys, groupID.Int64); err != nil {
+			return models.PasswordEntry{}, err
+		}
+	}
+	e, err := decryptEntry(keys, id, ct, group)
+	if err != nil {
+		return e, err
+	}
+	e.Tags, err = loadTagsOfEntry(q, keys, id)
+	return e, err
+}
+
+// SaveEntry сохраняет новую запись (шифрует поля) и возвращает её id.
+// id записи входит в присоединённые данные, поэтому строка сначала вставляется
+// с пустыми полями, а затем заполняется шифротекстами в той же транзакции.
+func SaveEntry(dbConn *sql.DB, keys *crypto.VaultKeys, e models.PasswordEntry) (int, error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	id, err := saveEntry(tx, keys, e)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func saveEntry(tx *sql.Tx, keys *crypto.VaultKeys, e models.PasswordEntry) (int, error) {
+	groupId, err := getOrCreateGroup(tx, keys, e.Group)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().Unix()
+	result, err := tx.Exec(`INSERT INTO entries (title, username, password, group_id, created_at, modified_at, password_changed_at)
+		VALUES (X'', X'', X'', ?, ?, ?, ?)`, groupId, now, now, now)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	enc, err := encryptEntry(keys, int(id), e)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`UPDATE entries SET title=?, username=?, password=?, url=?, notes=?, fields=?, otp=? WHERE id=?`,
+		enc[0], enc[1], enc[2], enc[3], enc[4], enc[5], enc[6], id)
+	if err != nil {
+		return 0, err
+	}
+	if err := setEntryTags(tx, keys, int(id), e.Tags); err != nil {
+		return 0, err
+	}
+	return int(id), nil
 }
 
 // LoadAllEntries загружает все записи и дешифрует их
-func LoadAllEntries(dbConn *sql.DB, key []byte) ([]models.PasswordEntry, error) {
-	rows, err := dbConn.Query(`SELECT e.id, e.title, e.username, e.password, e.url, e.notes, g.name as group_name FROM entries e LEFT JOIN groups g ON e.group_id = g.id ORDER BY e.id`)
+func LoadAllEntries(dbConn *sql.DB, keys *crypto.VaultKeys) ([]models.PasswordEntry, error) {
+	groups, err := loadAllGroups(dbConn, keys)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := loadEntryTags(dbConn, keys)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := dbConn.Query(`SELECT id, title, username, password, url, notes, fields, otp, group_id, ` + entryTimeColumns + `
+		FROM entries WHERE deleted_at IS NULL ORDER BY id`)
 	if err != nil {
 		return nil, err
 	}
@@ -61,124 +294,172 @@ func LoadAllEntries(dbConn *sql.DB, key []byte) ([]models.PasswordEntry, error)
 	out := make([]models.PasswordEntry, 0)
 	for rows.Next() {
 		var id int
-		var ctTitle, ctUser, ctPass, ctURL, ctNotes []byte
-		var group sql.NullString
+		ct := make([][]byte, len(entryFields))
+		var groupID sql.NullInt64
+		var times entryTimes
 
-		if err := rows.Scan(&id, &ctTitle, &ctUser, &ctPass, &ctURL, &ctNotes, &group); err != nil {
+		if err := rows.Scan(append([]any{&id, &ct[0], &ct[1], &ct[2], &ct[3], &ct[4], &ct[5], &ct[6], &groupID}, times.dest()...)...); err != nil {
 			return nil, err
 		}
 
-		title := ""
-		if len(ctTitle) > 0 {
-			pt, err := crypto.DecryptData(key, ctTitle)
-			if err != nil {
-				return nil, err
-			}
-			title = string(pt)
-		}
-		username := ""
-		if len(ctUser) > 0 {
-			pt, err := crypto.DecryptData(key, ctUser)
-			if err != nil {
-				return nil, err
-			}
-			username = string(pt)
-		}
-		password := ""
-		if len(ctPass) > 0 {
-			pt, err := crypto.DecryptData(key, ctPass)
-			if err != nil {
-				return nil, err
-			}
-			password = string(pt)
-		}
-		url := ""
-		if len(ctURL) > 0 {
-			pt, err := crypto.DecryptData(key, ctURL)
-			if err != nil {
-				return nil, err
-			}
-			url = string(pt)
-		}
-		notes := ""
-		if len(ctNotes) > 0 {
-			pt, err := crypto.DecryptData(key, ctNotes)
-			if err != nil {
-				return nil, err
-			}
-			notes = string(pt)
+		entry, err := decryptEntry(keys, id, ct, groups[int(groupID.Int64)].Path)
+		if err != nil {
+			return nil, err
 		}
-
-		out = append(out, models.PasswordEntry{
-			ID:       id,
-			Title:    title,
-			Username: username,
-			Password: password,
-			URL:      url,
-			Notes:    notes,
-			Group:    group.String,
-		})
+		times.apply(&entry)
+		entry.Tags = tags[id]
+		out = append(out, entry)
 	}
-	return out, nil
+	return out, rows.Err()
 }
 
-// DeleteEntry удаляет запись по id
+// MarkEntryUsed отмечает, что пароль записи был только что скопирован
+func MarkEntryUsed(dbConn *sql.DB, id int) error {
+	_, err := dbConn.Exec(`UPDATE entries SET last_used_at = ? WHERE id = ?`, time.Now().Unix(), id)
+	return err
+}
+
+// DeleteEntry перемещает запись в корзину (см. PurgeEntry для окончательного удаления)
 func DeleteEntry(dbConn *sql.DB, id int) error {
-	_, err := dbConn.Exec(`DELETE FROM entries WHERE id = ?`, id)
+	_, err := dbConn.Exec(`UPDATE entries SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now().Unix(), id)
 	return err
 }
 
-// UpdateEntry обновляет запись (шифрует поля)
-func UpdateEntry(dbConn *sql.DB, key []byte, e models.PasswordEntry) error {
-	encTitle, err := crypto.EncryptData(key, []byte(e.Title))
+// UpdateEntry обновляет запись (шифрует поля). Если запись изменилась,
+// предыдущая версия сохраняется в историю, а отметки времени изменения обновляются;
+// отметки времени в e не используются.
+func UpdateEntry(dbConn *sql.DB, keys *crypto.VaultKeys, e models.PasswordEntry) error {
+	tx, err := dbConn.Begin()
 	if err != nil {
 		return err
 	}
-	encUser, err := crypto.EncryptData(key, []byte(e.Username))
-	if err != nil {
+	defer tx.Rollback()
+	if err := updateEntry(tx, keys, e); err != nil {
 		return err
 	}
-	encPass, err := crypto.EncryptData(key, []byte(e.Password))
+	return tx.Commit()
+}
+
+func updateEntry(tx *sql.Tx, keys *crypto.VaultKeys, e models.PasswordEntry) error {
+	old, err := loadEntry(tx, keys, e.ID)
 	if err != nil {
 		return err
 	}
-	encURL, err := crypto.EncryptData(key, []byte(e.URL))
+	if len(DiffEntries(old, e)) > 0 {
+		now := time.Now()
+		if err := saveRevision(tx, keys, old, now); err != nil {
+			return err
+		}
+		if err := pruneHistory(tx); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE entries SET modified_at = ? WHERE id = ?`, now.Unix(), e.ID); err != nil {
+			return err
+		}
+		if old.Password != e.Password {
+			if _, err := tx.Exec(`UPDATE entries SET password_changed_at = ? WHERE id = ?`, now.Unix(), e.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	enc, err := encryptEntry(keys, e.ID, e)
 	if err != nil {
 		return err
 	}
-	encNotes, err := crypto.EncryptData(key, []byte(e.Notes))
+	groupId, err := getOrCreateGroup(tx, keys, e.Group)
 	if err != nil {
 		return err
 	}
 
-	_, err = dbConn.Exec(`UPDATE entries SET title=?, username=?, password=?, url=?, notes=?, group_id=(select id from groups where name = ?) WHERE id=?`,
-		encTitle, encUser, encPass, encURL, encNotes, e.Group, e.ID)
-	return err
+	_, err = tx.Exec(`UPDATE entries SET title=?, username=?, password=?, url=?, notes=?, fields=?, otp=?, group_id=? WHERE id=?`,
+		enc[0], enc[1], enc[2], enc[3], enc[4], enc[5], enc[6], groupId, e.ID)
+	if err != nil {
+		return err
+	}
+	return setEntryTags(tx, keys, e.ID, e.Tags)
 }
 
+// DeleteGroup перемещает в корзину группу со всеми подгруппами и их записями. Всё получает
+// одну отметку времени, поэтому RestoreGroup вернёт именно их.
 func DeleteGroup(dbConn *sql.DB, id int) error {
-	_, err := dbConn.Exec(`DELETE FROM groups WHERE id = ?`, id)
-	return err
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := checkGroup(tx, id); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	_, err = tx.Exec(`UPDATE entries SET deleted_at = ? WHERE deleted_at IS NULL AND group_id IN (`+groupSubtree+`)`, now, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE groups SET deleted_at = ? WHERE deleted_at IS NULL AND id IN (`+groupSubtree+`)`, now, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func AddGroup(dbConn *sql.DB, name string) error {
-	_, err := dbConn.Exec(`INSERT INTO groups (name) VALUES (?)`, name)
+// AddGroup создаёт группу name внутри группы с путём parent; пустой parent — группа верхнего уровня
+func AddGroup(dbConn *sql.DB, keys *crypto.VaultKeys, name, parent string) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := addGroup(tx, keys, name, parent); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addGroup(tx *sql.Tx, keys *crypto.VaultKeys, name, parent string) error {
+	name = strings.TrimSpace(name)
+	if err := checkGroupName(name); err != nil {
+		return err
+	}
+	parentID, err := findParentGroup(tx, keys, parent)
+	if err != nil {
+		return err
+	}
+	path := JoinGroupPath(parent, name)
+	_, trashed, err := findChildGroup(tx, keys, parentID, name)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case !trashed:
+		return fmt.Errorf("группа '%s' уже существует", path)
+	}
+	// группа из корзины с тем же путём достаётся оттуда, как при сохранении записи в неё
+	_, err = getOrCreateGroup(tx, keys, path)
 	return err
 }
 
-func GetGroup(dbConn *sql.DB) (listGroup []models.Groups, err error) {
-	rows, err := dbConn.Query(`SELECT * FROM groups`)
+func GetGroup(dbConn *sql.DB, keys *crypto.VaultKeys) (listGroup []models.Groups, err error) {
+	return getGroups(dbConn, keys)
+}
+
+func getGroups(dbConn querier, keys *crypto.VaultKeys) (listGroup []models.Groups, err error) {
+	rows, err := dbConn.Query(`SELECT id, name, IFNULL(parent_id, 0) FROM groups WHERE deleted_at IS NULL ORDER BY id`)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var group models.Groups
-		err = rows.Scan(&group.Id, &group.Name)
+		var ct []byte
+		err = rows.Scan(&group.Id, &ct, &group.ParentId)
 		if err != nil {
 			err = fmt.Errorf("ошибка сканирования строки: %w", err)
 			return
 		}
+		group.Name, err = decryptGroupName(keys, group.Id, ct)
+		if err != nil {
+			return
+		}
 		listGroup = append(listGroup, group)
 	}
 
@@ -186,33 +467,51 @@ func GetGroup(dbConn *sql.DB) (listGroup []models.Groups, err error) {
 		err = fmt.Errorf("ошибка при обходе строк: %w", err)
 		return
 	}
+	// родители живой группы тоже не в корзине, поэтому путь собирается из того же списка
+	byID := make(map[int]models.Groups, len(listGroup))
+	for _, g := range listGroup {
+		byID[g.Id] = g
+	}
+	for i := range listGroup {
+		listGroup[i].Path = pathOf(byID, listGroup[i].Id)
+	}
 	return
 }
 
-func UpdateGroup(dbConn *sql.DB, oldName, newName string) (err error) {
-	groupId, err := getOrCreateGroup(dbConn, oldName)
-	if err != nil {
+// UpdateGroup переименовывает группу id; имя должно быть свободно среди подгрупп её родителя
+func UpdateGroup(dbConn *sql.DB, keys *crypto.VaultKeys, id int, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if err := checkGroupName(newName); err != nil {
 		return err
 	}
-	_, err = dbConn.Exec(`Update groups set name = ? where id = ?`, newName, groupId)
+	tx, err := dbConn.Begin()
 	if err != nil {
 		return err
 	}
-	return
-}
-
-func DeleteEntriesInGroup(dbConn *sql.DB, name string) ( id int, err error) {
-	err = dbConn.QueryRow(`SELECT id FROM groups WHERE name = ?`, name).Scan(&id)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			err = fmt.Errorf("Группа '%s' не найдена", name)
-			return
-		} 
-		return
+	defer tx.Rollback()
+	if err := checkGroup(tx, id); err != nil {
+		return err
+	}
+	var parent sql.NullInt64
+	if err := tx.QueryRow(`SELECT parent_id FROM groups WHERE id = ?`, id).Scan(&parent); err != nil {
+		return err
+	}
+	other, trashed, err := findChildGroup(tx, keys, parent, newName)
+	switch {
+	case err == sql.ErrNoRows, err == nil && other == int64(id):
+	case err != nil:
+		return err
+	case trashed:
+		return fmt.Errorf("группа '%s' находится в корзине: восстановите её или удалите навсегда", newName)
+	default:
+		return fmt.Errorf("группа '%s' уже существует", newName)
 	}
-	_, err = dbConn.Exec(`DELETE FROM entries WHERE group_id = ?`, id)
+	ct, err := encryptGroupName(keys, id, newName)
 	if err != nil {
-		return
+		return err
 	}
-	return
+	if _, err := tx.Exec(`UPDATE groups SET name = ?, name_index = ? WHERE id = ?`, ct, groupIndex(keys, newName), id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// GroupSeparator разделяет уровни в пути группы: «Работа/Почта». Имена групп уникальны
+// только среди подгрупп одного родителя, поэтому группу однозначно задаёт её путь.
+const GroupSeparator = "/"
+
+// groupSubtree — подзапрос: группа с id ? и все её потомки.
+// UNION вместо UNION ALL не даёт зациклиться, если родители в базе испорчены.
+const groupSubtree = `WITH RECURSIVE subtree(id) AS (
+		SELECT ?
+		UNION SELECT g.id FROM groups g JOIN subtree s ON g.parent_id = s.id)
+	SELECT id FROM subtree`
+
+// groupPath — подзапрос: группа с id ? и все её предки
+const groupPath = `WITH RECURSIVE path(id) AS (
+		SELECT ?
+		UNION SELECT g.parent_id FROM groups g JOIN path p ON g.id = p.id WHERE g.parent_id IS NOT NULL)
+	SELECT id FROM path`
+
+// SplitGroupPath разбивает путь группы на имена уровней, пропуская пустые
+func SplitGroupPath(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(path, GroupSeparator) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// JoinGroupPath собирает путь группы из имён уровней; пустые уровни пропускаются
+func JoinGroupPath(parts ...string) string {
+	return strings.Join(SplitGroupPath(strings.Join(parts, GroupSeparator)), GroupSeparator)
+}
+
+// CleanGroupName приводит имя группы из другого источника (импорт, старая база) к допустимому:
+// без пробелов по краям и без разделителя уровней, который заменяется похожей косой чертой «∕»
+func CleanGroupName(name string) string {
+	return strings.ReplaceAll(strings.TrimSpace(name), GroupSeparator, "∕")
+}
+
+// checkGroupName проверяет имя новой или переименованной группы
+func checkGroupName(name string) error {
+	if name == "" {
+		return errors.New("имя группы не может быть пустым")
+	}
+	if strings.Contains(name, GroupSeparator) {
+		return fmt.Errorf("имя группы не может содержать «%s»: это разделитель вложенных групп", GroupSeparator)
+	}
+	return nil
+}
+
+// InGroup сообщает, лежит ли группа с путём group в группе path или в одной из её подгрупп
+func InGroup(group, path string) bool {
+	return group == path || strings.HasPrefix(group, path+GroupSeparator)
+}
+
+// restoreGroupPath достаёт из корзины группу вместе с её предками, чтобы она снова была видна в дереве
+func restoreGroupPath(q querier, id int64) error {
+	_, err := q.Exec(`UPDATE groups SET deleted_at = NULL WHERE deleted_at IS NOT NULL AND id IN (`+groupPath+`)`, id)
+	return err
+}
+
+// findChildGroup ищет среди подгрупп parent (NULL — верхний уровень) группу name, включая корзину
+func findChildGroup(q querier, keys *crypto.VaultKeys, parent sql.NullInt64, name string) (id int64, trashed bool, err error) {
+	err = q.QueryRow(`SELECT id, deleted_at IS NOT NULL FROM groups WHERE IFNULL(parent_id, 0) = ? AND name_index = ?`,
+		parent.Int64, groupIndex(keys, name)).Scan(&id, &trashed)
+	return
+}
+
+// findGroup ищет группу (не в корзине) по пути
+func findGroup(q querier, keys *crypto.VaultKeys, path string) (int, error) {
+	parts := SplitGroupPath(path)
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("Группа '%s' не найдена", path)
+	}
+	var parent sql.NullInt64
+	for _, name := range parts {
+		id, trashed, err := findChildGroup(q, keys, parent, name)
+		if err == sql.ErrNoRows || (err == nil && trashed) {
+			return 0, fmt.Errorf("Группа '%s' не найдена", path)
+		}
+		if err != nil {
+			return 0, err
+		}
+		parent = sql.NullInt64{Int64: id, Valid: true}
+	}
+	return int(parent.Int64), nil
+}
+
+// FindGroup возвращает id группы (не в корзине) по пути вида «Работа/Почта»
+func FindGroup(dbConn *sql.DB, keys *crypto.VaultKeys, path string) (int, error) {
+	return findGroup(dbConn, keys, path)
+}
+
+// findParentGroup ищет будущего родителя группы по пути; пустой путь — верхний уровень
+func findParentGroup(q querier, keys *crypto.VaultKeys, parent string) (sql.NullInt64, error) {
+	if len(SplitGroupPath(parent)) == 0 {
+		return sql.NullInt64{}, nil
+	}
+	id, err := findGroup(q, keys, parent)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	return sql.NullInt64{Int64: int64(id), Valid: true}, nil
+}
+
+// checkGroup проверяет, что группа id есть в базе и не лежит в корзине
+func checkGroup(q querier, id int) error {
+	var trashed bool
+	err := q.QueryRow(`SELECT deleted_at IS NOT NULL FROM groups WHERE id = ?`, id).Scan(&trashed)
+	if err == sql.ErrNoRows || (err == nil && trashed) {
+		return fmt.Errorf("группа с id %d не найдена", id)
+	}
+	return err
+}
+
+// nameTaken сообщает, есть ли у parentID (0 — верхний уровень) другая подгруппа, кроме id,
+// с тем же именем, что у группы id; группы в корзине тоже учитываются
+func nameTaken(q querier, id, parentID int) (bool, error) {
+	var taken bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM groups WHERE IFNULL(parent_id, 0) = ? AND id != ?
+		AND name_index = (SELECT name_index FROM groups WHERE id = ?))`, parentID, id, id).Scan(&taken)
+	return taken, err
+}
+
+// MoveGroup делает группу id подгруппой parentID вместе со всеми её подгруппами;
+// parentID 0 переносит группу на верхний уровень
+func MoveGroup(dbConn *sql.DB, id, parentID int) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := checkGroup(tx, id); err != nil {
+		return err
+	}
+	parent := sql.NullInt64{}
+	if parentID != 0 {
+		if err := checkGroup(tx, parentID); err != nil {
+			return err
+		}
+		var inside bool
+		if err := tx.QueryRow(`SELECT ? IN (`+groupSubtree+`)`, parentID, id).Scan(&inside); err != nil {
+			return err
+		}
+		if inside {
+			return errors.New("нельзя переместить группу внутрь неё самой")
+		}
+		parent = sql.NullInt64{Int64: int64(parentID), Valid: true}
+	}
+	taken, err := nameTaken(tx, id, parentID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.New("там уже есть группа с таким именем (возможно, в корзине): переименуйте одну из них")
+	}
+	if _, err := tx.Exec(`UPDATE groups SET parent_id = ? WHERE id = ?`, parent, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// loadAllGroups расшифровывает все группы, включая группы в корзине, и вычисляет их пути
+func loadAllGroups(q querier, keys *crypto.VaultKeys) (map[int]models.Groups, error) {
+	rows, err := q.Query(`SELECT id, name, IFNULL(parent_id, 0) FROM groups`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	groups := map[int]models.Groups{}
+	for rows.Next() {
+		var g models.Groups
+		var ct []byte
+		if err := rows.Scan(&g.Id, &ct, &g.ParentId); err != nil {
+			return nil, err
+		}
+		if g.Name, err = decryptGroupName(keys, g.Id, ct); err != nil {
+			return nil, err
+		}
+		groups[g.Id] = g
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for id, g := range groups {
+		g.Path = pathOf(groups, id)
+		groups[id] = g
+	}
+	return groups, nil
+}
+
+// pathOf — путь группы id по уже загруженным группам; испорченная цепочка родителей обрывается
+func pathOf(groups map[int]models.Groups, id int) string {
+	var parts []string
+	for seen := map[int]bool{}; id != 0 && !seen[id]; id = groups[id].ParentId {
+		g, ok := groups[id]
+		if !ok {
+			break
+		}
+		seen[id] = true
+		parts = append([]string{g.Name}, parts...)
+	}
+	return strings.Join(parts, GroupSeparator)
+}
+
+// loadGroupPath возвращает путь одной группы
+func loadGroupPath(q querier, keys *crypto.VaultKeys, id int64) (string, error) {
+	var parts []string
+	for seen := map[int64]bool{}; !seen[id]; {
+		seen[id] = true
+		var ct []byte
+		var parent sql.NullInt64
+		err := q.QueryRow(`SELECT name, parent_id FROM groups WHERE id = ?`, id).Scan(&ct, &parent)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		name, err := decryptGroupName(keys, int(id), ct)
+		if err != nil {
+			return "", err
+		}
+		parts = append([]string{name}, parts...)
+		if !parent.Valid {
+			break
+		}
+		id = parent.Int64
+	}
+	return strings.Join(parts, GroupSeparator), nil
+}
@@ -0,0 +1,260 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// historyFields — зашифрованные колонки entry_history: поля записи, имя её группы и теги через запятую
+var historyFields = append(append([]string{}, entryFields...), "group_name", "tags")
+
+// historyAD — присоединённые данные поля версии: привязка к id версии, id записи и колонке
+func historyAD(id, entryID int, field string) []byte {
+	return []byte(fmt.Sprintf("entry_history:%d:%d:%s", id, entryID, field))
+}
+
+// saveRevision сохраняет версию записи e, действовавшую до момента changedAt
+func saveRevision(tx *sql.Tx, keys *crypto.VaultKeys, e models.PasswordEntry, changedAt time.Time) error {
+	result, err := tx.Exec(`INSERT INTO entry_history (entry_id, changed_at, title, username, password) VALUES (?, ?, X'', X'', X'')`,
+		e.ID, changedAt.Unix())
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	fields, err := encodeCustomFields(e.Fields)
+	if err != nil {
+		return err
+	}
+	values := []string{e.Title, e.Username, e.Password, e.URL, e.Notes, fields, e.OTP, e.Group, strings.Join(e.Tags, ",")}
+	ct := make([]any, len(values))
+	for i, v := range values {
+		pt := []byte(v)
+		ct[i], err = crypto.EncryptData(keys.Enc, pt, historyAD(int(id), e.ID, historyFields[i]))
+		crypto.Wipe(pt)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE entry_history SET title=?, username=?, password=?, url=?, notes=?, fields=?, otp=?, group_name=?, tags=? WHERE id=?`,
+		append(ct, id)...)
+	return err
+}
+
+// addRevisions добавляет записи entryID версии из другой базы (например, историю KeePass),
+// сохраняя их даты; лимиты хранения истории применяются как обычно
+func addRevisions(tx *sql.Tx, keys *crypto.VaultKeys, entryID int, revisions []models.EntryRevision) error {
+	for _, rev := range revisions {
+		e := rev.Entry
+		e.ID = entryID
+		if err := saveRevision(tx, keys, e, rev.ChangedAt); err != nil {
+			return err
+		}
+	}
+	return pruneHistory(tx)
+}
+
+// scanRevision расшифровывает строку entry_history
+func scanRevision(keys *crypto.VaultKeys, scan func(dest ...any) error) (models.EntryRevision, error) {
+	var rev models.EntryRevision
+	var changedAt int64
+	ct := make([][]byte, len(historyFields))
+	if err := scan(&rev.ID, &rev.EntryID, &changedAt, &ct[0], &ct[1], &ct[2], &ct[3], &ct[4], &ct[5], &ct[6], &ct[7], &ct[8]); err != nil {
+		return rev, err
+	}
+	values := make([]string, len(historyFields))
+	for i, field := range historyFields {
+		if len(ct[i]) == 0 {
+			continue
+		}
+		pt, err := crypto.DecryptData(keys.Enc, ct[i], historyAD(rev.ID, rev.EntryID, field))
+		if err != nil {
+			return rev, fmt.Errorf("версия %d записи %d, поле %s: %w", rev.ID, rev.EntryID, field, err)
+		}
+		values[i] = string(pt)
+		crypto.Wipe(pt)
+	}
+	fields, err := decodeCustomFields(values[5])
+	if err != nil {
+		return rev, fmt.Errorf("версия %d записи %d: %w", rev.ID, rev.EntryID, err)
+	}
+	rev.ChangedAt = time.Unix(changedAt, 0)
+	rev.Entry = models.PasswordEntry{
+		ID:       rev.EntryID,
+		Title:    values[0],
+		Username: values[1],
+		Password: values[2],
+		URL:      values[3],
+		Notes:    values[4],
+		Group:    values[7],
+		Fields:   fields,
+		OTP:      values[6],
+		Tags:     ParseTags(values[8]),
+	}
+	return rev, nil
+}
+
+// ListRevisions возвращает сохранённые версии записи, от новых к старым
+func ListRevisions(dbConn *sql.DB, keys *crypto.VaultKeys, entryID int) ([]models.EntryRevision, error) {
+	return listRevisions(dbConn, keys, entryID)
+}
+
+func listRevisions(q querier, keys *crypto.VaultKeys, entryID int) ([]models.EntryRevision, error) {
+	rows, err := q.Query(`SELECT id, entry_id, changed_at, title, username, password, url, notes, fields, otp, group_name, tags
+		FROM entry_history WHERE entry_id = ? ORDER BY changed_at DESC, id DESC`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.EntryRevision
+	for rows.Next() {
+		rev, err := scanRevision(keys, rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rev)
+	}
+	return out, rows.Err()
+}
+
+// RestoreRevision возвращает записи содержимое сохранённой версии.
+// Текущее содержимое при этом само попадает в историю, так что восстановление можно отменить.
+// Запись в корзине сначала нужно достать из неё: иначе версия незаметно изменила бы удалённую запись.
+func RestoreRevision(dbConn *sql.DB, keys *crypto.VaultKeys, revisionID int) error {
+	row := dbConn.QueryRow(`SELECT id, entry_id, changed_at, title, username, password, url, notes, fields, otp, group_name, tags
+		FROM entry_history WHERE id = ?`, revisionID)
+	rev, err := scanRevision(keys, row.Scan)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("версия %d не найдена", revisionID)
+	}
+	if err != nil {
+		return err
+	}
+	var deletedAt sql.NullInt64
+	err = dbConn.QueryRow(`SELECT deleted_at FROM entries WHERE id = ?`, rev.EntryID).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("запись с id %d не найдена", rev.EntryID)
+	}
+	if err != nil {
+		return err
+	}
+	if deletedAt.Valid {
+		return errors.New("запись находится в корзине: сначала восстановите её из корзины")
+	}
+	return UpdateEntry(dbConn, keys, rev.Entry)
+}
+
+// DiffEntries возвращает поля, которые отличаются в версиях from и to.
+// Дополнительные поля сравниваются по имени и позиции; смена типа тоже считается изменением.
+func DiffEntries(from, to models.PasswordEntry) []models.FieldChange {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{models.TITLE, from.Title, to.Title},
+		{models.GROUP, from.Group, to.Group},
+		{models.LOGIN, from.Username, to.Username},
+		{models.PASSWD, from.Password, to.Password},
+		{models.URL, from.URL, to.URL},
+		{models.NOTES, from.Notes, to.Notes},
+		{models.TAGS, strings.Join(from.Tags, ", "), strings.Join(to.Tags, ", ")},
+		{models.OTP, from.OTP, to.OTP},
+	}
+	var changes []models.FieldChange
+	for _, f := range fields {
+		if f.old != f.new {
+			hidden := f.name == models.PASSWD || f.name == models.OTP
+			changes = append(changes, models.FieldChange{Field: f.name, Old: f.old, New: f.new, Hidden: hidden})
+		}
+	}
+	for i := 0; i < max(len(from.Fields), len(to.Fields)); i++ {
+		var old, cur models.CustomField
+		if i < len(from.Fields) {
+			old = from.Fields[i]
+		}
+		if i < len(to.Fields) {
+			cur = to.Fields[i]
+		}
+		if old == cur {
+			continue
+		}
+		name := cur.Name
+		switch {
+		case cur.Name == "": // поле удалено
+			name = old.Name
+		case old.Name != "" && old.Name != cur.Name:
+			name = old.Name + " → " + cur.Name
+		}
+		changes = append(changes, models.FieldChange{
+			Field:  name,
+			Old:    old.Value,
+			New:    cur.Value,
+			Hidden: old.Type == models.FieldHidden || cur.Type == models.FieldHidden,
+		})
+	}
+	return changes
+}
+
+// GetHistoryRetention возвращает настройки хранения истории
+func GetHistoryRetention(dbConn *sql.DB) (models.HistoryRetention, error) {
+	return readHistoryRetention(dbConn)
+}
+
+func readHistoryRetention(q querier) (r models.HistoryRetention, err error) {
+	err = q.QueryRow(`SELECT history_max_revisions, history_max_days FROM meta WHERE id = 1`).Scan(&r.MaxRevisions, &r.MaxDays)
+	return
+}
+
+// SetHistoryRetention сохраняет настройки хранения истории и сразу удаляет лишние версии
+func SetHistoryRetention(dbConn *sql.DB, r models.HistoryRetention) error {
+	if r.MaxRevisions < 0 || r.MaxDays < 0 {
+		return fmt.Errorf("ограничения истории не могут быть отрицательными")
+	}
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE meta SET history_max_revisions = ?, history_max_days = ? WHERE id = 1`, r.MaxRevisions, r.MaxDays); err != nil {
+		return err
+	}
+	if err := pruneHistory(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// pruneHistory удаляет версии сверх лимита на запись и старше лимита по возрасту
+func pruneHistory(tx *sql.Tx) error {
+	r, err := readHistoryRetention(tx)
+	if err != nil {
+		return err
+	}
+	if r.MaxDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -r.MaxDays).Unix()
+		if _, err := tx.Exec(`DELETE FROM entry_history WHERE changed_at < ?`, cutoff); err != nil {
+			return err
+		}
+	}
+	if r.MaxRevisions > 0 {
+		_, err := tx.Exec(`DELETE FROM entry_history WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY entry_id ORDER BY changed_at DESC, id DESC) AS n
+				FROM entry_history
+			) WHERE n > ?)`, r.MaxRevisions)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"database/sql"
+	"io"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// Import — импорт записей из файла одной транзакцией: изменения появляются в базе только
+// после Commit, а Rollback после ошибки оставляет базу такой, какой она была до импорта.
+// Методы повторяют одноимённые функции пакета; пока импорт не завершён, база меняется только через него.
+type Import struct {
+	tx   *sql.Tx
+	keys *crypto.VaultKeys
+}
+
+// BeginImport начинает импорт; после него нужен Commit или Rollback
+func BeginImport(dbConn *sql.DB, keys *crypto.VaultKeys) (*Import, error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Import{tx: tx, keys: keys}, nil
+}
+
+// Groups возвращает группы, видимые внутри импорта
+func (im *Import) Groups() ([]models.Groups, error) {
+	return getGroups(im.tx, im.keys)
+}
+
+// AddGroup создаёт группу name внутри parent, как AddGroup
+func (im *Import) AddGroup(name, parent string) error {
+	return addGroup(im.tx, im.keys, name, parent)
+}
+
+// SaveEntry добавляет запись, как SaveEntry
+func (im *Import) SaveEntry(e models.PasswordEntry) (int, error) {
+	return saveEntry(im.tx, im.keys, e)
+}
+
+// UpdateEntry обновляет запись, сохраняя прежнюю версию в историю, как UpdateEntry
+func (im *Import) UpdateEntry(e models.PasswordEntry) error {
+	return updateEntry(im.tx, im.keys, e)
+}
+
+// AddAttachment прикрепляет к записи файл, как AddAttachment
+func (im *Import) AddAttachment(entryID int, name string, r io.Reader) error {
+	_, err := addAttachment(im.tx, im.keys, entryID, name, r)
+	return err
+}
+
+// AddRevisions добавляет записи entryID версии из другой базы (например, историю KeePass),
+// сохраняя их даты; лимиты хранения истории применяются как обычно
+func (im *Import) AddRevisions(entryID int, revisions []models.EntryRevision) error {
+	return addRevisions(im.tx, im.keys, entryID, revisions)
+}
+
+// Commit сохраняет всё импортированное
+func (im *Import) Commit() error {
+	return im.tx.Commit()
+}
+
+// Rollback отменяет импорт; после Commit ничего не делает
+func (im *Import) Rollback() error {
+	err := im.tx.Rollback()
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
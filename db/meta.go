@@ -2,6 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/reinbowARA/PassLedger/crypto"
 )
 
 // GetMeta возвращает salt, iterations, verifier (id=1)
@@ -16,3 +20,146 @@ func UpdateVerifier(db *sql.DB, newVerifier []byte) error {
 	_, err := db.Exec(`UPDATE meta SET verifier = ? WHERE id = 1`, newVerifier)
 	return err
 }
+
+// readKDFParams читает соль и параметры KDF из meta
+func readKDFParams(db querier) (salt []byte, p crypto.KDFParams, err error) {
+	row := db.QueryRow(`SELECT salt, kdf, iterations, argon_memory, argon_time, argon_threads FROM meta WHERE id = 1`)
+	err = row.Scan(&salt, &p.Algorithm, &p.Iterations, &p.Memory, &p.Time, &p.Threads)
+	if err != nil {
+		err = errors.New("ошибка чтения метаданных БД")
+	}
+	return
+}
+
+// writeKDFParams сохраняет соль, параметры KDF и обёрнутый ключ хранилища
+func writeKDFParams(db querier, salt []byte, p crypto.KDFParams, wrapped []byte) error {
+	_, err := db.Exec(`UPDATE meta SET salt = ?, kdf = ?, iterations = ?, argon_memory = ?, argon_time = ?, argon_threads = ?, wrapped_key = ? WHERE id = 1`,
+		salt, p.Algorithm, p.Iterations, p.Memory, p.Time, p.Threads, wrapped)
+	return err
+}
+
+// GetKDFParams возвращает текущие параметры KDF базы
+func GetKDFParams(db *sql.DB) (crypto.KDFParams, error) {
+	_, p, err := readKDFParams(db)
+	return p, err
+}
+
+// GetPendingKDFUpgrade возвращает параметры KDF, запланированные к применению при следующем входе
+func GetPendingKDFUpgrade(db *sql.DB) (p crypto.KDFParams, pending bool, err error) {
+	var raw sql.NullString
+	if err = db.QueryRow(`SELECT kdf_upgrade FROM meta WHERE id = 1`).Scan(&raw); err != nil || !raw.Valid {
+		return
+	}
+	err = json.Unmarshal([]byte(raw.String), &p)
+	return p, err == nil, err
+}
+
+// ScheduleKDFUpgrade планирует смену параметров KDF: для обёртки ключа хранилища нужен
+// мастер-пароль, поэтому новые параметры применяются при следующем входе
+func ScheduleKDFUpgrade(db *sql.DB, p crypto.KDFParams) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE meta SET kdf_upgrade = ? WHERE id = 1`, string(raw))
+	return err
+}
+
+// UpgradeKDF сразу переводит базу на новые параметры KDF
+func UpgradeKDF(db *sql.DB, masterPassword, keyfile []byte, p crypto.KDFParams) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := rewrapVaultKey(tx, masterPassword, keyfile, masterPassword, keyfile, p); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE meta SET kdf_upgrade = NULL WHERE id = 1`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyPendingKDFUpgrade применяет запланированные ScheduleKDFUpgrade параметры
+func applyPendingKDFUpgrade(db *sql.DB, masterPassword, keyfile []byte) error {
+	p, pending, err := GetPendingKDFUpgrade(db)
+	if err != nil || !pending {
+		return err
+	}
+	return UpgradeKDF(db, masterPassword, keyfile, p)
+}
+
+// rewrapVaultKey расшифровывает ключ хранилища ключом из oldPassword/oldKeyfile и заново
+// шифрует его ключом из newPassword/newKeyfile с новой солью и параметрами p
+func rewrapVaultKey(tx *sql.Tx, oldPassword, oldKeyfile, newPassword, newKeyfile []byte, p crypto.KDFParams) error {
+	kek, err := deriveKEK(tx, oldPassword, oldKeyfile)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(kek)
+	var wrapped []byte
+	if err := tx.QueryRow(`SELECT wrapped_key FROM meta WHERE id = 1`).Scan(&wrapped); err != nil {
+		return err
+	}
+	vaultKey, err := crypto.UnwrapKey(kek, wrapped)
+	if err != nil {
+		return wrongCredentials(len(oldKeyfile) > 0)
+	}
+	defer crypto.Wipe(vaultKey)
+
+	salt, err := crypto.GenerateSalt(16)
+	if err != nil {
+		return err
+	}
+	newKEK, err := passwordKEK(newPassword, newKeyfile, salt, p)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(newKEK)
+	newWrapped, err := crypto.WrapKey(newKEK, vaultKey)
+	if err != nil {
+		return err
+	}
+	if err := writeKDFParams(tx, salt, p, newWrapped); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE meta SET keyfile_required = ? WHERE id = 1`, len(newKeyfile) > 0)
+	return err
+}
+
+// ChangeMasterPassword меняет мастер-пароль и ключевой файл: проверяет текущие и заново
+// шифрует ключ хранилища ключом, выведенным из новых и новой соли. newKeyfile == nil
+// отключает ключевой файл. Сами записи не перешифровываются — ключ хранилища остаётся прежним.
+func ChangeMasterPassword(db *sql.DB, oldPassword, oldKeyfile, newPassword, newKeyfile []byte) error {
+	if len(newPassword) == 0 {
+		return errors.New("новый мастер-пароль не может быть пустым")
+	}
+	if newKeyfile != nil && len(newKeyfile) == 0 {
+		return ErrEmptyKeyfile
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, p, err := readKDFParams(tx)
+	if err != nil {
+		return err
+	}
+	if err := rewrapVaultKey(tx, oldPassword, oldKeyfile, newPassword, newKeyfile, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// KeyfileRequired сообщает, нужен ли для входа в базу ключевой файл
+func KeyfileRequired(db *sql.DB) (required bool, err error) {
+	err = db.QueryRow(`SELECT keyfile_required FROM meta WHERE id = 1`).Scan(&required)
+	return
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+)
+
+// CurrentSchemaVersion — версия схемы базы, с которой работает приложение.
+// Хранится в meta.schema_version; у баз до появления версий её нет, и они считаются версией 0.
+// Формат шифротекстов версионируется отдельно (см. CurrentCipherVersion).
+const CurrentSchemaVersion = 11
+
+var (
+	ErrNotVault     = errors.New("файл не является базой PassLedger")
+	ErrNewerVersion = errors.New("база создана более новой версией PassLedger")
+)
+
+// migration переводит схему с версии version-1 на version
+type migration struct {
+	version     int
+	description string
+	apply       func(tx *sql.Tx) error
+}
+
+// migrations — упорядоченный список миграций схемы; новые добавляются в конец
+// со следующим номером, а table.sql описывает схему после последней из них
+var migrations = []migration{
+	{1, "метаданные шифрования, KDF и ключевого файла", func(tx *sql.Tx) error {
+		columns := []struct{ name, definition string }{
+			{"cipher_version", "INTEGER NOT NULL DEFAULT 0"},
+			{"wrapped_key", "BLOB"},
+			{"kdf", "TEXT NOT NULL DEFAULT '" + crypto.KDFPBKDF2Streebog + "'"},
+			{"argon_memory", "INTEGER NOT NULL DEFAULT 0"},
+			{"argon_time", "INTEGER NOT NULL DEFAULT 0"},
+			{"argon_threads", "INTEGER NOT NULL DEFAULT 0"},
+			{"kdf_upgrade", "TEXT"},
+			{"keyfile_required", "INTEGER NOT NULL DEFAULT 0"},
+			{"schema_version", "INTEGER NOT NULL DEFAULT 0"},
+		}
+		for _, c := range columns {
+			if err := ensureColumn(tx, "meta", c.name, c.definition); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{2, "слепой индекс имён групп", func(tx *sql.Tx) error {
+		if err := ensureColumn(tx, "groups", "name_index", "BLOB"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS groups_name_index ON groups (name_index)`)
+		return err
+	}},
+	{3, "история изменений записей", func(tx *sql.Tx) error {
+		if err := ensureColumn(tx, "meta", "history_max_revisions", "INTEGER NOT NULL DEFAULT 10"); err != nil {
+			return err
+		}
+		if err := ensureColumn(tx, "meta", "history_max_days", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			CREATE TABLE entry_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				entry_id INTEGER NOT NULL,
+				changed_at INTEGER NOT NULL,
+				title BLOB NOT NULL,
+				username BLOB NOT NULL,
+				password BLOB NOT NULL,
+				url BLOB,
+				notes BLOB,
+				group_name BLOB
+			);
+			CREATE INDEX entry_history_entry ON entry_history (entry_id, changed_at);`)
+		return err
+	}},
+	{4, "корзина для записей и групп", func(tx *sql.Tx) error {
+		if err := ensureColumn(tx, "meta", "trash_days", "INTEGER NOT NULL DEFAULT 30"); err != nil {
+			return err
+		}
+		if err := ensureColumn(tx, "entries", "deleted_at", "INTEGER"); err != nil {
+			return err
+		}
+		return ensureColumn(tx, "groups", "deleted_at", "INTEGER")
+	}},
+	{5, "отметки времени записей", func(tx *sql.Tx) error {
+		for _, column := range []string{"created_at", "modified_at", "password_changed_at", "last_used_at"} {
+			if err := ensureColumn(tx, "entries", column, "INTEGER"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{6, "дополнительные поля записей", func(tx *sql.Tx) error {
+		if err := ensureColumn(tx, "entries", "fields", "BLOB"); err != nil {
+			return err
+		}
+		return ensureColumn(tx, "entry_history", "fields", "BLOB")
+	}},
+	{7, "вложения", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE attachments (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				entry_id INTEGER NOT NULL,
+				name BLOB NOT NULL,
+				size INTEGER NOT NULL,
+				created_at INTEGER NOT NULL
+			);
+			CREATE INDEX attachments_entry ON attachments (entry_id);
+			CREATE TABLE attachment_chunks (
+				attachment_id INTEGER NOT NULL,
+				seq INTEGER NOT NULL,
+				data BLOB NOT NULL,
+				PRIMARY KEY (attachment_id, seq)
+			);`)
+		return err
+	}},
+	{8, "теги записей", func(tx *sql.Tx) error {
+		if err := ensureColumn(tx, "entry_history", "tags", "BLOB"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			CREATE TABLE tags (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name BLOB NOT NULL,
+				name_index BLOB NOT NULL
+			);
+			CREATE UNIQUE INDEX tags_name_index ON tags (name_index);
+			CREATE TABLE entry_tags (
+				entry_id INTEGER NOT NULL,
+				tag_id INTEGER NOT NULL,
+				PRIMARY KEY (entry_id, tag_id)
+			);
+			CREATE INDEX entry_tags_tag ON entry_tags (tag_id);`)
+		return err
+	}},
+	{9, "вложенные группы", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "groups", "parent_id", "INTEGER")
+	}},
+	{10, "имена групп уникальны внутри родителя", func(tx *sql.Tx) error {
+		// пути групп в версиях записей переводит upgradeGroupPaths: для этого нужен ключ
+		if err := ensureColumn(tx, "meta", "group_paths", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			DROP INDEX IF EXISTS groups_name_index;
+			CREATE UNIQUE INDEX groups_name_index ON groups (IFNULL(parent_id, 0), name_index);`)
+		return err
+	}},
+	{11, "секреты TOTP", func(tx *sql.Tx) error {
+		if err := ensureColumn(tx, "entries", "otp", "BLOB"); err != nil {
+			return err
+		}
+		return ensureColumn(tx, "entry_history", "otp", "BLOB")
+	}},
+}
+
+// hasColumn проверяет, есть ли колонка в таблице
+func hasColumn(q querier, table, column string) (bool, error) {
+	rows, err := q.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// ensureColumn добавляет колонку в таблицу, если её ещё нет. Миграции 1 и 2 собраны из
+// обновлений, которые раньше применялись без учёта версии, поэтому часть колонок может уже быть.
+func ensureColumn(q querier, table, column, definition string) error {
+	ok, err := hasColumn(q, table, column)
+	if err != nil || ok {
+		return err
+	}
+	_, err = q.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// schemaVersion читает версию схемы из meta
+func schemaVersion(q querier) (int, error) {
+	ok, err := hasColumn(q, "meta", "id")
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrNotVault
+	}
+	ok, err = hasColumn(q, "meta", "schema_version")
+	if err != nil || !ok {
+		return 0, err
+	}
+	var version int
+	if err := q.QueryRow(`SELECT schema_version FROM meta WHERE id = 1`).Scan(&version); err != nil {
+		return 0, errors.New("ошибка чтения метаданных БД")
+	}
+	return version, nil
+}
+
+// checkSchemaVersion читает версию схемы и отказывается открывать базу более новой версии
+func checkSchemaVersion(q querier) (int, error) {
+	version, err := schemaVersion(q)
+	if err != nil {
+		return 0, err
+	}
+	if version > CurrentSchemaVersion {
+		return 0, fmt.Errorf("%w (версия схемы %d, поддерживается до %d), обновите приложение", ErrNewerVersion, version, CurrentSchemaVersion)
+	}
+	return version, nil
+}
+
+// applyMigrations применяет внутри tx миграции после version и записывает новую версию схемы
+func applyMigrations(tx *sql.Tx, version int) error {
+	if version == CurrentSchemaVersion {
+		return nil
+	}
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := m.apply(tx); err != nil {
+			return fmt.Errorf("ошибка миграции %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	_, err := tx.Exec(`UPDATE meta SET schema_version = ? WHERE id = 1`, CurrentSchemaVersion)
+	return err
+}
+
+// migrate приводит схему базы dbPath с версии version к CurrentSchemaVersion и вызывает
+// upgradeData для перевода самих данных. Перед изменением схемы делается резервная копия
+// файла, а миграции, перевод данных и новый номер версии записываются одной транзакцией,
+// так что при ошибке база остаётся в исходном состоянии, а не новой версии со старыми данными.
+func migrate(dbConn *sql.DB, dbPath string, version int, upgradeData func(tx *sql.Tx) error) error {
+	if version < CurrentSchemaVersion {
+		if err := backupDatabase(dbConn, dbPath, version); err != nil {
+			return fmt.Errorf("не удалось создать резервную копию перед обновлением базы: %w", err)
+		}
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := applyMigrations(tx, version); err != nil {
+		return err
+	}
+	if err := upgradeData(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backupDatabase сохраняет согласованную копию базы рядом с ней:
+// <файл>.v<версия>-<время>.bak
+func backupDatabase(dbConn *sql.DB, dbPath string, version int) error {
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", dbPath, version, time.Now().Format("20060102-150405"))
+	_, err := dbConn.Exec(`VACUUM INTO ?`, backupPath)
+	return err
+}
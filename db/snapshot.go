@@ -0,0 +1,316 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// SnapshotWriter принимает снимок хранилища по частям, не собирая его в памяти: сначала
+// сводку с группами, затем записи по одной. Содержимое вложений записи пишется в Write сразу
+// после WriteEntry — по порядку, ровно Size байт каждого.
+type SnapshotWriter interface {
+	WriteInfo(info models.SnapshotInfo) error
+	WriteEntry(se models.SnapshotEntry) error
+	io.Writer
+}
+
+// SnapshotReader отдаёт снимок в том же порядке: Info — сводку, NextEntry — следующую
+// запись или io.EOF, Read — содержимое вложений последней записи подряд
+type SnapshotReader interface {
+	Info() models.SnapshotInfo
+	NextEntry() (models.SnapshotEntry, error)
+	io.Reader
+}
+
+// Snapshot передаёт в w всё хранилище для резервной копии: группы и записи вместе с корзиной,
+// вложениями и историей версий, а также настройки хранения истории и корзины. Записи читаются
+// по одной, вложения — по фрагментам, и всё это в одной транзакции, поэтому сводка сходится
+// с записями, даже если базу параллельно меняет агент. Возвращает переданную сводку.
+func Snapshot(dbConn *sql.DB, keys *crypto.VaultKeys, w SnapshotWriter) (models.SnapshotInfo, error) {
+	var info models.SnapshotInfo
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return info, err
+	}
+	defer tx.Rollback()
+
+	if info.History, err = readHistoryRetention(tx); err != nil {
+		return info, err
+	}
+	if info.TrashDays, err = readTrashDays(tx); err != nil {
+		return info, err
+	}
+	groups, err := loadAllGroups(tx, keys)
+	if err != nil {
+		return info, err
+	}
+	rows, err := tx.Query(`SELECT id, IFNULL(parent_id, 0), deleted_at FROM groups ORDER BY id`)
+	if err != nil {
+		return info, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g models.SnapshotGroup
+		var deletedAt sql.NullInt64
+		if err := rows.Scan(&g.ID, &g.ParentID, &deletedAt); err != nil {
+			return info, err
+		}
+		g.Name = groups[g.ID].Name
+		if deletedAt.Valid {
+			g.Deleted = time.Unix(deletedAt.Int64, 0)
+		}
+		info.Groups = append(info.Groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return info, err
+	}
+	rows.Close()
+
+	var ids []int
+	rows, err = tx.Query(`SELECT id FROM entries ORDER BY id`)
+	if err != nil {
+		return info, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return info, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return info, err
+	}
+	rows.Close()
+	info.Entries = len(ids)
+	if err := w.WriteInfo(info); err != nil {
+		return info, err
+	}
+
+	tags, err := loadEntryTags(tx, keys)
+	if err != nil {
+		return info, err
+	}
+	for _, id := range ids {
+		var groupID, deletedAt sql.NullInt64
+		var times entryTimes
+		ct := make([][]byte, len(entryFields))
+		err := tx.QueryRow(`SELECT title, username, password, url, notes, fields, otp, group_id, deleted_at, `+entryTimeColumns+`
+			FROM entries WHERE id = ?`, id).
+			Scan(append([]any{&ct[0], &ct[1], &ct[2], &ct[3], &ct[4], &ct[5], &ct[6], &groupID, &deletedAt}, times.dest()...)...)
+		if err != nil {
+			return info, err
+		}
+		e, err := decryptEntry(keys, id, ct, groups[int(groupID.Int64)].Path)
+		if err != nil {
+			return info, err
+		}
+		times.apply(&e)
+		e.Tags = tags[id]
+		se := models.SnapshotEntry{Entry: e}
+		if deletedAt.Valid {
+			se.Deleted = time.Unix(deletedAt.Int64, 0)
+		}
+		attachments, err := listAttachments(tx, keys, id)
+		if err != nil {
+			return info, err
+		}
+		for _, att := range attachments {
+			se.Attachments = append(se.Attachments, models.SnapshotAttachment{Name: att.Name, Created: att.Created, Size: att.Size})
+		}
+		if se.History, err = listRevisions(tx, keys, id); err != nil {
+			return info, err
+		}
+		slices.Reverse(se.History)
+
+		if err := w.WriteEntry(se); err != nil {
+			return info, err
+		}
+		for _, att := range attachments {
+			if err := writeAttachment(tx, keys, att.ID, w); err != nil {
+				return info, err
+			}
+		}
+	}
+	return info, nil
+}
+
+// RestoreSnapshot переносит снимок из src в базу одной транзакцией, читая его по одной записи,
+// и возвращает число добавленных записей.
+// Без merge база должна быть пустой: снимок восстанавливается целиком, с отметками времени,
+// корзиной и настройками хранения. При merge группы с тем же путём объединяются, записи,
+// которые уже есть в базе без отличий, пропускаются, а настройки базы не меняются.
+func RestoreSnapshot(dbConn *sql.DB, keys *crypto.VaultKeys, src SnapshotReader, merge bool) (int, error) {
+	info := src.Info()
+	// записи базы, включая корзину, по названию и логину — для поиска уже восстановленных
+	existing := map[string][]models.PasswordEntry{}
+	key := func(e models.PasswordEntry) string { return e.Title + "\x00" + e.Username }
+	if merge {
+		active, err := LoadAllEntries(dbConn, keys)
+		if err != nil {
+			return 0, err
+		}
+		_, trashed, err := ListTrash(dbConn, keys)
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range trashed {
+			active = append(active, t.Entry)
+		}
+		for _, e := range active {
+			existing[key(e)] = append(existing[key(e)], e)
+		}
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if !merge {
+		var count int
+		if err := tx.QueryRow(`SELECT (SELECT COUNT(*) FROM entries) + (SELECT COUNT(*) FROM groups)`).Scan(&count); err != nil {
+			return 0, err
+		}
+		if count > 0 {
+			return 0, fmt.Errorf("база не пуста: восстановить копию целиком можно только в новую базу")
+		}
+		if _, err := tx.Exec(`UPDATE meta SET history_max_revisions = ?, history_max_days = ?, trash_days = ? WHERE id = 1`,
+			info.History.MaxRevisions, info.History.MaxDays, info.TrashDays); err != nil {
+			return 0, err
+		}
+	}
+
+	// группы создаются от корня к листьям; в корзину они попадают после записей,
+	// иначе сохранение записи в группу достало бы её из корзины
+	byID := map[int]models.SnapshotGroup{}
+	for _, g := range info.Groups {
+		byID[g.ID] = g
+	}
+	created := map[int]int64{} // id группы снимка -> id в базе
+	paths := map[int]string{}  // id группы снимка -> путь
+	trashGroups := map[int64]time.Time{}
+	var restoreGroup func(g models.SnapshotGroup, depth int) (int64, error)
+	restoreGroup = func(g models.SnapshotGroup, depth int) (int64, error) {
+		if id, ok := created[g.ID]; ok {
+			return id, nil
+		}
+		var parentID sql.NullInt64
+		name := CleanGroupName(g.Name)
+		paths[g.ID] = name
+		if parent, ok := byID[g.ParentID]; ok && depth < len(info.Groups) {
+			id, err := restoreGroup(parent, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			parentID = sql.NullInt64{Int64: id, Valid: true}
+			paths[g.ID] = JoinGroupPath(paths[parent.ID], name)
+		}
+		id, _, err := findChildGroup(tx, keys, parentID, name)
+		switch {
+		case err == sql.ErrNoRows:
+			if id, err = createGroup(tx, keys, parentID, name); err != nil {
+				return 0, err
+			}
+			if !g.Deleted.IsZero() {
+				trashGroups[id] = g.Deleted
+			}
+		case err != nil:
+			return 0, err
+		}
+		created[g.ID] = id
+		return id, nil
+	}
+	for _, g := range info.Groups {
+		if _, err := restoreGroup(g, 0); err != nil {
+			return 0, err
+		}
+	}
+	// копии, снятые до вложенных путей, хранят в записи только имя группы, которое тогда
+	// было уникально во всей базе, — оно разрешается в путь группы снимка
+	groupPaths := map[string]string{}
+	for _, p := range paths {
+		groupPaths[p] = p
+	}
+	for _, g := range info.Groups {
+		if _, ok := groupPaths[g.Name]; !ok {
+			groupPaths[g.Name] = paths[g.ID]
+		}
+	}
+
+	added := 0
+	for {
+		se, err := src.NextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if slices.ContainsFunc(existing[key(se.Entry)], func(e models.PasswordEntry) bool { return len(DiffEntries(e, se.Entry)) == 0 }) {
+			continue
+		}
+		e := se.Entry
+		if p, ok := groupPaths[e.Group]; ok {
+			e.Group = p
+		}
+		id, err := saveEntry(tx, keys, e)
+		if err != nil {
+			return 0, fmt.Errorf("запись '%s': %w", e.Title, err)
+		}
+		if _, err := tx.Exec(`UPDATE entries SET created_at = ?, modified_at = ?, password_changed_at = ?, last_used_at = ?, deleted_at = ? WHERE id = ?`,
+			unix(e.Created), unix(e.Modified), unix(e.PasswordChanged), unix(e.LastUsed), unix(se.Deleted), id); err != nil {
+			return 0, err
+		}
+		for _, att := range se.Attachments {
+			a, err := addAttachment(tx, keys, id, att.Name, io.LimitReader(src, att.Size))
+			if err == nil && a.Size != att.Size {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return 0, fmt.Errorf("запись '%s', вложение '%s': %w", e.Title, att.Name, err)
+			}
+			if att.Created.IsZero() {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE attachments SET created_at = ? WHERE id = ?`, att.Created.Unix(), a.ID); err != nil {
+				return 0, err
+			}
+		}
+		if len(se.History) > 0 {
+			history := slices.Clone(se.History)
+			for i := range history {
+				if p, ok := groupPaths[history[i].Entry.Group]; ok {
+					history[i].Entry.Group = p
+				}
+			}
+			if err := addRevisions(tx, keys, id, history); err != nil {
+				return 0, fmt.Errorf("запись '%s': %w", e.Title, err)
+			}
+		}
+		added++
+	}
+
+	for id, deleted := range trashGroups {
+		if _, err := tx.Exec(`UPDATE groups SET deleted_at = ? WHERE id = ?`, deleted.Unix(), id); err != nil {
+			return 0, err
+		}
+	}
+	return added, tx.Commit()
+}
+
+// unix — отметка времени в виде, в котором она хранится; нулевое время — NULL
+func unix(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
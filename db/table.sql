@@ -2,7 +2,20 @@
 		id INTEGER PRIMARY KEY CHECK (id = 1),
 		salt BLOB NOT NULL,
 		iterations INTEGER NOT NULL,
-		verifier BLOB NOT NULL
+		verifier BLOB NOT NULL,
+		cipher_version INTEGER NOT NULL DEFAULT 0,
+		wrapped_key BLOB,
+		kdf TEXT NOT NULL DEFAULT 'pbkdf2-streebog',
+		argon_memory INTEGER NOT NULL DEFAULT 0,
+		argon_time INTEGER NOT NULL DEFAULT 0,
+		argon_threads INTEGER NOT NULL DEFAULT 0,
+		kdf_upgrade TEXT,
+		keyfile_required INTEGER NOT NULL DEFAULT 0,
+		schema_version INTEGER NOT NULL DEFAULT 0,
+		history_max_revisions INTEGER NOT NULL DEFAULT 10,
+		history_max_days INTEGER NOT NULL DEFAULT 0,
+		trash_days INTEGER NOT NULL DEFAULT 30,
+		group_paths INTEGER NOT NULL DEFAULT 1
 	);
 
 	CREATE TABLE IF NOT EXISTS entries (
@@ -12,10 +25,72 @@
 		password BLOB NOT NULL,
 		url BLOB,
 		notes BLOB,
-		group_id INTEGER
+		group_id INTEGER,
+		deleted_at INTEGER,
+		created_at INTEGER,
+		modified_at INTEGER,
+		password_changed_at INTEGER,
+		last_used_at INTEGER,
+		fields BLOB,
+		otp BLOB
 	);
 
     CREATE TABLE IF NOT EXISTS groups (
         id integer PRIMARY KEY AUTOINCREMENT,
-        name TEXT NOT NULL UNIQUE
-    );
\ No newline at end of file
+        name BLOB NOT NULL,
+        name_index BLOB,
+        deleted_at INTEGER,
+        parent_id INTEGER
+    );
+
+    CREATE UNIQUE INDEX IF NOT EXISTS groups_name_index ON groups (IFNULL(parent_id, 0), name_index);
+
+	CREATE TABLE IF NOT EXISTS entry_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entry_id INTEGER NOT NULL,
+		changed_at INTEGER NOT NULL,
+		title BLOB NOT NULL,
+		username BLOB NOT NULL,
+		password BLOB NOT NULL,
+		url BLOB,
+		notes BLOB,
+		group_name BLOB,
+		fields BLOB,
+		tags BLOB,
+		otp BLOB
+	);
+
+	CREATE INDEX IF NOT EXISTS entry_history_entry ON entry_history (entry_id, changed_at);
+
+	CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entry_id INTEGER NOT NULL,
+		name BLOB NOT NULL,
+		size INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS attachments_entry ON attachments (entry_id);
+
+	CREATE TABLE IF NOT EXISTS attachment_chunks (
+		attachment_id INTEGER NOT NULL,
+		seq INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (attachment_id, seq)
+	);
+
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name BLOB NOT NULL,
+		name_index BLOB NOT NULL
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS tags_name_index ON tags (name_index);
+
+	CREATE TABLE IF NOT EXISTS entry_tags (
+		entry_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (entry_id, tag_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS entry_tags_tag ON entry_tags (tag_id);
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+)
+
+// ParseTags разбирает список тегов через запятую: пробелы по краям и пустые
+// значения отбрасываются, повторы удаляются с сохранением порядка
+func ParseTags(s string) []string {
+	return normalizeTags(strings.Split(s, ","))
+}
+
+// normalizeTags обрезает пробелы, убирает пустые теги и повторы
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// tagIndex — слепой индекс имени тега, как и у групп
+func tagIndex(keys *crypto.VaultKeys, name string) []byte {
+	return crypto.HMACStreebog256(keys.Search, []byte("tags:name:"+name))
+}
+
+// tagAD — присоединённые данные имени тега
+func tagAD(id int) []byte {
+	return []byte(fmt.Sprintf("tags:%d:name", id))
+}
+
+// getOrCreateTag ищет тег по слепому индексу и создаёт его, если такого ещё нет
+func getOrCreateTag(q querier, keys *crypto.VaultKeys, name string) (int64, error) {
+	var id int64
+	err := q.QueryRow(`SELECT id FROM tags WHERE name_index = ?`, tagIndex(keys, name)).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+	result, err := q.Exec(`INSERT INTO tags (name, name_index) VALUES (X'', ?)`, tagIndex(keys, name))
+	if err != nil {
+		return 0, err
+	}
+	if id, err = result.LastInsertId(); err != nil {
+		return 0, err
+	}
+	pt := []byte(name)
+	defer crypto.Wipe(pt)
+	ct, err := crypto.EncryptData(keys.Enc, pt, tagAD(int(id)))
+	if err != nil {
+		return 0, err
+	}
+	_, err = q.Exec(`UPDATE tags SET name = ? WHERE id = ?`, ct, id)
+	return id, err
+}
+
+// setEntryTags заменяет теги записи; теги, которые больше ни к чему не привязаны, удаляются
+func setEntryTags(tx *sql.Tx, keys *crypto.VaultKeys, entryID int, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM entry_tags WHERE entry_id = ?`, entryID); err != nil {
+		return err
+	}
+	for _, name := range normalizeTags(tags) {
+		if strings.Contains(name, ",") {
+			return fmt.Errorf("тег %q не может содержать запятую", name)
+		}
+		tagID, err := getOrCreateTag(tx, keys, name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO entry_tags (entry_id, tag_id) VALUES (?, ?)`, entryID, tagID); err != nil {
+			return err
+		}
+	}
+	return deleteUnusedTags(tx)
+}
+
+// deleteUnusedTags удаляет теги без записей
+func deleteUnusedTags(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM entry_tags)`)
+	return err
+}
+
+// loadEntryTags расшифровывает теги всех записей: id записи -> теги по алфавиту.
+// Для одной записи есть loadTagsOfEntry, который не трогает теги остальных.
+func loadEntryTags(q querier, keys *crypto.VaultKeys) (map[int][]string, error) {
+	return queryEntryTags(q, keys, `SELECT et.entry_id, t.id, t.name FROM entry_tags et JOIN tags t ON t.id = et.tag_id`)
+}
+
+// loadTagsOfEntry расшифровывает теги одной записи, по алфавиту
+func loadTagsOfEntry(q querier, keys *crypto.VaultKeys, id int) ([]string, error) {
+	tags, err := queryEntryTags(q, keys, `SELECT et.entry_id, t.id, t.name FROM entry_tags et JOIN tags t ON t.id = et.tag_id
+		WHERE et.entry_id = ?`, id)
+	return tags[id], err
+}
+
+// queryEntryTags выполняет запрос, возвращающий (id записи, id тега, имя тега),
+// и расшифровывает каждый тег один раз
+func queryEntryTags(q querier, keys *crypto.VaultKeys, query string, args ...any) (map[int][]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := map[int]string{}
+	out := map[int][]string{}
+	for rows.Next() {
+		var entryID, tagID int
+		var ct []byte
+		if err := rows.Scan(&entryID, &tagID, &ct); err != nil {
+			return nil, err
+		}
+		name, ok := names[tagID]
+		if !ok {
+			pt, err := crypto.DecryptData(keys.Enc, ct, tagAD(tagID))
+			if err != nil {
+				return nil, fmt.Errorf("тег %d: %w", tagID, err)
+			}
+			name = string(pt)
+			crypto.Wipe(pt)
+			names[tagID] = name
+		}
+		out[entryID] = append(out[entryID], name)
+	}
+	for _, tags := range out {
+		sort.Strings(tags)
+	}
+	return out, rows.Err()
+}
+
+// GetTags возвращает теги записей, не находящихся в корзине, по алфавиту
+func GetTags(dbConn *sql.DB, keys *crypto.VaultKeys) ([]string, error) {
+	rows, err := dbConn.Query(`SELECT DISTINCT t.id, t.name FROM tags t
+		JOIN entry_tags et ON et.tag_id = t.id
+		JOIN entries e ON e.id = et.entry_id
+		WHERE e.deleted_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id int
+		var ct []byte
+		if err := rows.Scan(&id, &ct); err != nil {
+			return nil, err
+		}
+		pt, err := crypto.DecryptData(keys.Enc, ct, tagAD(id))
+		if err != nil {
+			return nil, fmt.Errorf("тег %d: %w", id, err)
+		}
+		out = append(out, string(pt))
+		crypto.Wipe(pt)
+	}
+	sort.Strings(out)
+	return out, rows.Err()
+}
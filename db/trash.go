@@ -0,0 +1,312 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+	"github.com/reinbowARA/PassLedger/models"
+)
+
+// ListTrash возвращает группы и записи из корзины, от недавно удалённых к старым
+func ListTrash(dbConn *sql.DB, keys *crypto.VaultKeys) ([]models.TrashedGroup, []models.TrashedEntry, error) {
+	allGroups, err := loadAllGroups(dbConn, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	tags, err := loadEntryTags(dbConn, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := dbConn.Query(`SELECT g.id, g.deleted_at,
+		(SELECT COUNT(*) FROM entries e WHERE e.group_id = g.id AND e.deleted_at = g.deleted_at)
+		FROM groups g WHERE g.deleted_at IS NOT NULL ORDER BY g.deleted_at DESC, g.id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var groups []models.TrashedGroup
+	for rows.Next() {
+		var g models.TrashedGroup
+		var deletedAt int64
+		if err := rows.Scan(&g.Group.Id, &deletedAt, &g.Entries); err != nil {
+			return nil, nil, err
+		}
+		g.Group = allGroups[g.Group.Id]
+		g.DeletedAt = time.Unix(deletedAt, 0)
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = dbConn.Query(`SELECT id, title, username, password, url, notes, fields, otp, group_id, deleted_at, ` + entryTimeColumns + `
+		FROM entries WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var entries []models.TrashedEntry
+	for rows.Next() {
+		var id int
+		var groupID sql.NullInt64
+		var deletedAt int64
+		var times entryTimes
+		ct := make([][]byte, len(entryFields))
+		if err := rows.Scan(append([]any{&id, &ct[0], &ct[1], &ct[2], &ct[3], &ct[4], &ct[5], &ct[6], &groupID, &deletedAt}, times.dest()...)...); err != nil {
+			return nil, nil, err
+		}
+		e, err := decryptEntry(keys, id, ct, allGroups[int(groupID.Int64)].Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		times.apply(&e)
+		e.Tags = tags[id]
+		entries = append(entries, models.TrashedEntry{Entry: e, DeletedAt: time.Unix(deletedAt, 0)})
+	}
+	return groups, entries, rows.Err()
+}
+
+// RestoreEntry достаёт запись из корзины. Если в корзине лежит и её группа,
+// группа и её родители тоже восстанавливаются (без остальных своих записей).
+func RestoreEntry(dbConn *sql.DB, id int) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`UPDATE entries SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("запись с id %d не найдена в корзине", id)
+	}
+	var groupID sql.NullInt64
+	if err := tx.QueryRow(`SELECT group_id FROM entries WHERE id = ?`, id).Scan(&groupID); err != nil {
+		return err
+	}
+	if groupID.Valid {
+		if err := restoreGroupPath(tx, groupID.Int64); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RestoreGroup достаёт группу из корзины вместе с подгруппами и записями, удалёнными вместе с ней.
+// Родители группы, если они в корзине, восстанавливаются без своих записей.
+func RestoreGroup(dbConn *sql.DB, id int) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var deletedAt sql.NullInt64
+	err = tx.QueryRow(`SELECT deleted_at FROM groups WHERE id = ?`, id).Scan(&deletedAt)
+	if err == sql.ErrNoRows || (err == nil && !deletedAt.Valid) {
+		return fmt.Errorf("группа с id %d не найдена в корзине", id)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE entries SET deleted_at = NULL WHERE deleted_at = ? AND group_id IN (`+groupSubtree+`)`, deletedAt, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE groups SET deleted_at = NULL WHERE deleted_at = ? AND id IN (`+groupSubtree+`)`, deletedAt, id); err != nil {
+		return err
+	}
+	if err := restoreGroupPath(tx, int64(id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeEntry окончательно удаляет запись из корзины вместе с её историей, вложениями и тегами
+func PurgeEntry(dbConn *sql.DB, id int) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	n, err := purgeEntries(tx, `SELECT id FROM entries WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("запись с id %d не найдена в корзине", id)
+	}
+	return tx.Commit()
+}
+
+// PurgeGroup окончательно удаляет группу из корзины вместе с подгруппами и их записями.
+// Подгруппы и записи вне корзины не трогаются: они переносятся на место удалённой группы.
+func PurgeGroup(dbConn *sql.DB, id int) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var trashed bool
+	err = tx.QueryRow(`SELECT deleted_at IS NOT NULL FROM groups WHERE id = ?`, id).Scan(&trashed)
+	if err == sql.ErrNoRows || (err == nil && !trashed) {
+		return fmt.Errorf("группа с id %d не найдена в корзине", id)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = purgeEntries(tx, `SELECT id FROM entries WHERE deleted_at IS NOT NULL AND group_id IN (`+groupSubtree+`)`, id)
+	if err != nil {
+		return err
+	}
+	if err := deleteTrashedGroups(tx, `SELECT id FROM groups WHERE deleted_at IS NOT NULL AND id IN (`+groupSubtree+`)`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EmptyTrash окончательно удаляет всё содержимое корзины
+func EmptyTrash(dbConn *sql.DB) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := purgeTrashBefore(tx, math.MaxInt64); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTrashDays возвращает, через сколько дней корзина очищается автоматически; 0 — никогда
+func GetTrashDays(dbConn *sql.DB) (int, error) {
+	return readTrashDays(dbConn)
+}
+
+func readTrashDays(q querier) (days int, err error) {
+	err = q.QueryRow(`SELECT trash_days FROM meta WHERE id = 1`).Scan(&days)
+	return
+}
+
+// SetTrashDays сохраняет срок хранения корзины и сразу удаляет то, что уже устарело
+func SetTrashDays(dbConn *sql.DB, days int) error {
+	if days < 0 {
+		return fmt.Errorf("срок хранения корзины не может быть отрицательным")
+	}
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE meta SET trash_days = ? WHERE id = 1`, days); err != nil {
+		return err
+	}
+	if err := purgeExpiredTrash(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// purgeExpiredTrash удаляет из корзины всё, что лежит там дольше meta.trash_days
+func purgeExpiredTrash(tx *sql.Tx) error {
+	days, err := readTrashDays(tx)
+	if err != nil || days == 0 {
+		return err
+	}
+	return purgeTrashBefore(tx, time.Now().AddDate(0, 0, -days).Unix())
+}
+
+// purgeTrashBefore удаляет записи и группы, попавшие в корзину раньше cutoff.
+// Группа остаётся, пока на неё ссылается хотя бы одна запись.
+func purgeTrashBefore(tx *sql.Tx, cutoff int64) error {
+	if _, err := purgeEntries(tx, `SELECT id FROM entries WHERE deleted_at < ?`, cutoff); err != nil {
+		return err
+	}
+	return deleteTrashedGroups(tx, `SELECT id FROM groups WHERE deleted_at < ?
+		AND id NOT IN (SELECT group_id FROM entries WHERE group_id IS NOT NULL)`, cutoff)
+}
+
+// deleteTrashedGroups удаляет группы, выбранные подзапросом groupIDs. Оставшиеся записи
+// и подгруппы удалённой группы переносятся к её родителю, чтобы не потерять их в дереве.
+// Группа, подгруппа которой совпала бы по имени с подгруппой родителя, остаётся в корзине:
+// имена групп уникальны внутри родителя.
+func deleteTrashedGroups(tx *sql.Tx, groupIDs string, args ...any) error {
+	ids, err := queryIDs(tx, groupIDs, args...)
+	if err != nil {
+		return err
+	}
+	// потомки обычно создаются позже предков: с конца сначала удаляются вложенные группы
+	for _, id := range slices.Backward(ids) {
+		var parentID sql.NullInt64
+		if err := tx.QueryRow(`SELECT parent_id FROM groups WHERE id = ?`, id).Scan(&parentID); err != nil {
+			return err
+		}
+		var conflict bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM groups c JOIN groups s
+			ON IFNULL(s.parent_id, 0) = ? AND s.id != ? AND s.name_index = c.name_index WHERE c.parent_id = ?)`,
+			parentID.Int64, id, id).Scan(&conflict); err != nil {
+			return err
+		}
+		if conflict {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE groups SET parent_id = ? WHERE parent_id = ?`, parentID, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE entries SET group_id = ? WHERE group_id = ?`, parentID, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM groups WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryIDs выполняет запрос, возвращающий один столбец id
+func queryIDs(tx *sql.Tx, query string, args ...any) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// purgeEntries окончательно удаляет записи, выбранные подзапросом entryIDs, вместе с их историей,
+// вложениями и привязками к тегам; теги, оставшиеся без записей, тоже удаляются.
+// Возвращает число удалённых записей.
+func purgeEntries(tx *sql.Tx, entryIDs string, args ...any) (int64, error) {
+	if _, err := tx.Exec(`DELETE FROM entry_history WHERE entry_id IN (`+entryIDs+`)`, args...); err != nil {
+		return 0, err
+	}
+	if err := deleteEntryAttachments(tx, entryIDs, args...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM entry_tags WHERE entry_id IN (`+entryIDs+`)`, args...); err != nil {
+		return 0, err
+	}
+	if err := deleteUnusedTags(tx); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`DELETE FROM entries WHERE id IN (`+entryIDs+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+)
+
+// CurrentCipherVersion — версия формата шифротекстов, с которой работает приложение:
+// 0 — Кузнечик-CBC без имитовставки (IV||CT), 1 — Кузнечик-MGM,
+// 2 — Кузнечик-MGM с привязкой к id записи и имени поля
+const CurrentCipherVersion = 2
+
+// entryFields — зашифрованные колонки таблицы entries; fields — дополнительные поля в JSON,
+// otp — секрет TOTP (base32 или otpauth:// URI)
+var entryFields = []string{"title", "username", "password", "url", "notes", "fields", "otp"}
+
+// encryptGroupNames шифрует имена групп, которые в базах старых версий хранились
+// открытым текстом (у таких строк нет слепого индекса)
+func encryptGroupNames(tx *sql.Tx, keys *crypto.VaultKeys) error {
+	rows, err := tx.Query(`SELECT id, name FROM groups WHERE name_index IS NULL`)
+	if err != nil {
+		return err
+	}
+	type group struct {
+		id   int
+		name string
+	}
+	var groups []group
+	for rows.Next() {
+		var g group
+		if err := rows.Scan(&g.id, &g.name); err != nil {
+			rows.Close()
+			return err
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	for _, g := range groups {
+		ct, err := encryptGroupName(keys, g.id, g.name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE groups SET name = ?, name_index = ? WHERE id = ?`, ct, groupIndex(keys, g.name), g.id); err != nil {
+			return fmt.Errorf("ошибка шифрования имён групп: %w", err)
+		}
+	}
+	return nil
+}
+
+// upgradeGroupPaths переводит базу, где имена групп были уникальны во всей базе, на пути групп:
+// косая черта в именах заменяется на «∕», а имя группы в версиях записей — на полный путь
+// группы. Выполняется один раз, пока meta.group_paths = 0.
+func upgradeGroupPaths(tx *sql.Tx, keys *crypto.VaultKeys) error {
+	var done bool
+	if err := tx.QueryRow(`SELECT group_paths FROM meta WHERE id = 1`).Scan(&done); err != nil || done {
+		return err
+	}
+	groups, err := loadAllGroups(tx, keys)
+	if err != nil {
+		return err
+	}
+	names := map[int]string{} // id группы -> прежнее имя
+	for id, g := range groups {
+		names[id] = g.Name
+		clean := CleanGroupName(g.Name)
+		if clean == g.Name {
+			continue
+		}
+		parent := sql.NullInt64{Int64: int64(g.ParentId), Valid: g.ParentId != 0}
+		for n := 2; ; n++ {
+			if _, _, err := findChildGroup(tx, keys, parent, clean); err == sql.ErrNoRows {
+				break
+			} else if err != nil {
+				return err
+			}
+			clean = fmt.Sprintf("%s (%d)", CleanGroupName(g.Name), n)
+		}
+		ct, err := encryptGroupName(keys, id, clean)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE groups SET name = ?, name_index = ? WHERE id = ?`, ct, groupIndex(keys, clean), id); err != nil {
+			return fmt.Errorf("ошибка переименования группы: %w", err)
+		}
+	}
+	if groups, err = loadAllGroups(tx, keys); err != nil {
+		return err
+	}
+	paths := map[string]string{} // прежнее имя -> путь
+	for id, name := range names {
+		paths[name] = groups[id].Path
+	}
+
+	type revision struct {
+		id, entryID int
+		ct          []byte
+	}
+	rows, err := tx.Query(`SELECT id, entry_id, group_name FROM entry_history WHERE length(group_name) > 0`)
+	if err != nil {
+		return err
+	}
+	var revisions []revision
+	for rows.Next() {
+		var r revision
+		if err := rows.Scan(&r.id, &r.entryID, &r.ct); err != nil {
+			rows.Close()
+			return err
+		}
+		revisions = append(revisions, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, r := range revisions {
+		ad := historyAD(r.id, r.entryID, "group_name")
+		pt, err := crypto.DecryptData(keys.Enc, r.ct, ad)
+		if err != nil {
+			return fmt.Errorf("версия %d записи %d: %w", r.id, r.entryID, err)
+		}
+		path, ok := paths[string(pt)]
+		crypto.Wipe(pt)
+		if !ok {
+			continue
+		}
+		ct, err := crypto.EncryptData(keys.Enc, []byte(path), ad)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE entry_history SET group_name = ? WHERE id = ?`, ct, r.id); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE meta SET group_paths = 1 WHERE id = 1`)
+	return err
+}
+
+// reencryptEntries перешифровывает все непустые поля таблицы entries внутри транзакции tx.
+// convert получает старый шифротекст и возвращает новый.
+func reencryptEntries(tx *sql.Tx, convert func(id int, field string, ct []byte) ([]byte, error)) error {
+	type row struct {
+		id     int
+		fields [][]byte
+	}
+	rows, err := tx.Query(`SELECT id, title, username, password, url, notes, fields, otp FROM entries`)
+	if err != nil {
+		return err
+	}
+	var all []row
+	for rows.Next() {
+		r := row{fields: make([][]byte, len(entryFields))}
+		if err := rows.Scan(&r.id, &r.fields[0], &r.fields[1], &r.fields[2], &r.fields[3], &r.fields[4], &r.fields[5], &r.fields[6]); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range all {
+		for i, ct := range r.fields {
+			if len(ct) == 0 {
+				continue
+			}
+			newCT, err := convert(r.id, entryFields[i], ct)
+			if err != nil {
+				return fmt.Errorf("запись %d, поле %s: %w", r.id, entryFields[i], err)
+			}
+			r.fields[i] = newCT
+		}
+		_, err := tx.Exec(`UPDATE entries SET title=?, username=?, password=?, url=?, notes=?, fields=?, otp=? WHERE id=?`,
+			r.fields[0], r.fields[1], r.fields[2], r.fields[3], r.fields[4], r.fields[5], r.fields[6], r.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeCipher переводит шифротексты старой базы в актуальный формат
+func upgradeCipher(tx *sql.Tx, key []byte) error {
+	var version int
+	if err := tx.QueryRow(`SELECT cipher_version FROM meta WHERE id = 1`).Scan(&version); err != nil {
+		return err
+	}
+	if version > CurrentCipherVersion {
+		return fmt.Errorf("%w (формат шифрования %d), обновите приложение", ErrNewerVersion, version)
+	}
+	if version == CurrentCipherVersion {
+		return nil
+	}
+
+	err := reencryptEntries(tx, func(id int, field string, ct []byte) ([]byte, error) {
+		var pt []byte
+		var err error
+		switch version {
+		case 0:
+			pt, err = crypto.DecryptLegacyCBC(key, ct)
+		case 1:
+			pt, err = crypto.DecryptData(key, ct, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer crypto.Wipe(pt)
+		return crypto.EncryptData(key, pt, fieldAD(id, field))
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка обновления формата шифрования: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE meta SET cipher_version = ? WHERE id = 1`, CurrentCipherVersion)
+	return err
+}
+
+// upgradeKeyHierarchy переводит базу, где записи зашифрованы ключом из пароля,
+// на случайный ключ хранилища: записи перешифровываются подключом Enc,
+// а сам ключ сохраняется в meta зашифрованным ключом из пароля (kek)
+func upgradeKeyHierarchy(tx *sql.Tx, kek []byte) (*crypto.VaultKeys, error) {
+	vaultKey, err := crypto.GenerateVaultKey()
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(vaultKey)
+	keys, err := crypto.DeriveVaultKeys(vaultKey)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := crypto.WrapKey(kek, vaultKey)
+	if err != nil {
+		keys.Wipe()
+		return nil, err
+	}
+
+	err = reencryptEntries(tx, func(id int, field string, ct []byte) ([]byte, error) {
+		pt, err := crypto.DecryptData(kek, ct, fieldAD(id, field))
+		if err != nil {
+			return nil, err
+		}
+		defer crypto.Wipe(pt)
+		return crypto.EncryptData(keys.Enc, pt, fieldAD(id, field))
+	})
+	if err != nil {
+		keys.Wipe()
+		return nil, fmt.Errorf("ошибка перехода на ключ хранилища: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE meta SET wrapped_key = ?, verifier = ? WHERE id = 1`, wrapped, vaultVerifier(keys))
+	if err != nil {
+		keys.Wipe()
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,204 @@
+package kdbx
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Argon2d (RFC 9106) — вариант по умолчанию в KeePass и KeePassXC. В x/crypto есть только
+// Argon2i и Argon2id, поэтому здесь своя реализация: однопоточная, без адресных блоков.
+
+const (
+	argon2Version    = 0x13
+	argon2SyncPoints = 4
+)
+
+type argon2Block [128]uint64
+
+// argon2d вычисляет тег длиной keyLen; memory — в КиБ, как в RFC
+func argon2d(password, salt, secret, data []byte, passes, memory, lanes, keyLen uint32) []byte {
+	h0 := argon2InitHash(password, salt, secret, data, passes, memory, lanes, keyLen)
+
+	memory = memory / (argon2SyncPoints * lanes) * (argon2SyncPoints * lanes)
+	if memory < 2*argon2SyncPoints*lanes {
+		memory = 2 * argon2SyncPoints * lanes
+	}
+	laneLen := memory / lanes
+	segLen := laneLen / argon2SyncPoints
+	B := make([]argon2Block, memory)
+
+	var buf [1024]byte
+	for lane := uint32(0); lane < lanes; lane++ {
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], i)
+			blake2bLong(buf[:], h0[:])
+			for j := range B[lane*laneLen+i] {
+				B[lane*laneLen+i][j] = binary.LittleEndian.Uint64(buf[j*8:])
+			}
+		}
+	}
+
+	// в Argon2d блоки одного среза разных дорожек друг на друга не ссылаются,
+	// поэтому дорожки можно заполнять по очереди
+	for pass := uint32(0); pass < passes; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			for lane := uint32(0); lane < lanes; lane++ {
+				index := uint32(0)
+				if pass == 0 && slice == 0 {
+					index = 2 // первые два блока уже посчитаны
+				}
+				offset := lane*laneLen + slice*segLen + index
+				for ; index < segLen; index, offset = index+1, offset+1 {
+					prev := offset - 1
+					if index == 0 && slice == 0 {
+						prev += laneLen // последний блок дорожки
+					}
+					ref := argon2RefIndex(B[prev][0], laneLen, segLen, lanes, pass, slice, lane, index)
+					argon2Compress(&B[offset], &B[prev], &B[ref])
+				}
+			}
+		}
+	}
+
+	for lane := uint32(0); lane < lanes-1; lane++ {
+		for i, v := range B[lane*laneLen+laneLen-1] {
+			B[memory-1][i] ^= v
+		}
+	}
+	for i, v := range B[memory-1] {
+		binary.LittleEndian.PutUint64(buf[i*8:], v)
+	}
+	key := make([]byte, keyLen)
+	blake2bLong(key, buf[:])
+	return key
+}
+
+// argon2InitHash — H0 с местом под номер блока и дорожки в последних восьми байтах
+func argon2InitHash(password, salt, secret, data []byte, passes, memory, lanes, keyLen uint32) [blake2b.Size + 8]byte {
+	var h0 [blake2b.Size + 8]byte
+	b2, _ := blake2b.New512(nil)
+	writeUint32 := func(v uint32) {
+		var tmp [4]byte
+		binary.LittleEndian.PutUint32(tmp[:], v)
+		b2.Write(tmp[:])
+	}
+	for _, v := range []uint32{lanes, keyLen, memory, passes, argon2Version, 0} { // 0 — Argon2d
+		writeUint32(v)
+	}
+	for _, b := range [][]byte{password, salt, secret, data} {
+		writeUint32(uint32(len(b)))
+		b2.Write(b)
+	}
+	b2.Sum(h0[:0])
+	return h0
+}
+
+// argon2RefIndex выбирает блок, с которым смешивается текущий (RFC 9106, раздел 3.4.1.2)
+func argon2RefIndex(rand uint64, laneLen, segLen, lanes, pass, slice, lane, index uint32) uint32 {
+	refLane := uint32(rand>>32) % lanes
+	if pass == 0 && slice == 0 {
+		refLane = lane
+	}
+	area, start := 3*segLen, ((slice+1)%argon2SyncPoints)*segLen
+	if lane == refLane {
+		area += index
+	}
+	if pass == 0 {
+		area, start = slice*segLen, 0
+		if slice == 0 || lane == refLane {
+			area += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		area--
+	}
+	x := rand & 0xFFFFFFFF
+	x = (x * x) >> 32
+	x = (x * uint64(area)) >> 32
+	return refLane*laneLen + uint32((uint64(start)+uint64(area)-(x+1))%uint64(laneLen))
+}
+
+// argon2Compress — out ^= G(x, y); на первом проходе out ещё нулевой
+func argon2Compress(out, x, y *argon2Block) {
+	var r, t argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	t = r
+	for i := 0; i < 128; i += 16 {
+		blamkaRound(&t, [16]int{i, i + 1, i + 2, i + 3, i + 4, i + 5, i + 6, i + 7,
+			i + 8, i + 9, i + 10, i + 11, i + 12, i + 13, i + 14, i + 15})
+	}
+	for i := 0; i < 16; i += 2 {
+		blamkaRound(&t, [16]int{i, i + 1, i + 16, i + 17, i + 32, i + 33, i + 48, i + 49,
+			i + 64, i + 65, i + 80, i + 81, i + 96, i + 97, i + 112, i + 113})
+	}
+	for i := range t {
+		out[i] ^= t[i] ^ r[i]
+	}
+}
+
+// blamkaRound — перестановка P над шестнадцатью словами блока
+func blamkaRound(v *argon2Block, i [16]int) {
+	blamkaG(v, i[0], i[4], i[8], i[12])
+	blamkaG(v, i[1], i[5], i[9], i[13])
+	blamkaG(v, i[2], i[6], i[10], i[14])
+	blamkaG(v, i[3], i[7], i[11], i[15])
+	blamkaG(v, i[0], i[5], i[10], i[15])
+	blamkaG(v, i[1], i[6], i[11], i[12])
+	blamkaG(v, i[2], i[7], i[8], i[13])
+	blamkaG(v, i[3], i[4], i[9], i[14])
+}
+
+func blamkaG(v *argon2Block, a, b, c, d int) {
+	mul := func(x, y uint64) uint64 { return x + y + 2*uint64(uint32(x))*uint64(uint32(y)) }
+	v[a] = mul(v[a], v[b])
+	v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+	v[c] = mul(v[c], v[d])
+	v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+	v[a] = mul(v[a], v[b])
+	v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+	v[c] = mul(v[c], v[d])
+	v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+}
+
+// blake2bLong — хеш переменной длины H' из RFC 9106
+func blake2bLong(out, in []byte) {
+	var b2 hash.Hash
+	if len(out) < blake2b.Size {
+		b2, _ = blake2b.New(len(out), nil)
+	} else {
+		b2, _ = blake2b.New512(nil)
+	}
+	var buf [blake2b.Size]byte
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(out)))
+	b2.Write(buf[:4])
+	b2.Write(in)
+	if len(out) <= blake2b.Size {
+		b2.Sum(out[:0])
+		return
+	}
+
+	outLen := len(out)
+	b2.Sum(buf[:0])
+	b2.Reset()
+	copy(out, buf[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		b2.Write(buf[:])
+		b2.Sum(buf[:0])
+		copy(out, buf[:32])
+		out = out[32:]
+		b2.Reset()
+	}
+	if outLen%blake2b.Size > 0 {
+		r := (outLen+31)/32 - 2
+		b2, _ = blake2b.New(outLen-32*r, nil)
+	}
+	b2.Write(buf[:])
+	b2.Sum(out[:0])
+}
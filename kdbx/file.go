@@ -0,0 +1,238 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/reinbowARA/PassLedger/crypto"
+)
+
+// Decode читает базу KDBX 4, открывая её паролем и/или содержимым ключевого файла.
+// Корзина KeePass не переносится — удалённые там записи остаются удалёнными.
+func Decode(r io.Reader, password string, keyfile []byte) (*Database, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	var sums [64]byte
+	if _, err := io.ReadFull(r, sums[:]); err != nil {
+		return nil, ErrCorrupted
+	}
+	if sum := sha256.Sum256(h.raw); !hmac.Equal(sums[:32], sum[:]) {
+		return nil, ErrCorrupted
+	}
+
+	composite, err := compositeKey(password, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(composite)
+	transformed, err := transformKey(h.kdf, composite)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(transformed)
+	encKey, hmacKey := fileKeys(h.masterSeed, transformed)
+	defer crypto.Wipe(encKey)
+	defer crypto.Wipe(hmacKey)
+	if !hmac.Equal(sums[32:], headerHMAC(hmacKey, h.raw)) {
+		return nil, ErrCredentials
+	}
+
+	data, err := readBlocks(r, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decryptPayload(h.cipherID, encKey, h.iv, data); err != nil {
+		return nil, err
+	}
+	if h.compressed {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, ErrCorrupted
+		}
+	}
+	return decodeInner(data)
+}
+
+// decodeInner разбирает внутренний заголовок и XML
+func decodeInner(data []byte) (*Database, error) {
+	var streamID uint32
+	var streamKey []byte
+	var binaries [][]byte
+	for {
+		if len(data) < 5 {
+			return nil, ErrCorrupted
+		}
+		id, size := data[0], int(binary.LittleEndian.Uint32(data[1:]))
+		if len(data) < 5+size {
+			return nil, ErrCorrupted
+		}
+		field := data[5 : 5+size]
+		data = data[5+size:]
+		if id == innerEnd {
+			break
+		}
+		switch id {
+		case innerStreamID:
+			if size != 4 {
+				return nil, ErrCorrupted
+			}
+			streamID = binary.LittleEndian.Uint32(field)
+		case innerStreamKey:
+			streamKey = field
+		case innerBinary:
+			if size < 1 {
+				return nil, ErrCorrupted
+			}
+			binaries = append(binaries, field[1:]) // первый байт — флаги защиты в памяти
+		}
+	}
+
+	stream, err := newInnerStream(streamID, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // KeePass может записать BOM
+	plain, err := transformProtected(data, stream, true)
+	if err != nil {
+		return nil, err
+	}
+	var file xmlFile
+	if err := xml.Unmarshal(plain, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	skip := ""
+	if isTrue(file.Meta.RecycleBinEnabled) {
+		skip = file.Meta.RecycleBinUUID
+	}
+	return &Database{
+		Name: file.Meta.DatabaseName,
+		Root: file.Root.Group.toGroup(binaries, skip),
+	}, nil
+}
+
+// Encode пишет базу в формате KDBX 4.0: AES-256, Argon2id, сжатие gzip и ChaCha20 для
+// защищённых полей — такой файл откроют KeePass 2.47+ (раньше в нём не было Argon2id)
+// и KeePassXC 2.6+.
+func Encode(w io.Writer, db *Database, password string, keyfile []byte) error {
+	composite, err := compositeKey(password, keyfile)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(composite)
+
+	h := &header{cipherID: cipherAES256, compressed: true}
+	random := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		return b, err
+	}
+	if h.masterSeed, err = random(32); err != nil {
+		return err
+	}
+	if h.iv, err = random(16); err != nil {
+		return err
+	}
+	salt, err := random(32)
+	if err != nil {
+		return err
+	}
+	h.kdf = newKDFParams(salt)
+	streamKey, err := random(64)
+	if err != nil {
+		return err
+	}
+
+	inner, err := encodeInner(db, streamKey)
+	if err != nil {
+		return err
+	}
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	if _, err := zw.Write(inner); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	crypto.Wipe(inner)
+
+	transformed, err := transformKey(h.kdf, composite)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(transformed)
+	encKey, hmacKey := fileKeys(h.masterSeed, transformed)
+	defer crypto.Wipe(encKey)
+	defer crypto.Wipe(hmacKey)
+	payload, err := encryptAES(encKey, h.iv, zipped.Bytes())
+	if err != nil {
+		return err
+	}
+
+	raw := h.bytes()
+	sum := sha256.Sum256(raw)
+	for _, b := range [][]byte{raw, sum[:], headerHMAC(hmacKey, raw)} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return writeBlocks(w, hmacKey, payload)
+}
+
+// encodeInner собирает внутренний заголовок с вложениями и XML с защищёнными значениями
+func encodeInner(db *Database, streamKey []byte) ([]byte, error) {
+	if db == nil {
+		return nil, errors.New("пустая база KeePass")
+	}
+	var pool binaryPool
+	file := xmlFile{Meta: xmlMeta{Generator: "PassLedger", DatabaseName: db.Name}}
+	file.Root.Group = fromGroup(db.Root, &pool)
+	plain, err := xml.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newInnerStream(innerStreamChaCha, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := transformProtected(plain, stream, false)
+	crypto.Wipe(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	field := func(id byte, parts ...[]byte) {
+		size := 0
+		for _, p := range parts {
+			size += len(p)
+		}
+		b.WriteByte(id)
+		binary.Write(&b, binary.LittleEndian, uint32(size))
+		for _, p := range parts {
+			b.Write(p)
+		}
+	}
+	field(innerStreamID, binary.LittleEndian.AppendUint32(nil, innerStreamChaCha))
+	field(innerStreamKey, streamKey)
+	for _, data := range pool.data {
+		field(innerBinary, []byte{0}, data)
+	}
+	field(innerEnd)
+	b.WriteString(xml.Header)
+	b.Write(body)
+	return b.Bytes(), nil
+}
@@ -0,0 +1,264 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	signature1 = 0x9AA2D903
+	signature2 = 0xB54BFB67
+
+	versionMajor4 = 4
+	// version40 — KDBX 4.0: пишем его, а не 4.1, чтобы файл открывали и старые версии KeePass
+	version40 = versionMajor4 << 16
+)
+
+// поля внешнего заголовка KDBX 4
+const (
+	hdrEnd              = 0
+	hdrCipherID         = 2
+	hdrCompression      = 3
+	hdrMasterSeed       = 4
+	hdrEncryptionIV     = 7
+	hdrKdfParameters    = 11
+	hdrPublicCustomData = 12
+)
+
+// поля внутреннего заголовка (после расшифровки и распаковки)
+const (
+	innerEnd          = 0
+	innerStreamID     = 1
+	innerStreamKey    = 2
+	innerBinary       = 3
+	innerStreamChaCha = 3
+	innerStreamSalsa  = 2
+)
+
+// UUID шифров и функций вывода ключа
+var (
+	cipherAES256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	cipherChaCha20 = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+
+	kdfAES      = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdfAESKDBX4 = []byte{0x7c, 0x02, 0xbb, 0x82, 0x79, 0xa7, 0x4a, 0xc0, 0x92, 0x7d, 0x11, 0x4a, 0x00, 0x64, 0x82, 0x38}
+	kdfArgon2d  = []byte{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdfArgon2id = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+// header — разобранный внешний заголовок
+type header struct {
+	cipherID   []byte
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        variantDict
+	raw        []byte // байты заголовка для SHA-256 и HMAC
+}
+
+// readHeader читает внешний заголовок вместе с сигнатурами и версией
+func readHeader(r io.Reader) (*header, error) {
+	var raw bytes.Buffer
+	tr := io.TeeReader(r, &raw)
+
+	var pre [12]byte
+	if _, err := io.ReadFull(tr, pre[:]); err != nil {
+		return nil, ErrNotKDBX
+	}
+	if binary.LittleEndian.Uint32(pre[0:]) != signature1 || binary.LittleEndian.Uint32(pre[4:]) != signature2 {
+		return nil, ErrNotKDBX
+	}
+	version := binary.LittleEndian.Uint32(pre[8:])
+	if version>>16 != versionMajor4 {
+		return nil, fmt.Errorf("поддерживаются только базы KDBX 4, а файл версии %d.%d; пересохраните его в KeePass 2.35+ или KeePassXC 2.7+",
+			version>>16, version&0xFFFF)
+	}
+
+	h := &header{}
+	for {
+		var field [5]byte
+		if _, err := io.ReadFull(tr, field[:]); err != nil {
+			return nil, ErrCorrupted
+		}
+		size := binary.LittleEndian.Uint32(field[1:])
+		if size > 1<<20 {
+			return nil, ErrCorrupted
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(tr, data); err != nil {
+			return nil, ErrCorrupted
+		}
+		switch field[0] {
+		case hdrEnd:
+			h.raw = raw.Bytes()
+			return h, h.validate()
+		case hdrCipherID:
+			h.cipherID = data
+		case hdrCompression:
+			if len(data) != 4 {
+				return nil, ErrCorrupted
+			}
+			h.compressed = binary.LittleEndian.Uint32(data) == 1
+		case hdrMasterSeed:
+			h.masterSeed = data
+		case hdrEncryptionIV:
+			h.iv = data
+		case hdrKdfParameters:
+			kdf, err := readVariantDict(data)
+			if err != nil {
+				return nil, err
+			}
+			h.kdf = kdf
+		case hdrPublicCustomData:
+			// данные плагинов KeePass нам не нужны
+		}
+	}
+}
+
+func (h *header) validate() error {
+	if len(h.masterSeed) != 32 || h.cipherID == nil || h.iv == nil || h.kdf == nil {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// bytes сериализует заголовок KDBX 4.0 и запоминает результат в raw
+func (h *header) bytes() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []uint32{signature1, signature2, version40})
+	field := func(id byte, data []byte) {
+		b.WriteByte(id)
+		binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+		b.Write(data)
+	}
+	compression := []byte{0, 0, 0, 0}
+	if h.compressed {
+		compression[0] = 1
+	}
+	field(hdrCipherID, h.cipherID)
+	field(hdrCompression, compression)
+	field(hdrMasterSeed, h.masterSeed)
+	field(hdrEncryptionIV, h.iv)
+	field(hdrKdfParameters, h.kdf.bytes())
+	field(hdrEnd, []byte("\r\n\r\n"))
+	h.raw = b.Bytes()
+	return h.raw
+}
+
+// типы значений VariantDictionary
+const (
+	vdUint32 = 0x04
+	vdUint64 = 0x05
+	vdBool   = 0x08
+	vdInt32  = 0x0C
+	vdInt64  = 0x0D
+	vdString = 0x18
+	vdBytes  = 0x42
+)
+
+// variantDict — словарь параметров KeePass (VariantDictionary); значения uint32, uint64,
+// bool, int32, int64, string или []byte
+type variantDict map[string]any
+
+func readVariantDict(data []byte) (variantDict, error) {
+	if len(data) < 2 || data[1] > 1 {
+		return nil, errors.New("неподдерживаемая версия параметров KDF базы KeePass")
+	}
+	d := variantDict{}
+	data = data[2:]
+	for len(data) > 0 {
+		typ := data[0]
+		if typ == 0 {
+			return d, nil
+		}
+		if len(data) < 5 {
+			return nil, ErrCorrupted
+		}
+		n := int(binary.LittleEndian.Uint32(data[1:]))
+		if len(data) < 5+n+4 {
+			return nil, ErrCorrupted
+		}
+		name := string(data[5 : 5+n])
+		data = data[5+n:]
+		m := int(binary.LittleEndian.Uint32(data))
+		if len(data) < 4+m {
+			return nil, ErrCorrupted
+		}
+		v := data[4 : 4+m]
+		data = data[4+m:]
+		switch {
+		case typ == vdUint32 && m == 4:
+			d[name] = binary.LittleEndian.Uint32(v)
+		case typ == vdUint64 && m == 8:
+			d[name] = binary.LittleEndian.Uint64(v)
+		case typ == vdBool && m == 1:
+			d[name] = v[0] != 0
+		case typ == vdInt32 && m == 4:
+			d[name] = int32(binary.LittleEndian.Uint32(v))
+		case typ == vdInt64 && m == 8:
+			d[name] = int64(binary.LittleEndian.Uint64(v))
+		case typ == vdString:
+			d[name] = string(v)
+		case typ == vdBytes:
+			d[name] = append([]byte(nil), v...)
+		default:
+			return nil, ErrCorrupted
+		}
+	}
+	return nil, ErrCorrupted
+}
+
+func (d variantDict) bytes() []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x00, 0x01})
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var typ byte
+		var v []byte
+		switch x := d[name].(type) {
+		case uint32:
+			typ, v = vdUint32, binary.LittleEndian.AppendUint32(nil, x)
+		case uint64:
+			typ, v = vdUint64, binary.LittleEndian.AppendUint64(nil, x)
+		case bool:
+			typ, v = vdBool, []byte{0}
+			if x {
+				v[0] = 1
+			}
+		case int32:
+			typ, v = vdInt32, binary.LittleEndian.AppendUint32(nil, uint32(x))
+		case int64:
+			typ, v = vdInt64, binary.LittleEndian.AppendUint64(nil, uint64(x))
+		case string:
+			typ, v = vdString, []byte(x)
+		case []byte:
+			typ, v = vdBytes, x
+		}
+		b.WriteByte(typ)
+		binary.Write(&b, binary.LittleEndian, uint32(len(name)))
+		b.WriteString(name)
+		binary.Write(&b, binary.LittleEndian, uint32(len(v)))
+		b.Write(v)
+	}
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+// uint64Param достаёт числовой параметр, записанный как UInt32 или UInt64
+func (d variantDict) uint64Param(name string) (uint64, bool) {
+	switch v := d[name].(type) {
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	}
+	return 0, false
+}
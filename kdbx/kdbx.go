@@ -0,0 +1,142 @@
+// Package kdbx читает и пишет базы KeePass формата KDBX 4: внешний контейнер
+// (AES-256 или ChaCha20, ключ через AES-KDF или Argon2) и внутренний XML с группами,
+// записями, историей и вложениями. Пакет ничего не знает о базе PassLedger —
+// перенос записей в неё и обратно делает вызывающий.
+package kdbx
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Стандартные строковые поля записи KeePass; остальные строки — пользовательские поля
+const (
+	FieldTitle    = "Title"
+	FieldUserName = "UserName"
+	FieldPassword = "Password"
+	FieldURL      = "URL"
+	FieldNotes    = "Notes"
+)
+
+var (
+	// ErrNotKDBX — файл не является базой KeePass
+	ErrNotKDBX = errors.New("файл не является базой KeePass (KDBX)")
+	// ErrCredentials — не подходит пароль или ключевой файл (не сошёлся HMAC заголовка)
+	ErrCredentials = errors.New("неверный пароль или ключевой файл базы KeePass")
+	// ErrCorrupted — нарушена целостность файла
+	ErrCorrupted = errors.New("файл базы KeePass повреждён")
+)
+
+// Database — содержимое файла KDBX
+type Database struct {
+	Name string
+	// Root — корневая группа; её записи в KeePass лежат вне подгрупп
+	Root Group
+}
+
+// Group — группа KeePass с подгруппами в порядке файла
+type Group struct {
+	Name    string
+	Notes   string
+	Groups  []Group
+	Entries []Entry
+}
+
+// Entry — запись KeePass. Строки хранятся в порядке файла, чтобы пользовательские поля
+// не перемешивались.
+type Entry struct {
+	Strings  []String
+	Tags     []string
+	Binaries []Binary
+	Created  time.Time
+	Modified time.Time
+	// History — прежние версии записи, от старых к новым; своей истории у них нет
+	History []Entry
+}
+
+// String — строковое поле записи; Protected — KeePass шифрует значение внутренним потоком
+type String struct {
+	Key       string
+	Value     string
+	Protected bool
+}
+
+// Binary — вложение записи
+type Binary struct {
+	Name string
+	Data []byte
+}
+
+// Get возвращает значение строкового поля key или пустую строку
+func (e Entry) Get(key string) string {
+	for _, s := range e.Strings {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// Has — есть ли у записи поле key, пусть даже пустое
+func (e Entry) Has(key string) bool {
+	for _, s := range e.Strings {
+		if s.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Set задаёт значение поля key, добавляя его в конец, если такого ещё нет
+func (e *Entry) Set(key, value string, protected bool) {
+	for i := range e.Strings {
+		if e.Strings[i].Key == key {
+			e.Strings[i].Value, e.Strings[i].Protected = value, protected
+			return
+		}
+	}
+	e.Strings = append(e.Strings, String{Key: key, Value: value, Protected: protected})
+}
+
+// IsStandardField — поле из стандартного набора KeePass (Title, UserName, ...)
+func IsStandardField(key string) bool {
+	switch key {
+	case FieldTitle, FieldUserName, FieldPassword, FieldURL, FieldNotes:
+		return true
+	}
+	return false
+}
+
+// ParseTags разбирает теги KeePass: KeePass разделяет их «;», KeePassXC — и «,»
+func ParseTags(s string) []string {
+	var out []string
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ',' }) {
+		if t = strings.TrimSpace(t); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// compositeKey — составной ключ KeePass: SHA-256 от SHA-256 пароля и ключа из ключевого файла.
+// Пустой пароль не участвует, как и в KeePass при открытии только ключевым файлом.
+func compositeKey(password string, keyfile []byte) ([]byte, error) {
+	if password == "" && len(keyfile) == 0 {
+		return nil, errors.New("не указан ни пароль, ни ключевой файл базы KeePass")
+	}
+	h := sha256.New()
+	if password != "" {
+		p := sha256.Sum256([]byte(password))
+		h.Write(p[:])
+	}
+	if len(keyfile) > 0 {
+		k, err := keyfileKey(keyfile)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(k)
+	}
+	return h.Sum(nil), nil
+}
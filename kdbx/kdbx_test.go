@@ -0,0 +1,263 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Базы в testdata собирает testdata/make_fixtures.py независимо от этого пакета;
+// у всех одно содержимое и пароль fixturePassword
+const fixturePassword = "тест-пароль"
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeFixtures(t *testing.T) {
+	tests := []struct {
+		file    string
+		keyfile string
+	}{
+		{file: "aeskdf-aes.kdbx"},
+		{file: "argon2d-chacha20.kdbx"},
+		{file: "argon2id-aes-keyfile.kdbx", keyfile: "keyfile.keyx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			var keyfile []byte
+			if tt.keyfile != "" {
+				keyfile = readFixture(t, tt.keyfile)
+			}
+			db, err := Decode(bytes.NewReader(readFixture(t, tt.file)), fixturePassword, keyfile)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			checkFixture(t, db)
+		})
+	}
+}
+
+// checkFixture сверяет содержимое с тем, что пишет make_fixtures.py
+func checkFixture(t *testing.T, db *Database) {
+	t.Helper()
+	if db.Name != "Тестовая база" || db.Root.Name != "Root" {
+		t.Fatalf("имя базы %q, корень %q", db.Name, db.Root.Name)
+	}
+	if len(db.Root.Entries) != 1 {
+		t.Fatalf("в корне %d записей, ожидалась 1", len(db.Root.Entries))
+	}
+	root := db.Root.Entries[0]
+	if root.Get(FieldTitle) != "В корне" || root.Get(FieldUserName) != "root" || root.Get(FieldPassword) != "" || !root.Has(FieldPassword) {
+		t.Errorf("запись в корне: %+v", root.Strings)
+	}
+
+	var names []string
+	for _, g := range db.Root.Groups {
+		names = append(names, g.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Работа", "Личное"}) {
+		t.Fatalf("группы корня %q: корзина должна пропускаться", names)
+	}
+	work, personal := db.Root.Groups[0], db.Root.Groups[1]
+	if work.Notes != "Рабочие учётки" || len(work.Entries) != 0 || len(work.Groups) != 1 || work.Groups[0].Name != "Проект" {
+		t.Fatalf("группа «Работа»: %+v", work)
+	}
+
+	project := work.Groups[0]
+	if len(project.Entries) != 1 {
+		t.Fatalf("в «Проект» %d записей", len(project.Entries))
+	}
+	server := project.Entries[0]
+	wantStrings := []String{
+		{Key: FieldNotes, Value: "Первая строка\nвторая & <третья>"},
+		{Key: "PIN", Value: "4321", Protected: true},
+		{Key: FieldPassword, Value: "s3cr3t-пароль", Protected: true},
+		{Key: FieldTitle, Value: "Сервер"},
+		{Key: FieldURL, Value: "ssh://srv.example.org"},
+		{Key: FieldUserName, Value: "admin"},
+		{Key: "otp", Value: "otpauth://totp/srv?secret=JBSWY3DPEHPK3PXP&period=30&digits=6", Protected: true},
+		{Key: "Комната", Value: "312"},
+	}
+	if !reflect.DeepEqual(server.Strings, wantStrings) {
+		t.Errorf("поля записи «Сервер»:\n%+v\nожидались\n%+v", server.Strings, wantStrings)
+	}
+	if !reflect.DeepEqual(server.Tags, []string{"работа", "ssh", "прод"}) {
+		t.Errorf("теги %q", server.Tags)
+	}
+	if len(server.Binaries) != 2 || server.Binaries[0].Name != "id_ed25519.pub" || server.Binaries[1].Name != "заметка.txt" ||
+		!bytes.HasPrefix(server.Binaries[0].Data, []byte("ssh-ed25519 ")) ||
+		!bytes.HasPrefix(server.Binaries[1].Data, []byte("Вложение, которое есть")) {
+		t.Errorf("вложения записи «Сервер»: %+v", server.Binaries)
+	}
+	if want := time.Date(2023, 3, 14, 9, 26, 53, 0, time.UTC); !server.Created.Equal(want) {
+		t.Errorf("создана %v, ожидалось %v", server.Created, want)
+	}
+	if want := time.Date(2024, 11, 5, 7, 45, 10, 0, time.UTC); !server.Modified.Equal(want) {
+		t.Errorf("изменена %v, ожидалось %v", server.Modified, want)
+	}
+
+	if len(personal.Entries) != 1 {
+		t.Fatalf("в «Личное» %d записей", len(personal.Entries))
+	}
+	mail := personal.Entries[0]
+	if mail.Get(FieldPassword) != "новый" || len(mail.Binaries) != 0 {
+		t.Errorf("запись «Почта»: %+v", mail)
+	}
+	if len(mail.History) != 2 {
+		t.Fatalf("в истории %d версий, ожидалось 2", len(mail.History))
+	}
+	for i, want := range []string{"старый-1", "старый-2"} {
+		old := mail.History[i]
+		if old.Get(FieldPassword) != want || old.Get(FieldTitle) != "Почта" || len(old.History) != 0 {
+			t.Errorf("версия %d: %+v", i, old.Strings)
+		}
+		if len(old.Binaries) != 1 || !bytes.Equal(old.Binaries[0].Data, server.Binaries[1].Data) {
+			t.Errorf("версия %d: вложение из общего пула не найдено: %+v", i, old.Binaries)
+		}
+	}
+	if !mail.History[0].Modified.Before(mail.History[1].Modified) {
+		t.Error("версии истории должны идти от старых к новым")
+	}
+}
+
+func TestDecodeWrongCredentials(t *testing.T) {
+	data := readFixture(t, "argon2id-aes-keyfile.kdbx")
+	keyfile := readFixture(t, "keyfile.keyx")
+	if _, err := Decode(bytes.NewReader(data), "не тот пароль", keyfile); !errors.Is(err, ErrCredentials) {
+		t.Errorf("неверный пароль: %v", err)
+	}
+	if _, err := Decode(bytes.NewReader(data), fixturePassword, nil); !errors.Is(err, ErrCredentials) {
+		t.Errorf("без ключевого файла: %v", err)
+	}
+}
+
+func TestDecodeCorrupted(t *testing.T) {
+	data := readFixture(t, "aeskdf-aes.kdbx")
+	data[len(data)-100] ^= 1
+	if _, err := Decode(bytes.NewReader(data), fixturePassword, nil); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("изменённый блок: %v", err)
+	}
+	if _, err := Decode(bytes.NewReader([]byte("SQLite format 3\x00")), fixturePassword, nil); !errors.Is(err, ErrNotKDBX) {
+		t.Errorf("не KDBX: %v", err)
+	}
+}
+
+// Параметры KDF из заголовка сверх пределов отклоняются до вывода ключа
+func TestKDFLimits(t *testing.T) {
+	salt := bytes.Repeat([]byte{1}, 32)
+	argon2 := func(iterations, memory uint64) variantDict {
+		return variantDict{"$UUID": kdfArgon2id, "S": salt, "I": iterations, "M": memory, "P": uint32(2), "V": uint32(argon2Version)}
+	}
+	tests := map[string]variantDict{
+		"раунды AES-KDF":   {"$UUID": kdfAESKDBX4, "S": salt, "R": uint64(maxAESRounds + 1)},
+		"проходы Argon2":   argon2(maxArgon2Iterations+1, 64<<20),
+		"память Argon2":    argon2(2, maxArgon2Memory+1024),
+		"нулевые проходы":  argon2(0, 64<<20),
+		"огромная память":  argon2(2, 1<<42),
+		"огромные проходы": argon2(1<<32-1, 64<<20),
+	}
+	for name, kdf := range tests {
+		if _, err := transformKey(kdf, []byte("ключ")); err == nil {
+			t.Errorf("%s: параметры приняты", name)
+		}
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	modified := time.Date(2024, 2, 29, 23, 59, 59, 0, time.UTC)
+	attachment := Binary{Name: "файл.bin", Data: []byte{0, 1, 2, 0xff}}
+	entry := Entry{
+		Strings: []String{
+			{Key: FieldTitle, Value: "Банк"},
+			{Key: FieldUserName, Value: "client"},
+			{Key: FieldPassword, Value: "p@ss <&>", Protected: true},
+			{Key: FieldURL, Value: "https://bank.example"},
+			{Key: FieldNotes, Value: "две\nстроки"},
+			{Key: "Кодовое слово", Value: "сова", Protected: true},
+			{Key: "Отделение", Value: "№ 5"},
+		},
+		Tags:     []string{"финансы", "важное"},
+		Binaries: []Binary{attachment},
+		Created:  created,
+		Modified: modified,
+		History: []Entry{{
+			Strings: []String{
+				{Key: FieldTitle, Value: "Банк"},
+				{Key: FieldPassword, Value: "прежний", Protected: true},
+			},
+			Binaries: []Binary{attachment},
+			Created:  created,
+			Modified: created,
+		}},
+	}
+	want := &Database{
+		Name: "Экспорт",
+		Root: Group{
+			Name: "PassLedger",
+			Groups: []Group{{
+				Name:  "Работа",
+				Notes: "заметка группы",
+				Groups: []Group{{
+					Name:    "Проект",
+					Entries: []Entry{entry},
+				}},
+			}},
+		},
+	}
+	keyfile := []byte("произвольный ключевой файл")
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, want, "пароль", keyfile); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	got, err := Decode(bytes.NewReader(buf.Bytes()), "пароль", keyfile)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	normalizeTimes(&got.Root)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("после Encode и Decode:\n%+v\nожидалось\n%+v", got, want)
+	}
+	if _, err := Decode(bytes.NewReader(buf.Bytes()), "пароль", nil); !errors.Is(err, ErrCredentials) {
+		t.Errorf("без ключевого файла: %v", err)
+	}
+}
+
+// normalizeTimes переводит время в UTC, чтобы сравнивать через reflect.DeepEqual
+func normalizeTimes(g *Group) {
+	for i := range g.Entries {
+		normalizeEntryTimes(&g.Entries[i])
+	}
+	for i := range g.Groups {
+		normalizeTimes(&g.Groups[i])
+	}
+}
+
+func normalizeEntryTimes(e *Entry) {
+	e.Created, e.Modified = e.Created.UTC(), e.Modified.UTC()
+	for i := range e.History {
+		normalizeEntryTimes(&e.History[i])
+	}
+}
+
+// Тестовый вектор Argon2d из RFC 9106, раздел 5.1
+func TestArgon2dRFC9106(t *testing.T) {
+	got := argon2d(bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 16),
+		bytes.Repeat([]byte{0x03}, 8), bytes.Repeat([]byte{0x04}, 12), 3, 32, 4, 32)
+	want := "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("argon2d = %x, ожидалось %s", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// keyfileXML — ключевой файл KeePass в формате XML (версии 1.0 и 2.0)
+type keyfileXML struct {
+	XMLName xml.Name `xml:"KeyFile"`
+	Version string   `xml:"Meta>Version"`
+	Data    struct {
+		Hash  string `xml:"Hash,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Key>Data"`
+}
+
+// keyfileKey извлекает 32-байтный ключ из содержимого ключевого файла так же, как KeePass:
+// XML-файл с ключом, ровно 32 байта, 64 шестнадцатеричных символа или SHA-256 любого другого файла
+func keyfileKey(data []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<KeyFile")) {
+		var kf keyfileXML
+		if err := xml.Unmarshal(trimmed, &kf); err == nil && kf.Data.Value != "" {
+			return xmlKeyfileKey(kf)
+		}
+	}
+	if len(data) == 32 {
+		return append([]byte(nil), data...), nil
+	}
+	if len(data) == 64 {
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+func xmlKeyfileKey(kf keyfileXML) ([]byte, error) {
+	value := strings.Join(strings.Fields(kf.Data.Value), "")
+	if strings.HasPrefix(kf.Version, "1.") {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный ключевой файл KeePass: %w", err)
+		}
+		return key, nil
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный ключевой файл KeePass: %w", err)
+	}
+	// в версии 2.0 рядом с ключом лежат первые 4 байта его SHA-256 для проверки опечаток
+	if kf.Data.Hash != "" {
+		sum := sha256.Sum256(key)
+		if !strings.EqualFold(hex.EncodeToString(sum[:4]), kf.Data.Hash) {
+			return nil, fmt.Errorf("ключевой файл KeePass повреждён: не совпадает контрольная сумма")
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,176 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// blockSize — размер блока HMAC-потока при записи, как в KeePass
+const blockSize = 1 << 20
+
+// fileKeys — ключ шифрования содержимого и базовый ключ HMAC
+func fileKeys(masterSeed, transformed []byte) (encKey, hmacKey []byte) {
+	enc := sha256.Sum256(append(append([]byte(nil), masterSeed...), transformed...))
+	mac := sha512.Sum512(append(append(append([]byte(nil), masterSeed...), transformed...), 0x01))
+	return enc[:], mac[:]
+}
+
+// blockHMACKey — ключ HMAC блока index; заголовок подписывается индексом 2^64-1
+func blockHMACKey(hmacKey []byte, index uint64) []byte {
+	var idx [8]byte
+	binary.LittleEndian.PutUint64(idx[:], index)
+	sum := sha512.Sum512(append(idx[:], hmacKey...))
+	return sum[:]
+}
+
+func headerHMAC(hmacKey, raw []byte) []byte {
+	mac := hmac.New(sha256.New, blockHMACKey(hmacKey, ^uint64(0)))
+	mac.Write(raw)
+	return mac.Sum(nil)
+}
+
+func blockHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	var prefix [12]byte
+	binary.LittleEndian.PutUint64(prefix[:8], index)
+	binary.LittleEndian.PutUint32(prefix[8:], uint32(len(data)))
+	mac := hmac.New(sha256.New, blockHMACKey(hmacKey, index))
+	mac.Write(prefix[:])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// readBlocks читает HMAC-поток блоков до пустого завершающего блока, проверяя каждый блок
+func readBlocks(r io.Reader, hmacKey []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for index := uint64(0); ; index++ {
+		var hdr [36]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, ErrCorrupted
+		}
+		size := binary.LittleEndian.Uint32(hdr[32:])
+		if size > 1<<30 {
+			return nil, ErrCorrupted
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, ErrCorrupted
+		}
+		if !hmac.Equal(hdr[:32], blockHMAC(hmacKey, index, data)) {
+			return nil, ErrCorrupted
+		}
+		if size == 0 {
+			return out.Bytes(), nil
+		}
+		out.Write(data)
+	}
+}
+
+// writeBlocks пишет данные HMAC-потоком блоков
+func writeBlocks(w io.Writer, hmacKey, data []byte) error {
+	for index := uint64(0); ; index++ {
+		n := min(len(data), blockSize)
+		var size [4]byte
+		binary.LittleEndian.PutUint32(size[:], uint32(n))
+		for _, b := range [][]byte{blockHMAC(hmacKey, index, data[:n]), size[:], data[:n]} {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		data = data[n:]
+	}
+}
+
+// decryptPayload расшифровывает содержимое шифром из заголовка
+func decryptPayload(cipherID, key, iv, data []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(cipherID, cipherAES256):
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+			return nil, ErrCorrupted
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+		pad := int(out[len(out)-1])
+		if pad == 0 || pad > aes.BlockSize {
+			return nil, ErrCorrupted
+		}
+		return out[:len(out)-pad], nil
+	case bytes.Equal(cipherID, cipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out, nil
+	}
+	return nil, errors.New("неподдерживаемый шифр базы KeePass (поддерживаются AES-256 и ChaCha20)")
+}
+
+// encryptAES шифрует содержимое AES-256-CBC с дополнением PKCS#7
+func encryptAES(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	out := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out, nil
+}
+
+// innerStream — поток, которым защищены значения с атрибутом Protected во внутреннем XML
+type innerStream interface {
+	XORKeyStream(dst, src []byte)
+}
+
+func newInnerStream(id uint32, key []byte) (innerStream, error) {
+	switch id {
+	case innerStreamChaCha:
+		h := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(h[:32], h[32:44])
+	case innerStreamSalsa:
+		k := sha256.Sum256(key)
+		s := &salsaStream{key: k}
+		copy(s.counter[:8], []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A})
+		return s, nil
+	}
+	return nil, errors.New("неподдерживаемый внутренний поток базы KeePass")
+}
+
+// salsaStream — Salsa20 со сквозным счётчиком блоков; встречается в файлах,
+// сконвертированных из KDBX 3
+type salsaStream struct {
+	key     [32]byte
+	counter [16]byte // nonce и номер блока
+	buf     [64]byte
+	pos     int
+}
+
+func (s *salsaStream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.pos == 0 {
+			var zero [64]byte
+			salsa.XORKeyStream(s.buf[:], zero[:], &s.counter, &s.key)
+			binary.LittleEndian.PutUint64(s.counter[8:], binary.LittleEndian.Uint64(s.counter[8:])+1)
+		}
+		dst[i] = src[i] ^ s.buf[s.pos]
+		s.pos = (s.pos + 1) % 64
+	}
+}
@@ -0,0 +1,456 @@
+#!/usr/bin/env python3
+"""Собирает тестовые базы KDBX 4 для kdbx_test.go независимо от пакета kdbx.
+
+Нужны только стандартная библиотека Python и openssl (AES-256-CBC/ECB и ChaCha20);
+Argon2d/Argon2id реализованы здесь же по RFC 9106 и перед сборкой проверяются
+на тестовых векторах RFC. XML повторяет то, что пишет KeePassXC 2.7: порядок элементов,
+защищённые значения потоком ChaCha20 в порядке документа, вложения во внутреннем
+заголовке, корзина в Meta. Все «случайные» значения выводятся из меток, поэтому
+повторный запуск даёт те же файлы:
+
+    cd kdbx/testdata && python3 make_fixtures.py
+"""
+
+import base64
+import gzip
+import hashlib
+import hmac
+import struct
+import subprocess
+from datetime import datetime, timezone
+
+PASSWORD = "тест-пароль"
+M64 = (1 << 64) - 1
+
+
+def det(label, n):
+    """Детерминированные «случайные» байты"""
+    out = b""
+    i = 0
+    while len(out) < n:
+        out += hashlib.sha256(f"{label}:{i}".encode()).digest()
+        i += 1
+    return out[:n]
+
+
+# --- Argon2 (RFC 9106) ---
+
+def blake2b_long(out_len, data):
+    prefix = struct.pack("<I", out_len)
+    if out_len <= 64:
+        return hashlib.blake2b(prefix + data, digest_size=out_len).digest()
+    r = (out_len + 31) // 32 - 2
+    v = hashlib.blake2b(prefix + data).digest()
+    out = v[:32]
+    for _ in range(1, r):
+        v = hashlib.blake2b(v).digest()
+        out += v[:32]
+    return out + hashlib.blake2b(v, digest_size=out_len - 32 * r).digest()
+
+
+def _gb(v, a, b, c, d):
+    def f(x, y):
+        return (x + y + 2 * (x & 0xFFFFFFFF) * (y & 0xFFFFFFFF)) & M64
+
+    def rotr(x, n):
+        return ((x >> n) | (x << (64 - n))) & M64
+
+    v[a] = f(v[a], v[b]); v[d] = rotr(v[d] ^ v[a], 32)
+    v[c] = f(v[c], v[d]); v[b] = rotr(v[b] ^ v[c], 24)
+    v[a] = f(v[a], v[b]); v[d] = rotr(v[d] ^ v[a], 16)
+    v[c] = f(v[c], v[d]); v[b] = rotr(v[b] ^ v[c], 63)
+
+
+def _p(v, i):
+    _gb(v, i[0], i[4], i[8], i[12]); _gb(v, i[1], i[5], i[9], i[13])
+    _gb(v, i[2], i[6], i[10], i[14]); _gb(v, i[3], i[7], i[11], i[15])
+    _gb(v, i[0], i[5], i[10], i[15]); _gb(v, i[1], i[6], i[11], i[12])
+    _gb(v, i[2], i[7], i[8], i[13]); _gb(v, i[3], i[4], i[9], i[14])
+
+
+ROWS = [list(range(16 * i, 16 * i + 16)) for i in range(8)]
+COLS = [[2 * i + 16 * j + k for j in range(8) for k in (0, 1)] for i in range(8)]
+
+
+def compress(x, y):
+    r = [a ^ b for a, b in zip(x, y)]
+    q = r[:]
+    for idx in ROWS:
+        _p(q, idx)
+    for idx in COLS:
+        _p(q, idx)
+    return [a ^ b for a, b in zip(q, r)]
+
+
+def to_block(b):
+    return list(struct.unpack("<128Q", b))
+
+
+def argon2(kind, password, salt, secret, data, passes, memory, lanes, tag_len):
+    """kind: 0 — Argon2d, 2 — Argon2id; memory в КиБ"""
+    h0 = hashlib.blake2b(
+        struct.pack("<6I", lanes, tag_len, memory, passes, 0x13, kind)
+        + struct.pack("<I", len(password)) + password
+        + struct.pack("<I", len(salt)) + salt
+        + struct.pack("<I", len(secret)) + secret
+        + struct.pack("<I", len(data)) + data
+    ).digest()
+    m = 4 * lanes * (memory // (4 * lanes))
+    lane_len = m // lanes
+    seg_len = lane_len // 4
+    B = [None] * m
+    for lane in range(lanes):
+        for i in range(2):
+            B[lane * lane_len + i] = to_block(blake2b_long(1024, h0 + struct.pack("<II", i, lane)))
+    zero = [0] * 128
+    for ps in range(passes):
+        for sl in range(4):
+            for lane in range(lanes):
+                independent = kind == 2 and ps == 0 and sl < 2
+                addresses, counter = None, 0
+
+                def next_addresses():
+                    nonlocal counter
+                    counter += 1
+                    z = [ps, lane, sl, m, passes, kind, counter] + [0] * 121
+                    return compress(zero, compress(zero, z))
+
+                start = 0
+                if ps == 0 and sl == 0:
+                    start = 2
+                    if independent:
+                        addresses = next_addresses()
+                for index in range(start, seg_len):
+                    cur = lane * lane_len + sl * seg_len + index
+                    prev = cur - 1 if cur % lane_len else cur + lane_len - 1
+                    if independent:
+                        if index % 128 == 0:
+                            addresses = next_addresses()
+                        rnd = addresses[index % 128]
+                    else:
+                        rnd = B[prev][0]
+                    j1, j2 = rnd & 0xFFFFFFFF, rnd >> 32
+                    ref_lane = lane if ps == 0 and sl == 0 else j2 % lanes
+                    same = ref_lane == lane
+                    if ps == 0:
+                        if sl == 0:
+                            area = index - 1
+                        elif same:
+                            area = sl * seg_len + index - 1
+                        else:
+                            area = sl * seg_len - (1 if index == 0 else 0)
+                    else:
+                        if same:
+                            area = lane_len - seg_len + index - 1
+                        else:
+                            area = lane_len - seg_len - (1 if index == 0 else 0)
+                    rel = area - 1 - ((area * ((j1 * j1) >> 32)) >> 32)
+                    start_pos = 0 if ps == 0 or sl == 3 else (sl + 1) * seg_len
+                    ref = ref_lane * lane_len + (start_pos + rel) % lane_len
+                    nb = compress(B[prev], B[ref])
+                    if ps > 0:
+                        nb = [a ^ b for a, b in zip(nb, B[cur])]
+                    B[cur] = nb
+    c = B[lane_len - 1]
+    for lane in range(1, lanes):
+        c = [a ^ b for a, b in zip(c, B[lane * lane_len + lane_len - 1])]
+    return blake2b_long(tag_len, struct.pack("<128Q", *c))
+
+
+def check_rfc9106():
+    args = (b"\x01" * 32, b"\x02" * 16, b"\x03" * 8, b"\x04" * 12, 3, 32, 4, 32)
+    vectors = {
+        0: "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb",
+        2: "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659",
+    }
+    for kind, want in vectors.items():
+        got = argon2(kind, *args).hex()
+        assert got == want, f"Argon2 тип {kind}: {got}"
+
+
+# --- openssl ---
+
+def openssl(*args, data):
+    return subprocess.run(["openssl", *args], input=data, capture_output=True, check=True).stdout
+
+
+def aes_cbc(key, iv, data):
+    return openssl("enc", "-aes-256-cbc", "-K", key.hex(), "-iv", iv.hex(), data=data)
+
+
+def aes_kdf(composite, seed, rounds):
+    key = composite
+    for _ in range(rounds):
+        key = openssl("enc", "-aes-256-ecb", "-nopad", "-K", seed.hex(), data=key)
+    return hashlib.sha256(key).digest()
+
+
+def chacha20(key, nonce, data):
+    iv = b"\x00\x00\x00\x00" + nonce  # счётчик блоков (LE) и 96-битный nonce
+    return openssl("enc", "-chacha20", "-K", key.hex(), "-iv", iv.hex(), data=data)
+
+
+# --- формат ---
+
+CIPHER_AES = bytes.fromhex("31c1f2e6bf714350be5805216afc5aff")
+CIPHER_CHACHA = bytes.fromhex("d6038a2b8b6f4cb5a524339a31dbb59a")
+KDF_AES = bytes.fromhex("7c02bb8279a74ac0927d114a00648238")
+KDF_ARGON2D = bytes.fromhex("ef636ddf8c29444b91f7a9a403e30a0c")
+KDF_ARGON2ID = bytes.fromhex("9e298b1956db4773b23dfc3ec6f0a1e6")
+
+
+def variant_dict(items):
+    out = b"\x00\x01"
+    for name, typ, value in items:
+        if typ == 0x04:
+            v = struct.pack("<I", value)
+        elif typ == 0x05:
+            v = struct.pack("<Q", value)
+        else:
+            v = value
+        out += bytes([typ]) + struct.pack("<I", len(name)) + name.encode() + struct.pack("<I", len(v)) + v
+    return out + b"\x00"
+
+
+def tlv(field, data):
+    return bytes([field]) + struct.pack("<I", len(data)) + data
+
+
+def block_key(hmac_key, index):
+    return hashlib.sha512(struct.pack("<Q", index) + hmac_key).digest()
+
+
+def kdbx_time(dt):
+    secs = int((dt - datetime(1, 1, 1, tzinfo=timezone.utc)).total_seconds())
+    return base64.b64encode(struct.pack("<q", secs)).decode()
+
+
+def uid(label):
+    return base64.b64encode(det("uuid:" + label, 16)).decode()
+
+
+def esc(s):
+    return s.replace("&", "&amp;").replace("<", "&lt;").replace(">", "&gt;")
+
+
+class Protector:
+    """Внутренний поток ChaCha20: значения шифруются по порядку документа"""
+
+    def __init__(self, key):
+        h = hashlib.sha512(key).digest()
+        self.keystream = chacha20(h[:32], h[32:44], b"\x00" * (1 << 16))
+        self.pos = 0
+
+    def protect(self, text):
+        raw = text.encode()
+        ks = self.keystream[self.pos:self.pos + len(raw)]
+        self.pos += len(raw)
+        return base64.b64encode(bytes(a ^ b for a, b in zip(raw, ks))).decode()
+
+
+T_CREATED = datetime(2023, 3, 14, 9, 26, 53, tzinfo=timezone.utc)
+T_V1 = datetime(2023, 6, 1, 12, 0, 0, tzinfo=timezone.utc)
+T_V2 = datetime(2024, 1, 20, 18, 30, 0, tzinfo=timezone.utc)
+T_NOW = datetime(2024, 11, 5, 7, 45, 10, tzinfo=timezone.utc)
+
+
+def times(created, modified, indent):
+    t = "\t" * indent
+    return (f"{t}<Times>\n"
+            f"{t}\t<LastModificationTime>{kdbx_time(modified)}</LastModificationTime>\n"
+            f"{t}\t<CreationTime>{kdbx_time(created)}</CreationTime>\n"
+            f"{t}\t<LastAccessTime>{kdbx_time(modified)}</LastAccessTime>\n"
+            f"{t}\t<ExpiryTime>{kdbx_time(modified)}</ExpiryTime>\n"
+            f"{t}\t<Expires>False</Expires>\n"
+            f"{t}\t<UsageCount>0</UsageCount>\n"
+            f"{t}\t<LocationChanged>{kdbx_time(created)}</LocationChanged>\n"
+            f"{t}</Times>\n")
+
+
+def entry_xml(p, e, indent, history=()):
+    t = "\t" * indent
+    out = (f"{t}<Entry>\n{t}\t<UUID>{uid(e['uuid'])}</UUID>\n{t}\t<IconID>0</IconID>\n"
+           f"{t}\t<ForegroundColor/>\n{t}\t<BackgroundColor/>\n{t}\t<OverrideURL/>\n"
+           f"{t}\t<Tags>{esc(e.get('tags', ''))}</Tags>\n")
+    out += times(e["created"], e["modified"], indent + 1)
+    for key, value, protected in e["strings"]:
+        if protected:
+            out += f"{t}\t<String>\n{t}\t\t<Key>{esc(key)}</Key>\n{t}\t\t<Value Protected=\"True\">{p.protect(value)}</Value>\n{t}\t</String>\n"
+        elif value == "":
+            out += f"{t}\t<String>\n{t}\t\t<Key>{esc(key)}</Key>\n{t}\t\t<Value/>\n{t}\t</String>\n"
+        else:
+            out += f"{t}\t<String>\n{t}\t\t<Key>{esc(key)}</Key>\n{t}\t\t<Value>{esc(value)}</Value>\n{t}\t</String>\n"
+    for key, ref in e.get("binaries", []):
+        out += f"{t}\t<Binary>\n{t}\t\t<Key>{esc(key)}</Key>\n{t}\t\t<Value Ref=\"{ref}\"/>\n{t}\t</Binary>\n"
+    out += (f"{t}\t<AutoType>\n{t}\t\t<Enabled>True</Enabled>\n{t}\t\t<DataTransferObfuscation>0</DataTransferObfuscation>\n"
+            f"{t}\t\t<DefaultSequence/>\n{t}\t</AutoType>\n")
+    if history:
+        # версии пишутся после полей записи: поток защищённых значений идёт по порядку документа
+        out += f"{t}\t<History>\n" + "".join(entry_xml(p, h, indent + 2) for h in history) + f"{t}\t</History>\n"
+    return out + f"{t}</Entry>\n"
+
+
+def group_open(name, label, indent, notes=""):
+    t = "\t" * indent
+    out = f"{t}<Group>\n{t}\t<UUID>{uid(label)}</UUID>\n{t}\t<Name>{esc(name)}</Name>\n"
+    out += f"{t}\t<Notes>{esc(notes)}</Notes>\n" if notes else f"{t}\t<Notes/>\n"
+    out += f"{t}\t<IconID>48</IconID>\n" + times(T_CREATED, T_CREATED, indent + 1)
+    return out + (f"{t}\t<IsExpanded>True</IsExpanded>\n{t}\t<DefaultAutoTypeSequence/>\n"
+                  f"{t}\t<EnableAutoType>null</EnableAutoType>\n{t}\t<EnableSearching>null</EnableSearching>\n"
+                  f"{t}\t<LastTopVisibleEntry>AAAAAAAAAAAAAAAAAAAAAA==</LastTopVisibleEntry>\n")
+
+
+def build_xml(p):
+    """Содержимое всех тестовых баз; kdbx_test.go проверяет именно его"""
+    root_entry = {"uuid": "root-entry", "created": T_CREATED, "modified": T_CREATED, "strings": [
+        ("Notes", "", False), ("Password", "", True), ("Title", "В корне", False),
+        ("URL", "", False), ("UserName", "root", False)]}
+    server = {"uuid": "server", "created": T_CREATED, "modified": T_NOW, "tags": "работа;ssh,прод", "strings": [
+        ("Notes", "Первая строка\nвторая & <третья>", False),
+        ("PIN", "4321", True),
+        ("Password", "s3cr3t-пароль", True),
+        ("Title", "Сервер", False),
+        ("URL", "ssh://srv.example.org", False),
+        ("UserName", "admin", False),
+        ("otp", "otpauth://totp/srv?secret=JBSWY3DPEHPK3PXP&period=30&digits=6", True),
+        ("Комната", "312", False)],
+        "binaries": [("id_ed25519.pub", 0), ("заметка.txt", 1)]}
+    mail_v1 = {"uuid": "mail", "created": T_CREATED, "modified": T_V1, "strings": [
+        ("Notes", "", False), ("Password", "старый-1", True), ("Title", "Почта", False),
+        ("URL", "https://mail.example.org", False), ("UserName", "me@example.org", False)],
+        "binaries": [("заметка.txt", 1)]}
+    mail_v2 = dict(mail_v1, modified=T_V2, strings=[
+        ("Notes", "", False), ("Password", "старый-2", True), ("Title", "Почта", False),
+        ("URL", "https://mail.example.org", False), ("UserName", "me@example.org", False)])
+    mail = dict(mail_v1, modified=T_NOW, strings=[
+        ("Notes", "", False), ("Password", "новый", True), ("Title", "Почта", False),
+        ("URL", "https://mail.example.org", False), ("UserName", "me@example.org", False)],
+        binaries=[])
+    trashed = {"uuid": "trashed", "created": T_CREATED, "modified": T_V1, "strings": [
+        ("Notes", "", False), ("Password", "удалено", True), ("Title", "Удалённая", False),
+        ("URL", "", False), ("UserName", "", False)]}
+
+    x = ('<?xml version="1.0" encoding="UTF-8" standalone="yes"?>\n<KeePassFile>\n\t<Meta>\n'
+         "\t\t<Generator>KeePassXC</Generator>\n"
+         "\t\t<DatabaseName>Тестовая база</DatabaseName>\n"
+         f"\t\t<DatabaseNameChanged>{kdbx_time(T_CREATED)}</DatabaseNameChanged>\n"
+         "\t\t<DatabaseDescription/>\n"
+         f"\t\t<DatabaseDescriptionChanged>{kdbx_time(T_CREATED)}</DatabaseDescriptionChanged>\n"
+         "\t\t<DefaultUserName/>\n"
+         f"\t\t<DefaultUserNameChanged>{kdbx_time(T_CREATED)}</DefaultUserNameChanged>\n"
+         "\t\t<MaintenanceHistoryDays>365</MaintenanceHistoryDays>\n"
+         "\t\t<Color/>\n"
+         f"\t\t<MasterKeyChanged>{kdbx_time(T_CREATED)}</MasterKeyChanged>\n"
+         "\t\t<MasterKeyChangeRec>-1</MasterKeyChangeRec>\n"
+         "\t\t<MasterKeyChangeForce>-1</MasterKeyChangeForce>\n"
+         "\t\t<MemoryProtection>\n\t\t\t<ProtectTitle>False</ProtectTitle>\n"
+         "\t\t\t<ProtectUserName>False</ProtectUserName>\n\t\t\t<ProtectPassword>True</ProtectPassword>\n"
+         "\t\t\t<ProtectURL>False</ProtectURL>\n\t\t\t<ProtectNotes>False</ProtectNotes>\n"
+         "\t\t</MemoryProtection>\n"
+         "\t\t<CustomIcons/>\n"
+         "\t\t<RecycleBinEnabled>True</RecycleBinEnabled>\n"
+         f"\t\t<RecycleBinUUID>{uid('recycle')}</RecycleBinUUID>\n"
+         f"\t\t<RecycleBinChanged>{kdbx_time(T_V1)}</RecycleBinChanged>\n"
+         "\t\t<EntryTemplatesGroup>AAAAAAAAAAAAAAAAAAAAAA==</EntryTemplatesGroup>\n"
+         f"\t\t<EntryTemplatesGroupChanged>{kdbx_time(T_CREATED)}</EntryTemplatesGroupChanged>\n"
+         "\t\t<LastSelectedGroup>AAAAAAAAAAAAAAAAAAAAAA==</LastSelectedGroup>\n"
+         "\t\t<LastTopVisibleGroup>AAAAAAAAAAAAAAAAAAAAAA==</LastTopVisibleGroup>\n"
+         "\t\t<HistoryMaxItems>10</HistoryMaxItems>\n"
+         "\t\t<HistoryMaxSize>6291456</HistoryMaxSize>\n"
+         f"\t\t<SettingsChanged>{kdbx_time(T_NOW)}</SettingsChanged>\n"
+         "\t\t<CustomData/>\n"
+         "\t</Meta>\n\t<Root>\n")
+    x += group_open("Root", "root", 2)
+    x += entry_xml(p, root_entry, 3)
+    x += group_open("Работа", "work", 3, notes="Рабочие учётки")
+    x += group_open("Проект", "project", 4)
+    x += entry_xml(p, server, 5)
+    x += "\t\t\t\t</Group>\n\t\t\t</Group>\n"
+    x += group_open("Личное", "personal", 3)
+    x += entry_xml(p, mail, 4, history=(mail_v1, mail_v2))
+    x += "\t\t\t</Group>\n"
+    x += group_open("Корзина", "recycle", 3)
+    x += entry_xml(p, trashed, 4)
+    x += "\t\t\t</Group>\n\t\t</Group>\n\t\t<DeletedObjects/>\n\t</Root>\n</KeePassFile>\n"
+    return x.encode()
+
+
+BINARIES = [
+    b"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJdD7y3aLq454yWBdwLWbieU1ebz9/cu7/QEXn9OIeZJ test@example\n",
+    "Вложение, которое есть и в записи, и в её версии из истории.\n".encode(),
+]
+
+
+def keyfile_xml(key):
+    h = key.hex().upper()
+    groups = [h[i:i + 8] for i in range(0, 64, 8)]
+    check = hashlib.sha256(key).digest()[:4].hex().upper()
+    return ('<?xml version="1.0" encoding="utf-8"?>\n<KeyFile>\n\t<Meta>\n\t\t<Version>2.0</Version>\n\t</Meta>\n'
+            f'\t<Key>\n\t\t<Data Hash="{check}">\n\t\t\t{" ".join(groups[:4])}\n\t\t\t{" ".join(groups[4:])}\n'
+            '\t\t</Data>\n\t</Key>\n</KeyFile>\n').encode()
+
+
+def write_kdbx(path, label, cipher, kdf, keyfile=None):
+    seed = det(label + ":seed", 32)
+    salt = det(label + ":salt", 32)
+    composite = hashlib.sha256(PASSWORD.encode()).digest()
+    if keyfile is not None:
+        composite += keyfile
+    composite = hashlib.sha256(composite).digest()
+
+    if kdf[0] == "aes":
+        rounds = kdf[1]
+        params = variant_dict([("$UUID", 0x42, KDF_AES), ("R", 0x05, rounds), ("S", 0x42, salt)])
+        transformed = aes_kdf(composite, salt, rounds)
+    else:
+        kind, uuid = {"argon2d": (0, KDF_ARGON2D), "argon2id": (2, KDF_ARGON2ID)}[kdf[0]]
+        iterations, memory, parallelism = kdf[1:]
+        params = variant_dict([("$UUID", 0x42, uuid), ("I", 0x05, iterations), ("M", 0x05, memory),
+                               ("P", 0x04, parallelism), ("S", 0x42, salt), ("V", 0x04, 0x13)])
+        transformed = argon2(kind, composite, salt, b"", b"", iterations, memory // 1024, parallelism, 32)
+
+    iv = det(label + ":iv", 16 if cipher == "aes" else 12)
+    header = struct.pack("<III", 0x9AA2D903, 0xB54BFB67, 0x00040000)
+    header += tlv(2, CIPHER_AES if cipher == "aes" else CIPHER_CHACHA)
+    header += tlv(3, struct.pack("<I", 1))
+    header += tlv(4, seed)
+    header += tlv(7, iv)
+    header += tlv(11, params)
+    header += tlv(0, b"\r\n\r\n")
+
+    stream_key = det(label + ":stream", 64)
+    inner = tlv(1, struct.pack("<I", 3)) + tlv(2, stream_key)
+    for data in BINARIES:
+        inner += tlv(3, b"\x01" + data)
+    inner += tlv(0, b"")
+    inner += build_xml(Protector(stream_key))
+    payload = gzip.compress(inner, mtime=0)
+
+    enc_key = hashlib.sha256(seed + transformed).digest()
+    hmac_key = hashlib.sha512(seed + transformed + b"\x01").digest()
+    payload = aes_cbc(enc_key, iv, payload) if cipher == "aes" else chacha20(enc_key, iv, payload)
+
+    out = header + hashlib.sha256(header).digest()
+    out += hmac.new(block_key(hmac_key, M64), header, hashlib.sha256).digest()
+    index = 0
+    for chunk in [payload[i:i + 4096] for i in range(0, len(payload), 4096)] + [b""]:
+        prefix = struct.pack("<QI", index, len(chunk))
+        out += hmac.new(block_key(hmac_key, index), prefix + chunk, hashlib.sha256).digest()
+        out += struct.pack("<I", len(chunk)) + chunk
+        index += 1
+    with open(path, "wb") as f:
+        f.write(out)
+
+
+def main():
+    check_rfc9106()
+    key = det("keyfile", 32)
+    with open("keyfile.keyx", "wb") as f:
+        f.write(keyfile_xml(key))
+    write_kdbx("aeskdf-aes.kdbx", "aeskdf-aes", "aes", ("aes", 1000))
+    write_kdbx("argon2d-chacha20.kdbx", "argon2d-chacha20", "chacha20", ("argon2d", 2, 1 << 20, 2))
+    write_kdbx("argon2id-aes-keyfile.kdbx", "argon2id-aes-keyfile", "aes", ("argon2id", 2, 1 << 20, 2), keyfile=key)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,291 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+// Внутренний XML KeePass; описаны только нужные нам элементы, остальные при чтении пропускаются
+
+type xmlFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    xmlMeta  `xml:"Meta"`
+	Root    struct {
+		Group xmlGroup `xml:"Group"`
+	} `xml:"Root"`
+}
+
+type xmlMeta struct {
+	Generator         string `xml:"Generator"`
+	DatabaseName      string `xml:"DatabaseName"`
+	RecycleBinEnabled string `xml:"RecycleBinEnabled,omitempty"`
+	RecycleBinUUID    string `xml:"RecycleBinUUID,omitempty"`
+}
+
+type xmlGroup struct {
+	UUID       string     `xml:"UUID"`
+	Name       string     `xml:"Name"`
+	Notes      string     `xml:"Notes,omitempty"`
+	IconID     int        `xml:"IconID"`
+	Times      xmlTimes   `xml:"Times"`
+	IsExpanded string     `xml:"IsExpanded,omitempty"`
+	Entries    []xmlEntry `xml:"Entry"`
+	Groups     []xmlGroup `xml:"Group"`
+}
+
+type xmlEntry struct {
+	UUID     string      `xml:"UUID"`
+	IconID   int         `xml:"IconID"`
+	Tags     string      `xml:"Tags,omitempty"`
+	Times    xmlTimes    `xml:"Times"`
+	Strings  []xmlString `xml:"String"`
+	Binaries []xmlBinary `xml:"Binary"`
+	History  *struct {
+		Entries []xmlEntry `xml:"Entry"`
+	} `xml:"History,omitempty"`
+}
+
+type xmlTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+type xmlString struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Protected string `xml:"Protected,attr,omitempty"`
+		Text      string `xml:",chardata"`
+	} `xml:"Value"`
+}
+
+type xmlBinary struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Ref int `xml:"Ref,attr"`
+	} `xml:"Value"`
+}
+
+// epoch — начало отсчёта времени KDBX 4: секунды с 0001-01-01 UTC в base64
+var epoch = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func encodeTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	var b [8]byte
+	secs := uint64(t.Unix()) + uint64(-epoch.Unix())
+	binary.LittleEndian.PutUint64(b[:], secs)
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// decodeTime понимает и формат KDBX 4, и ISO 8601 из KDBX 3; нераспознанное время — нулевое
+func decodeTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == 8 {
+		secs := int64(binary.LittleEndian.Uint64(b))
+		return time.Unix(secs+epoch.Unix(), 0)
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+func newTimes(created, modified time.Time) xmlTimes {
+	if modified.IsZero() {
+		modified = created
+	}
+	return xmlTimes{
+		CreationTime:         encodeTime(created),
+		LastModificationTime: encodeTime(modified),
+		LastAccessTime:       encodeTime(modified),
+		ExpiryTime:           encodeTime(modified),
+		Expires:              "False",
+		LocationChanged:      encodeTime(modified),
+	}
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+func isTrue(s string) bool {
+	return strings.EqualFold(strings.TrimSpace(s), "true")
+}
+
+// transformProtected проходит XML в порядке документа и пропускает значения
+// <Value Protected="True"> через внутренний поток. При чтении decode=true: base64
+// шифротекста заменяется открытым текстом; при записи наоборот. Порядок важен —
+// поток общий на весь документ.
+func transformProtected(data []byte, stream innerStream, decode bool) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	enc := xml.NewEncoder(&out)
+	var protected bool
+	var text []byte
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			protected = false
+			if t.Name.Local == "Value" {
+				for _, a := range t.Attr {
+					protected = protected || (a.Name.Local == "Protected" && isTrue(a.Value))
+				}
+			}
+			text = text[:0]
+		case xml.CharData:
+			if protected {
+				text = append(text, t...)
+				continue
+			}
+		case xml.EndElement:
+			if protected {
+				value, err := protectValue(stream, text, decode)
+				if err != nil {
+					return nil, err
+				}
+				if err := enc.EncodeToken(xml.CharData(value)); err != nil {
+					return nil, err
+				}
+				protected = false
+			}
+		case xml.ProcInst:
+			continue // объявление XML добавим сами
+		}
+		if err := enc.EncodeToken(xml.CopyToken(tok)); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func protectValue(stream innerStream, text []byte, decode bool) ([]byte, error) {
+	if !decode {
+		ct := make([]byte, len(text))
+		stream.XORKeyStream(ct, text)
+		return []byte(base64.StdEncoding.EncodeToString(ct)), nil
+	}
+	ct, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(text)))
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	stream.XORKeyStream(ct, ct)
+	return ct, nil
+}
+
+// toGroup переводит группу XML в модель; binaries — вложения из внутреннего заголовка
+func (g xmlGroup) toGroup(binaries [][]byte, skipUUID string) Group {
+	out := Group{Name: g.Name, Notes: g.Notes}
+	for _, e := range g.Entries {
+		out.Entries = append(out.Entries, e.toEntry(binaries))
+	}
+	for _, sub := range g.Groups {
+		if skipUUID != "" && sub.UUID == skipUUID {
+			continue
+		}
+		out.Groups = append(out.Groups, sub.toGroup(binaries, skipUUID))
+	}
+	return out
+}
+
+func (e xmlEntry) toEntry(binaries [][]byte) Entry {
+	out := Entry{
+		Tags:     ParseTags(e.Tags),
+		Created:  decodeTime(e.Times.CreationTime),
+		Modified: decodeTime(e.Times.LastModificationTime),
+	}
+	for _, s := range e.Strings {
+		out.Strings = append(out.Strings, String{Key: s.Key, Value: s.Value.Text, Protected: isTrue(s.Value.Protected)})
+	}
+	for _, b := range e.Binaries {
+		if b.Value.Ref >= 0 && b.Value.Ref < len(binaries) {
+			out.Binaries = append(out.Binaries, Binary{Name: b.Key, Data: binaries[b.Value.Ref]})
+		}
+	}
+	if e.History != nil {
+		for _, h := range e.History.Entries {
+			out.History = append(out.History, h.toEntry(binaries))
+		}
+	}
+	return out
+}
+
+// binaryPool собирает вложения для внутреннего заголовка; одинаковое содержимое
+// (например, в версиях из истории) хранится один раз
+type binaryPool struct {
+	data  [][]byte
+	index map[string]int
+}
+
+func (p *binaryPool) ref(data []byte) int {
+	if i, ok := p.index[string(data)]; ok {
+		return i
+	}
+	if p.index == nil {
+		p.index = map[string]int{}
+	}
+	p.index[string(data)] = len(p.data)
+	p.data = append(p.data, data)
+	return len(p.data) - 1
+}
+
+func fromGroup(g Group, pool *binaryPool) xmlGroup {
+	out := xmlGroup{UUID: newUUID(), Name: g.Name, Notes: g.Notes, IconID: 48, Times: newTimes(time.Now(), time.Now()), IsExpanded: "True"}
+	for _, e := range g.Entries {
+		out.Entries = append(out.Entries, fromEntry(e, newUUID(), pool))
+	}
+	for _, sub := range g.Groups {
+		out.Groups = append(out.Groups, fromGroup(sub, pool))
+	}
+	return out
+}
+
+// fromEntry переводит запись в XML; версии из истории получают тот же UUID, что и запись
+func fromEntry(e Entry, uuid string, pool *binaryPool) xmlEntry {
+	out := xmlEntry{UUID: uuid, Tags: strings.Join(e.Tags, ";"), Times: newTimes(e.Created, e.Modified)}
+	for _, s := range e.Strings {
+		x := xmlString{Key: s.Key}
+		x.Value.Text = s.Value
+		if s.Protected {
+			x.Value.Protected = "True"
+		}
+		out.Strings = append(out.Strings, x)
+	}
+	for _, b := range e.Binaries {
+		x := xmlBinary{Key: b.Name}
+		x.Value.Ref = pool.ref(b.Data)
+		out.Binaries = append(out.Binaries, x)
+	}
+	if len(e.History) > 0 {
+		out.History = &struct {
+			Entries []xmlEntry `xml:"Entry"`
+		}{}
+		for _, h := range e.History {
+			out.History.Entries = append(out.History.Entries, fromEntry(h, uuid, pool))
+		}
+	}
+	return out
+}
@@ -1,24 +1,31 @@
-package main
-
-import (
-	application "github.com/reinbowARA/PassLedger/app"
-
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/app"
-)
-
-func main() {
-	var icon fyne.Resource
-	var err error
-	a := app.NewWithID("PassLedger")
-	theme := a.Settings().ThemeVariant()
-	if theme == 0 {
-		icon, err = fyne.LoadResourceFromPath("src/icon-white.svg")
-	} else {
-		icon, err = fyne.LoadResourceFromPath("src/icon.svg")
-	}
-	if err == nil {
-		a.SetIcon(icon)
-	}
-	application.ShowLoginWindow(a)
-}
+package main
+
+import (
+	"os"
+
+	application "github.com/reinbowARA/PassLedger/app"
+	"github.com/reinbowARA/PassLedger/cli"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+)
+
+func main() {
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
+	var icon fyne.Resource
+	var err error
+	a := app.NewWithID("PassLedger")
+	theme := a.Settings().ThemeVariant()
+	if theme == 0 {
+		icon, err = fyne.LoadResourceFromPath("src/icon-white.svg")
+	} else {
+		icon, err = fyne.LoadResourceFromPath("src/icon.svg")
+	}
+	if err == nil {
+		a.SetIcon(icon)
+	}
+	application.ShowLoginWindow(a)
+}
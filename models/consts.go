@@ -3,6 +3,7 @@ package models
 const (
 	DefaultDBPath        string = "data/passwords.db"
 	DefaultNameAllGroups string = "Все"
+	DefaultNameTrash     string = "Корзина"
 )
 
 // form name
@@ -13,10 +14,19 @@ const (
 	URL    string = "URL"
 	NOTES  string = "Заметки"
 	GROUP  string = "Группа"
+	FIELDS string = "Доп. поля"
+	TAGS   string = "Теги"
+	OTP    string = "Секрет TOTP"
+
+	CREATED          string = "Создано"
+	MODIFIED         string = "Изменено"
+	PASSWORD_CHANGED string = "Пароль изменён"
+	LAST_USED        string = "Использовано"
 )
 
 const (
 	TIME_CLEAR_PASSWD int = 10 //second
+	TIME_AUTO_LOCK    int = 5  //minute, 0 — не блокировать
 )
 
 const (
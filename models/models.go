@@ -1,13 +1,48 @@
 package models
 
+import "time"
+
 type PasswordEntry struct {
-	ID       int
-	Title    string
-	Username string
-	Password string
-	URL      string
-	Notes    string
-	Group    string
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	URL      string `json:"url"`
+	Notes    string `json:"notes"`
+	// Group — путь группы записи: «Работа/Почта»; имена групп уникальны только внутри родителя
+	Group string `json:"group"`
+	// Fields — дополнительные поля в порядке отображения
+	Fields []CustomField `json:"fields,omitempty"`
+	// Tags — метки записи по алфавиту; в отличие от группы их может быть несколько
+	Tags []string `json:"tags,omitempty"`
+	// OTP — секрет TOTP: base32 или otpauth:// URI; хранится зашифрованным, как пароль
+	OTP string `json:"otp,omitempty"`
+	// OTPCode — текущий код TOTP; в базе не хранится, его заполняет тот, кто выводит запись
+	OTPCode string `json:"otp_code,omitempty"`
+
+	// Отметки времени ведёт пакет db; нулевое значение — время неизвестно
+	// (записи из баз до появления отметок) или пароль ещё не копировался
+	Created         time.Time `json:"created,omitzero"`
+	Modified        time.Time `json:"modified,omitzero"`
+	PasswordChanged time.Time `json:"password_changed,omitzero"`
+	LastUsed        time.Time `json:"last_used,omitzero"`
+}
+
+// CustomFieldType определяет, как дополнительное поле показывается и копируется
+type CustomFieldType string
+
+const (
+	FieldText   CustomFieldType = "text"   // обычный текст
+	FieldHidden CustomFieldType = "hidden" // маскируется, как пароль (PIN, ответ на секретный вопрос)
+	FieldURL    CustomFieldType = "url"    // ссылка
+	FieldDate   CustomFieldType = "date"   // дата в формате ДД.ММ.ГГГГ
+)
+
+// CustomField — дополнительное поле записи
+type CustomField struct {
+	Name  string          `json:"name"`
+	Value string          `json:"value"`
+	Type  CustomFieldType `json:"type"`
 }
 
 type FilterSettings struct {
@@ -21,17 +56,99 @@ type SearchFilters struct {
 	URL      bool
 	Group    bool
 	Notes    bool
+	Fields   bool // имена и значения дополнительных полей, кроме скрытых
+	Tags     bool
 }
 
 type Groups struct {
-	Id   int    `db:"id"`
-	Name string `db:"name"`
+	Id       int    `db:"id" json:"id"`
+	Name     string `db:"name" json:"name"`
+	ParentId int    `db:"parent_id" json:"parent_id,omitempty"` // 0 — группа верхнего уровня
+	Path     string `json:"path"`                               // путь от верхнего уровня: «Работа/Почта»
 }
 
 type Settings struct {
 	DBPath       string `json:"db_path"`
+	KeyfilePath  string `json:"keyfile_path,omitempty"`
 	ThemeVariant int    `json:"theme_variant"`
 	TimerSeconds int    `json:"timer_seconds"`
+	LockMinutes  int    `json:"lock_minutes"`
+}
+
+// EntryRevision — версия записи, сохранённая перед её изменением
+type EntryRevision struct {
+	ID        int
+	EntryID   int
+	ChangedAt time.Time
+	Entry     PasswordEntry
+}
+
+// FieldChange — различие одного поля между двумя версиями записи
+type FieldChange struct {
+	Field  string // название поля для отображения (TITLE, LOGIN, ... или имя дополнительного поля)
+	Old    string
+	New    string
+	Hidden bool // значения не показываются (пароль, скрытые поля)
+}
+
+// HistoryRetention — сколько версий записей хранить; 0 — без ограничения
+type HistoryRetention struct {
+	MaxRevisions int // версий на запись
+	MaxDays      int // дней с момента изменения
+}
+
+// Attachment — файл, прикреплённый к записи; содержимое читается из базы отдельно
+type Attachment struct {
+	ID      int
+	EntryID int
+	Name    string
+	Size    int64
+	Created time.Time
+}
+
+// TrashedEntry — запись в корзине
+type TrashedEntry struct {
+	Entry     PasswordEntry
+	DeletedAt time.Time
+}
+
+// TrashedGroup — группа в корзине вместе с числом удалённых вместе с ней записей
+type TrashedGroup struct {
+	Group     Groups
+	DeletedAt time.Time
+	Entries   int
+}
+
+// SnapshotInfo — сводка снимка хранилища для резервной копии: все группы, число записей
+// и настройки хранения истории и корзины. Записи со вложениями передаются после неё по одной.
+type SnapshotInfo struct {
+	Groups    []SnapshotGroup  `json:"groups"`
+	Entries   int              `json:"entries"`
+	History   HistoryRetention `json:"history"`
+	TrashDays int              `json:"trash_days"`
+}
+
+// SnapshotGroup — группа снимка; ParentID ссылается на ID другой группы того же снимка
+type SnapshotGroup struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	ParentID int       `json:"parent_id,omitempty"`
+	Deleted  time.Time `json:"deleted,omitzero"` // в корзине с этого момента
+}
+
+// SnapshotEntry — запись снимка с вложениями и историей версий; группа указана путём
+type SnapshotEntry struct {
+	Entry       PasswordEntry        `json:"entry"`
+	Deleted     time.Time            `json:"deleted,omitzero"`
+	Attachments []SnapshotAttachment `json:"attachments,omitempty"`
+	History     []EntryRevision      `json:"history,omitempty"` // от старых к новым
+}
+
+// SnapshotAttachment — вложение снимка; содержимое (Size байт) передаётся отдельно от записи
+type SnapshotAttachment struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
 }
 
 type PasswordGeneratorOptions struct {